@@ -16,7 +16,10 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"github.com/gimlet-io/gimletd/dx"
@@ -31,17 +34,21 @@ import (
 )
 
 const (
-	pathArtifact   = "%s/api/artifact"
-	pathArtifacts  = "%s/api/artifacts"
-	pathReleases   = "%s/api/releases"
-	pathStatus     = "%s/api/status"
-	pathRollback   = "%s/api/rollback"
-	pathDelete     = "%s/api/delete"
-	pathEvent      = "%s/api/event"
-	pathUser       = "%s/api/user"
-	pathGitopsRepo = "%s/api/gitopsRepo"
+	pathArtifact     = "%s/api/artifact"
+	pathArtifacts    = "%s/api/artifacts"
+	pathReleases     = "%s/api/releases"
+	pathBatchRelease = "%s/api/releases/batch"
+	pathStatus       = "%s/api/status"
+	pathRollback     = "%s/api/rollback"
+	pathDelete       = "%s/api/delete"
+	pathEvent        = "%s/api/event"
+	pathEventsStream = "%s/api/events/stream"
+	pathUser         = "%s/api/user"
+	pathGitopsRepo   = "%s/api/gitopsRepo"
 )
 
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type client struct {
 	client *http.Client
 	addr   string
@@ -67,7 +74,8 @@ func (c *client) SetAddress(addr string) {
 	c.addr = addr
 }
 
-// ArtifactPost creates a new user account.
+// ArtifactPost creates a new artifact.
+// A retried push of the same artifact returns the already existing one.
 func (c *client) ArtifactPost(in *dx.Artifact) (*dx.Artifact, error) {
 	out := new(dx.Artifact)
 	uri := fmt.Sprintf(pathArtifact, c.addr)
@@ -75,6 +83,58 @@ func (c *client) ArtifactPost(in *dx.Artifact) (*dx.Artifact, error) {
 	return out, err
 }
 
+// ArtifactPostWithIdempotencyKey creates a new artifact, deduplicated by the given idempotency key
+func (c *client) ArtifactPostWithIdempotencyKey(in *dx.Artifact, idempotencyKey string) (*dx.Artifact, error) {
+	artifactBytes, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return c.postArtifact(artifactBytes, map[string]string{
+		idempotencyKeyHeader: idempotencyKey,
+	})
+}
+
+// SignedArtifactPost creates a new artifact with a detached ed25519 signature of the artifact body
+func (c *client) SignedArtifactPost(in *dx.Artifact, privateKey ed25519.PrivateKey) (*dx.Artifact, error) {
+	artifactBytes, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return c.postArtifact(artifactBytes, map[string]string{
+		dx.SignatureHeader: dx.SignArtifact(privateKey, artifactBytes),
+	})
+}
+
+func (c *client) postArtifact(artifactBytes []byte, headers map[string]string) (*dx.Artifact, error) {
+	uri := fmt.Sprintf(pathArtifact, c.addr)
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(artifactBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	body, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	out := new(dx.Artifact)
+	err = json.NewDecoder(body).Decode(out)
+	return out, err
+}
+
+// ArtifactGet returns an artifact with its deployments
+func (c *client) ArtifactGet(id string) (*dx.Artifact, error) {
+	uri := fmt.Sprintf(pathArtifact, c.addr)
+	out := new(dx.Artifact)
+	err := c.get(uri+"/"+id, out)
+	return out, err
+}
+
 // ArtifactsGet creates a new user account.
 func (c *client) ArtifactsGet(
 	repo, branch string,
@@ -84,8 +144,6 @@ func (c *client) ArtifactsGet(
 	limit, offset int,
 	since, until *time.Time,
 ) ([]*dx.Artifact, error) {
-	uri := fmt.Sprintf(pathArtifacts, c.addr)
-
 	var params []string
 
 	if limit != 0 {
@@ -118,6 +176,37 @@ func (c *client) ArtifactsGet(
 		}
 	}
 
+	return c.artifacts(params)
+}
+
+// ArtifactsSearch returns the artifacts that match all fields and the text
+func (c *client) ArtifactsSearch(
+	fields map[string]string,
+	text string,
+	limit, offset int,
+) ([]*dx.Artifact, error) {
+	var params []string
+
+	for name, value := range fields {
+		params = append(params, fmt.Sprintf("%s=%s", url.QueryEscape(name), url.QueryEscape(value)))
+	}
+	if text != "" {
+		params = append(params, fmt.Sprintf("q=%s", url.QueryEscape(text)))
+	}
+	if limit != 0 {
+		params = append(params, fmt.Sprintf("limit=%d", limit))
+	}
+	if offset != 0 {
+		params = append(params, fmt.Sprintf("offset=%d", offset))
+	}
+
+	return c.artifacts(params)
+}
+
+// artifacts lists the artifacts that match the query params
+func (c *client) artifacts(params []string) ([]*dx.Artifact, error) {
+	uri := fmt.Sprintf(pathArtifacts, c.addr)
+
 	var paramsStr string
 	if len(params) > 0 {
 		paramsStr = strings.Join(params, "&")
@@ -284,6 +373,18 @@ func (c *client) ReleasesPost(request dx.ReleaseRequest) (string, error) {
 	return res["id"].(string), nil
 }
 
+// BatchReleasePost releases the given artifacts in a single gitops commit
+func (c *client) BatchReleasePost(request dx.BatchReleaseRequest) (string, error) {
+	uri := fmt.Sprintf(pathBatchRelease, c.addr)
+	result := new(map[string]interface{})
+	err := c.post(uri, request, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
 // RollbackPost rolls back to a specific gitops commit
 func (c *client) RollbackPost(env string, app string, targetSHA string) (string, error) {
 	uri := fmt.Sprintf(pathRollback+"?env=%s&app=%s&sha=%s", c.addr, env, app, targetSHA)
@@ -320,6 +421,105 @@ func (c *client) TrackGet(trackingID string) (*dx.ReleaseStatus, error) {
 	return result, nil
 }
 
+// TrackFollow follows the status of an event on the event stream until it reaches a terminal state,
+// or the context is done. It reconnects when the stream ends, and calls onUpdate on every state transition
+func (c *client) TrackFollow(ctx context.Context, trackingID string, onUpdate func(*dx.ReleaseStatus)) (*dx.ReleaseStatus, error) {
+	uri := fmt.Sprintf(pathEventsStream, c.addr) + "?id=" + url.QueryEscape(trackingID)
+
+	for {
+		status, err := c.follow(ctx, uri, onUpdate)
+		if ctx.Err() != nil {
+			return status, fmt.Errorf("stopped following %s: %s", trackingID, ctx.Err())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status != nil && isTerminal(status) {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(followReconnectDelay):
+		}
+	}
+}
+
+const followReconnectDelay = 1 * time.Second
+
+// follow reads the event stream until a terminal state or the end of the stream,
+// and returns the last seen status
+func (c *client) follow(ctx context.Context, uri string, onUpdate func(*dx.ReleaseStatus)) (*dx.ReleaseStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	body, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var status *dx.ReleaseStatus
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var update dx.EventUpdate
+		err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &update)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse event stream: %s", err)
+		}
+		if update.ReleaseStatus == nil {
+			continue
+		}
+
+		status = update.ReleaseStatus
+		if onUpdate != nil {
+			onUpdate(status)
+		}
+		if isTerminal(status) {
+			return status, nil
+		}
+	}
+
+	// a broken connection is not fatal, the caller reconnects
+	return status, nil
+}
+
+// isTerminal tells if the event failed, or it was processed and Flux finished applying all its gitops commits
+func isTerminal(status *dx.ReleaseStatus) bool {
+	if status.Status == model.StatusError {
+		return true
+	}
+	if status.Status != model.StatusProcessed {
+		return false
+	}
+
+	for _, gitopsHash := range status.GitopsHashes {
+		switch gitopsHash.Status {
+		case model.ReconciliationSucceeded,
+			model.ValidationFailed,
+			model.ReconciliationFailed,
+			model.HealthCheckFailed:
+		case model.Progressing:
+			if !strings.Contains(gitopsHash.StatusDesc, "Health check passed") {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 // UserGet returns the user with the given login name
 func (c *client) UserGet(login string, withToken bool) (*model.User, error) {
 	uri := fmt.Sprintf(pathUser, c.addr)
@@ -425,6 +625,10 @@ func (c *client) open(rawURL, method string, in interface{}) (io.ReadCloser, err
 		req.Header.Set("Content-Length", strconv.Itoa(len(decoded)))
 		req.Header.Set("Content-Type", "application/json")
 	}
+	return c.send(req)
+}
+
+func (c *client) send(req *http.Request) (io.ReadCloser, error) {
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
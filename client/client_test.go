@@ -1,17 +1,22 @@
 package client
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/base32"
+	"encoding/base64"
 	"github.com/gimlet-io/gimletd/cmd/config"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/server"
+	"github.com/gimlet-io/gimletd/server/streaming"
 	"github.com/gimlet-io/gimletd/server/token"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/gorilla/securecookie"
 	"github.com/stretchr/testify/assert"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 import (
@@ -21,7 +26,7 @@ import (
 func Test_artifact(t *testing.T) {
 	store := store.NewTest()
 
-	router := server.SetupRouter(&config.Config{}, store, nil, nil, nil)
+	router := server.SetupRouter(&config.Config{}, store, nil, nil, nil, nil)
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -57,6 +62,15 @@ func Test_artifact(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "sha", savedArtifact.Version.SHA)
 
+	retriedArtifact, err := client.ArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha",
+			RepositoryName: "my-app",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, savedArtifact.ID, retriedArtifact.ID, "a retried push should return the existing artifact")
+
 	artifacts, err := client.ArtifactsGet(
 		"", "",
 		nil,
@@ -67,4 +81,260 @@ func Test_artifact(t *testing.T) {
 	)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(artifacts))
+
+	artifacts, err = client.ArtifactsSearch(map[string]string{"context.JOB_NAME": "my-app-build"}, "", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(artifacts))
+
+	err = store.CreateDeployment(&model.Deployment{
+		ArtifactID:  savedArtifact.ID,
+		Env:         "staging",
+		App:         "my-app",
+		GitopsRef:   "gitops-sha",
+		TriggeredBy: "policy",
+	})
+	assert.Nil(t, err)
+	err = store.SaveOrUpdateGitopsCommit(&model.GitopsCommit{
+		Sha:    "gitops-sha",
+		Status: model.ReconciliationSucceeded,
+	})
+	assert.Nil(t, err)
+
+	artifact, err := client.ArtifactGet(savedArtifact.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, savedArtifact.ID, artifact.ID)
+	assert.Equal(t, 1, len(artifact.Deployments))
+	assert.Equal(t, "staging", artifact.Deployments[0].Env)
+	assert.Equal(t, model.ReconciliationSucceeded, artifact.Deployments[0].GitopsStatus)
+
+	_, err = client.ArtifactGet("my-app-non-existing")
+	assert.NotNil(t, err)
+}
+
+func Test_artifactIdempotencyKey(t *testing.T) {
+	store := store.NewTest()
+
+	router := server.SetupRouter(&config.Config{}, store, nil, nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	user := &model.User{
+		Login: "admin",
+		Secret: base32.StdEncoding.EncodeToString(
+			securecookie.GenerateRandomKey(32),
+		),
+	}
+	err := store.CreateUser(user)
+	assert.Nil(t, err)
+
+	tokenInstance := token.New(token.UserToken, user.Login)
+	tokenStr, err := tokenInstance.Sign(user.Secret)
+	assert.Nil(t, err)
+
+	config := new(oauth2.Config)
+	auther := config.Client(
+		oauth2.NoContext,
+		&oauth2.Token{
+			AccessToken: tokenStr,
+		},
+	)
+
+	client := NewClient(server.URL, auther)
+
+	savedArtifact, err := client.ArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha",
+			RepositoryName: "my-app",
+			Branch:         "feature",
+		},
+	})
+	assert.Nil(t, err)
+
+	branchArtifact, err := client.ArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha",
+			RepositoryName: "my-app",
+			Branch:         "main",
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, savedArtifact.ID, branchArtifact.ID, "the same commit on another branch should be a new artifact")
+
+	keyedArtifact, err := client.ArtifactPostWithIdempotencyKey(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha2",
+			RepositoryName: "my-app",
+		},
+	}, "build-1")
+	assert.Nil(t, err)
+	retriedKeyedArtifact, err := client.ArtifactPostWithIdempotencyKey(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha3",
+			RepositoryName: "my-app",
+		},
+	}, "build-1")
+	assert.Nil(t, err)
+	assert.Equal(t, keyedArtifact.ID, retriedKeyedArtifact.ID, "the client key should deduplicate")
+	otherRepoArtifact, err := client.ArtifactPostWithIdempotencyKey(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha2",
+			RepositoryName: "my-other-app",
+		},
+	}, "build-1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, keyedArtifact.ID, otherRepoArtifact.ID, "client keys should be scoped to the repository")
+}
+
+func Test_signedArtifact(t *testing.T) {
+	store := store.NewTest()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	router := server.SetupRouter(&config.Config{
+		Signing: config.Signing{
+			Keys: config.KeyMapping{
+				"my-app": []string{base64.StdEncoding.EncodeToString(publicKey)},
+			},
+		},
+	}, store, nil, nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	user := &model.User{
+		Login: "admin",
+		Secret: base32.StdEncoding.EncodeToString(
+			securecookie.GenerateRandomKey(32),
+		),
+	}
+	err = store.CreateUser(user)
+	assert.Nil(t, err)
+
+	tokenInstance := token.New(token.UserToken, user.Login)
+	tokenStr, err := tokenInstance.Sign(user.Secret)
+	assert.Nil(t, err)
+
+	config := new(oauth2.Config)
+	auther := config.Client(
+		oauth2.NoContext,
+		&oauth2.Token{
+			AccessToken: tokenStr,
+		},
+	)
+
+	client := NewClient(server.URL, auther)
+
+	savedArtifact, err := client.SignedArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha",
+			RepositoryName: "my-app",
+		},
+	}, privateKey)
+	assert.Nil(t, err)
+	assert.True(t, savedArtifact.Provenance.IsVerified())
+	assert.Equal(t, dx.KeyID(publicKey), savedArtifact.Provenance.KeyID)
+
+	_, anotherPrivateKey, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	_, err = client.SignedArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "another-sha",
+			RepositoryName: "my-app",
+		},
+	}, anotherPrivateKey)
+	assert.NotNil(t, err, "should reject artifacts signed with an unknown key")
+
+	unsignedArtifact, err := client.ArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "unsigned-sha",
+			RepositoryName: "my-app",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, dx.SignatureUnsigned, unsignedArtifact.Provenance.SignatureStatus)
+}
+
+func Test_trackFollow(t *testing.T) {
+	store := store.NewTest()
+	eventStream := streaming.NewBroker()
+
+	router := server.SetupRouter(&config.Config{}, store, nil, nil, nil, eventStream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	user := &model.User{
+		Login: "admin",
+		Secret: base32.StdEncoding.EncodeToString(
+			securecookie.GenerateRandomKey(32),
+		),
+	}
+	err := store.CreateUser(user)
+	assert.Nil(t, err)
+
+	tokenInstance := token.New(token.UserToken, user.Login)
+	tokenStr, err := tokenInstance.Sign(user.Secret)
+	assert.Nil(t, err)
+
+	config := new(oauth2.Config)
+	auther := config.Client(
+		oauth2.NoContext,
+		&oauth2.Token{
+			AccessToken: tokenStr,
+		},
+	)
+
+	client := NewClient(server.URL, auther)
+
+	event, err := store.CreateEvent(&model.Event{
+		Type: model.TypeRelease,
+		Blob: "{}",
+	})
+	assert.Nil(t, err)
+
+	updates := make(chan *dx.ReleaseStatus, 10)
+	result := make(chan *dx.ReleaseStatus)
+	go func() {
+		status, err := client.TrackFollow(context.Background(), event.ID, func(status *dx.ReleaseStatus) {
+			updates <- status
+		})
+		assert.Nil(t, err)
+		result <- status
+	}()
+
+	initial := <-updates
+	assert.Equal(t, model.StatusNew, initial.Status)
+
+	err = store.UpdateEventStatus(event.ID, model.StatusProcessed, "", `["gitops-sha"]`)
+	assert.Nil(t, err)
+	eventStream.Publish(&dx.EventUpdate{EventID: event.ID})
+
+	processed := <-updates
+	assert.Equal(t, model.StatusProcessed, processed.Status)
+	assert.Equal(t, "N/A", processed.GitopsHashes[0].Status)
+
+	err = store.SaveOrUpdateGitopsCommit(&model.GitopsCommit{
+		Sha:    "gitops-sha",
+		Status: model.ReconciliationSucceeded,
+	})
+	assert.Nil(t, err)
+	eventStream.Publish(&dx.EventUpdate{
+		GitopsCommit: &dx.GitopsStatus{Hash: "gitops-sha", Status: model.ReconciliationSucceeded},
+	})
+
+	select {
+	case status := <-result:
+		assert.Equal(t, model.ReconciliationSucceeded, status.GitopsHashes[0].Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("should stop following once the gitops commit is applied")
+	}
+
+	pending, err := store.CreateEvent(&model.Event{
+		Type: model.TypeRelease,
+		Blob: "{}",
+	})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.TrackFollow(ctx, pending.ID, nil)
+	assert.NotNil(t, err, "should stop following when the context is done")
 }
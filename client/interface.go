@@ -16,6 +16,8 @@
 package client
 
 import (
+	"context"
+	"crypto/ed25519"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"net/http"
@@ -30,10 +32,20 @@ type Client interface {
 	// SetAddress sets the server address.
 	SetAddress(string)
 
-	// ArtifactPost creates a new artifact.
+	// ArtifactPost creates a new artifact, or returns the existing one if it was pushed already.
 	ArtifactPost(artifact *dx.Artifact) (*dx.Artifact, error)
 
-	// ArtifactsGet returns all artifacts in the database within the given constraints
+	// ArtifactPostWithIdempotencyKey creates a new artifact, or returns the existing one
+	// that was pushed with the same idempotency key in the repository
+	ArtifactPostWithIdempotencyKey(artifact *dx.Artifact, idempotencyKey string) (*dx.Artifact, error)
+
+	// SignedArtifactPost creates a new artifact with a detached ed25519 signature
+	SignedArtifactPost(artifact *dx.Artifact, privateKey ed25519.PrivateKey) (*dx.Artifact, error)
+
+	// ArtifactGet returns an artifact with the env, app, gitops commit and Flux status of its deployments
+	ArtifactGet(id string) (*dx.Artifact, error)
+
+	// ArtifactsGet returns all artifacts in the database within the given constraints.
 	ArtifactsGet(
 		repo, branch string,
 		event *dx.GitEvent,
@@ -43,6 +55,15 @@ type Client interface {
 		since, until *time.Time,
 	) ([]*dx.Artifact, error)
 
+	// ArtifactsSearch returns the artifacts that match all fields and the text.
+	// Fields filter on context variables and item fields, eg.: context.JOB_NAME or item.image.tag,
+	// text matches the commit message and author
+	ArtifactsSearch(
+		fields map[string]string,
+		text string,
+		limit, offset int,
+	) ([]*dx.Artifact, error)
+
 	// ReleasesGet returns all releases from the gitops repo within the given constraints
 	ReleasesGet(
 		app string,
@@ -61,6 +82,9 @@ type Client interface {
 	// ReleasesPost releases the given artifact to the given environment
 	ReleasesPost(request dx.ReleaseRequest) (string, error)
 
+	// BatchReleasePost releases the given artifacts and apps in a single gitops commit
+	BatchReleasePost(request dx.BatchReleaseRequest) (string, error)
+
 	// RollbackPost rolls back to the given sha
 	RollbackPost(env string, app string, targetSHA string) (string, error)
 
@@ -70,6 +94,10 @@ type Client interface {
 	// TrackGet returns the state of an event
 	TrackGet(trackingID string) (*dx.ReleaseStatus, error)
 
+	// TrackFollow follows the state of an event until it is processed and applied by Flux, or fails.
+	// It stops when the context is done, use a context with timeout to bound the wait
+	TrackFollow(ctx context.Context, trackingID string, onUpdate func(*dx.ReleaseStatus)) (*dx.ReleaseStatus, error)
+
 	// UserGet returns the user with the given login
 	UserGet(login string, withToken bool) (*model.User, error)
 
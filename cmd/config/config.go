@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v2"
@@ -26,9 +28,33 @@ func defaults(c *Config) {
 	if c.RepoCachePath == "" {
 		c.RepoCachePath = "/tmp/gimletd"
 	}
+	if c.ChartCache.Path == "" {
+		c.ChartCache.Path = "/tmp/gimletd-charts"
+	}
+	if c.ChartCache.MaxSizeMB == 0 {
+		c.ChartCache.MaxSizeMB = 1024
+	}
+	if c.ChartRegistries.HelmConfigHome == "" {
+		c.ChartRegistries.HelmConfigHome = "/tmp/gimletd-helm"
+	}
 	if c.ReleaseStats == "" {
 		c.ReleaseStats = "disabled"
 	}
+	if c.Notifications.OutboxRetention == 0 {
+		c.Notifications.OutboxRetention = 7 * 24 * time.Hour
+	}
+	if c.Notifications.Webhook.MaxRetries == 0 {
+		c.Notifications.Webhook.MaxRetries = 5
+	}
+	if c.Notifications.Webhook.Backoff == 0 {
+		c.Notifications.Webhook.Backoff = 10 * time.Second
+	}
+	if c.Notifications.Email.SMTPPort == 0 {
+		c.Notifications.Email.SMTPPort = 587
+	}
+	if c.Notifications.Email.DigestTime == "" {
+		c.Notifications.Email.DigestTime = "08:00"
+	}
 }
 
 // String returns the configuration in string format.
@@ -49,6 +75,64 @@ type Config struct {
 	Github                  Github
 	ReleaseStats            string `envconfig:"RELEASE_STATS"`
 	PrintAdminToken         bool   `envconfig:"PRINT_ADMIN_TOKEN"`
+	Signing                 Signing
+	ChartCache              ChartCache
+	ChartRegistries         ChartRegistries
+	ChartDeployKeys         ChartDeployKeys
+	// Path of a yaml file with the policy that rendered manifests are validated against
+	PolicyPath string `envconfig:"POLICY_PATH"`
+	Secrets    Secrets
+	// Directory of shared CUE packages that CUE environments can import, laid out by import path
+	CuePackagesPath string `envconfig:"CUE_PACKAGES_PATH"`
+	GitopsLayout    GitopsLayout
+}
+
+// GitopsLayout configures how the rendered manifests are written to the gitops repo
+type GitopsLayout struct {
+	// flat, chart, resource or single
+	Files string `envconfig:"GITOPS_LAYOUT"`
+	// Generates a Flux Kustomization for each app in env/flux
+	FluxKustomization bool `envconfig:"GITOPS_FLUX_KUSTOMIZATION"`
+	// Name of the Flux GitRepository of the gitops repo
+	FluxSourceName string `envconfig:"GITOPS_FLUX_SOURCE_NAME"`
+	// Comma separated list of envs that get a Flux HelmRelease instead of the rendered chart, glob patterns like preview-*
+	HelmReleaseEnvs []string `envconfig:"GITOPS_HELM_RELEASE_ENVS"`
+	// chart source host=Flux secret name pairs, comma separated. The secrets hold the credentials of private chart sources
+	SourceSecrets string `envconfig:"GITOPS_FLUX_SOURCE_SECRETS"`
+}
+
+// Secrets configures the SOPS encryption of Kubernetes Secrets in the rendered manifests
+type Secrets struct {
+	// env=age recipient pairs, comma separated. An env can be listed multiple times
+	AgeRecipients KeyMapping `envconfig:"SECRETS_AGE_RECIPIENTS"`
+	// env=armored PGP public key file path pairs, comma separated. An env can be listed multiple times
+	PGPKeyPaths KeyMapping `envconfig:"SECRETS_PGP_KEY_PATHS"`
+	// Comma separated list of envs that refuse to commit Secrets in plain text, glob patterns like production-*
+	ProtectedEnvs []string `envconfig:"SECRETS_PROTECTED_ENVS"`
+}
+
+// ChartDeployKeys configures the SSH access to git based charts
+type ChartDeployKeys struct {
+	// git host=private key path pairs, comma separated
+	DeployKeyPaths string `envconfig:"CHART_DEPLOY_KEY_PATHS"`
+	// known_hosts file that the host keys of chart repos are verified against
+	KnownHostsPath string `envconfig:"CHART_KNOWN_HOSTS_PATH"`
+}
+
+// ChartRegistries configures the access to OCI chart registries
+type ChartRegistries struct {
+	// registry host=username:password pairs, comma separated.
+	// Registries on localhost are accessed over http, all others over https
+	Credentials string `envconfig:"CHART_REGISTRY_CREDENTIALS"`
+	// Helm config home of GimletD, the registry credentials are written here on every start
+	HelmConfigHome string `envconfig:"CHART_REGISTRY_HELM_CONFIG_HOME"`
+}
+
+// ChartCache configures the local cache of Helm charts
+type ChartCache struct {
+	Path string `envconfig:"CHART_CACHE_PATH"`
+	// Size limit of the cache in megabytes, the least recently used charts are evicted above it
+	MaxSizeMB int64 `envconfig:"CHART_CACHE_MAX_SIZE_MB"`
 }
 
 type Database struct {
@@ -66,10 +150,81 @@ type Logging struct {
 }
 
 type Notifications struct {
-	Provider       string `envconfig:"NOTIFICATIONS_PROVIDER"`
-	Token          string `envconfig:"NOTIFICATIONS_TOKEN"`
-	DefaultChannel string `envconfig:"NOTIFICATIONS_DEFAULT_CHANNEL"`
-	ChannelMapping string `envconfig:"NOTIFICATIONS_CHANNEL_MAPPING"`
+	// Comma separated list of notification providers, eg.: slack,webhook
+	Providers      []string `envconfig:"NOTIFICATIONS_PROVIDER"`
+	Token          string   `envconfig:"NOTIFICATIONS_TOKEN"`
+	DefaultChannel string   `envconfig:"NOTIFICATIONS_DEFAULT_CHANNEL"`
+	ChannelMapping string   `envconfig:"NOTIFICATIONS_CHANNEL_MAPPING"`
+	// Path of a yaml file with routing rules that take precedence over the channel mappings
+	RoutingRulesPath string `envconfig:"NOTIFICATIONS_ROUTING_RULES_PATH"`
+	// Directory of <provider>/<type>.tmpl files that override the built-in message templates
+	TemplatesPath string `envconfig:"NOTIFICATIONS_TEMPLATES_PATH"`
+	// How long delivered and failed notifications are kept in the outbox, eg.: 168h
+	OutboxRetention time.Duration `envconfig:"NOTIFICATIONS_OUTBOX_RETENTION"`
+	Webhook         Webhook
+	Teams           Teams
+	Mattermost      Mattermost
+	Email           Email
+}
+
+// Email configures the SMTP notification provider
+type Email struct {
+	SMTPHost     string `envconfig:"NOTIFICATIONS_SMTP_HOST"`
+	SMTPPort     int    `envconfig:"NOTIFICATIONS_SMTP_PORT"`
+	SMTPUsername string `envconfig:"NOTIFICATIONS_SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"NOTIFICATIONS_SMTP_PASSWORD"`
+	From         string `envconfig:"NOTIFICATIONS_SMTP_FROM"`
+	// Comma separated list of the default recipients
+	To []string `envconfig:"NOTIFICATIONS_SMTP_TO"`
+	// env=email address pairs, comma separated
+	RecipientMapping string `envconfig:"NOTIFICATIONS_SMTP_RECIPIENT_MAPPING"`
+	// Digest sends a daily summary instead of an email per event
+	Digest bool `envconfig:"NOTIFICATIONS_SMTP_DIGEST"`
+	// Time of the daily digest in UTC, in HH:MM format
+	DigestTime string `envconfig:"NOTIFICATIONS_SMTP_DIGEST_TIME"`
+}
+
+// Teams configures the Microsoft Teams notification provider
+type Teams struct {
+	WebhookURL string `envconfig:"NOTIFICATIONS_TEAMS_WEBHOOK_URL"`
+	// env=incoming webhook URL pairs, comma separated
+	WebhookMapping string `envconfig:"NOTIFICATIONS_TEAMS_WEBHOOK_MAPPING"`
+}
+
+// Mattermost configures the Mattermost notification provider
+type Mattermost struct {
+	WebhookURL     string `envconfig:"NOTIFICATIONS_MATTERMOST_WEBHOOK_URL"`
+	DefaultChannel string `envconfig:"NOTIFICATIONS_MATTERMOST_DEFAULT_CHANNEL"`
+	ChannelMapping string `envconfig:"NOTIFICATIONS_MATTERMOST_CHANNEL_MAPPING"`
+}
+
+// Webhook configures the generic outgoing webhook notification provider
+type Webhook struct {
+	URL string `envconfig:"NOTIFICATIONS_WEBHOOK_URL"`
+	// Payloads are signed with HMAC-SHA256 using the secret
+	Secret string `envconfig:"NOTIFICATIONS_WEBHOOK_SECRET"`
+	// Failed deliveries are retried from the notification outbox, client errors are not retried
+	MaxRetries int `envconfig:"NOTIFICATIONS_WEBHOOK_MAX_RETRIES"`
+	// Backoff is the wait before the first retry, doubled on every retry, eg.: 10s
+	Backoff time.Duration `envconfig:"NOTIFICATIONS_WEBHOOK_BACKOFF"`
+}
+
+// HasProvider tells if the given notification provider is enabled
+func (n *Notifications) HasProvider(provider string) bool {
+	for _, p := range n.Providers {
+		if strings.TrimSpace(p) == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Signing configures artifact signature verification
+type Signing struct {
+	// owner/repo=base64 ed25519 public key pairs, comma separated. A repository can be listed multiple times
+	Keys KeyMapping `envconfig:"ARTIFACT_SIGNING_KEYS"`
+	// Comma separated list of envs that only accept signed artifacts, glob patterns like production-*
+	RequiredEnvs []string `envconfig:"ARTIFACT_SIGNATURE_REQUIRED_ENVS"`
 }
 
 type Github struct {
@@ -78,6 +233,8 @@ type Github struct {
 	PrivateKey     Multiline `envconfig:"GITHUB_PRIVATE_KEY"`
 	SkipVerify     bool      `envconfig:"GITHUB_SKIP_VERIFY"`
 	Debug          bool      `envconfig:"GITHUB_DEBUG"`
+	// Disables the GitHub Deployments of releases, only commit statuses are sent
+	DisableDeployments bool `envconfig:"GITHUB_DISABLE_DEPLOYMENTS"`
 }
 
 type Multiline string
@@ -91,3 +248,21 @@ func (m *Multiline) Decode(value string) error {
 func (m *Multiline) String() string {
 	return string(*m)
 }
+
+type KeyMapping map[string][]string
+
+func (k *KeyMapping) Decode(value string) error {
+	mapping := KeyMapping{}
+	if value != "" {
+		pairs := strings.Split(value, ",")
+		for _, p := range pairs {
+			keyValue := strings.SplitN(strings.TrimSpace(p), "=", 2) // base64 keys may end with a = padding
+			if len(keyValue) != 2 {
+				return fmt.Errorf("invalid key mapping %s, use the key=value format", p)
+			}
+			mapping[keyValue[0]] = append(mapping[keyValue[0]], keyValue[1])
+		}
+	}
+	*k = mapping
+	return nil
+}
@@ -11,14 +11,17 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/customScm"
 	"github.com/gimlet-io/gimletd/git/customScm/customGithub"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/notifications"
 	"github.com/gimlet-io/gimletd/server"
+	"github.com/gimlet-io/gimletd/server/streaming"
 	"github.com/gimlet-io/gimletd/server/token"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/gimlet-io/gimletd/worker"
@@ -54,6 +57,11 @@ func main() {
 		panic(err)
 	}
 
+	err = store.IndexArtifacts()
+	if err != nil {
+		logrus.Warnf("could not make existing artifacts searchable: %s", err)
+	}
+
 	var tokenManager customScm.NonImpersonatedTokenManager
 	if config.Github.AppID != "" {
 		tokenManager, err = customGithub.NewGithubOrgTokenManager(config)
@@ -64,18 +72,63 @@ func main() {
 		logrus.Warnf("Please set Github Application based access for features like deleted branch detection and commit status pushing")
 	}
 
-	notificationsManager := notifications.NewManager()
-	if config.Notifications.Provider == "slack" {
-		notificationsManager.AddProvider(slackNotificationProvider(config))
+	notificationsManager := notifications.NewManager(store, notificationDeliveries, notificationOutbox)
+	notificationsManager.SetRetention(config.Notifications.OutboxRetention)
+	if config.Notifications.RoutingRulesPath != "" {
+		rules, err := notifications.LoadRoutingRules(config.Notifications.RoutingRulesPath)
+		if err != nil {
+			panic(err)
+		}
+		notificationsManager.SetRoutingRules(rules)
+	}
+	templates, err := notifications.LoadTemplates(config.Notifications.TemplatesPath, store)
+	if err != nil {
+		panic(err)
+	}
+	if config.Notifications.HasProvider("slack") {
+		notificationsManager.AddProvider(slackNotificationProvider(config, store, templates))
+	}
+	if config.Notifications.HasProvider("discord") {
+		notificationsManager.AddProvider(discordNotificationProvider(config, templates))
+	}
+	if config.Notifications.HasProvider("teams") {
+		notificationsManager.AddProvider(teamsNotificationProvider(config))
 	}
-	if config.Notifications.Provider == "discord" {
-		notificationsManager.AddProvider(discordNotificationProvider(config))
+	if config.Notifications.HasProvider("mattermost") {
+		notificationsManager.AddProvider(mattermostNotificationProvider(config))
+	}
+	if config.Notifications.HasProvider("email") {
+		emailProvider := emailNotificationProvider(config, store)
+		notificationsManager.AddProvider(emailProvider)
+		if emailProvider.Digest {
+			go emailProvider.RunDigest()
+		}
+	}
+	if config.Notifications.HasProvider("webhook") {
+		if config.Notifications.Webhook.URL == "" {
+			panic("NOTIFICATIONS_WEBHOOK_URL must be set for the webhook notification provider")
+		}
+		notificationsManager.AddProvider(notifications.NewWebhookProvider(
+			config.Notifications.Webhook.URL,
+			config.Notifications.Webhook.Secret,
+		))
+		notificationsManager.SetDeliveryPolicy("webhook", notifications.DeliveryPolicy{
+			MaxAttempts: config.Notifications.Webhook.MaxRetries + 1,
+			Backoff:     config.Notifications.Webhook.Backoff,
+			MaxBackoff:  30 * time.Minute,
+		})
 	}
 	if tokenManager != nil {
-		notificationsManager.AddProvider(notifications.NewGithubProvider(tokenManager))
+		deploymentStore := store
+		if config.Github.DisableDeployments {
+			deploymentStore = nil
+		}
+		notificationsManager.AddProvider(notifications.NewGithubProvider(tokenManager, deploymentStore, templates))
 	}
 	go notificationsManager.Run()
 
+	eventStream := streaming.NewBroker()
+
 	stopCh := make(chan os.Signal, 1)
 	signal.Notify(stopCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	waitCh := make(chan struct{})
@@ -93,6 +146,49 @@ func main() {
 	go repoCache.Run()
 	logrus.Info("repo cache initialized")
 
+	err = dx.LoginChartRegistries(config.ChartRegistries.HelmConfigHome, chartRegistries(config))
+	if err != nil {
+		panic(err)
+	}
+	dx.SetChartDeployKeys(
+		parseMapping(config.ChartDeployKeys.DeployKeyPaths),
+		config.ChartDeployKeys.KnownHostsPath,
+	)
+	dx.SetCuePackagesPath(config.CuePackagesPath)
+	chartCache, err := dx.NewChartCache(config.ChartCache.Path, config.ChartCache.MaxSizeMB*1024*1024)
+	if err != nil {
+		panic(err)
+	}
+	secretEncryption, err := dx.NewSecretEncryption(
+		config.Secrets.AgeRecipients,
+		config.Secrets.PGPKeyPaths,
+		config.Secrets.ProtectedEnvs,
+	)
+	if err != nil {
+		panic(err)
+	}
+	gitopsLayout, err := dx.NewGitopsLayout(
+		config.GitopsLayout.Files,
+		config.GitopsLayout.FluxKustomization,
+		config.GitopsLayout.FluxSourceName,
+		config.GitopsLayout.HelmReleaseEnvs,
+		parseMapping(config.GitopsLayout.SourceSecrets),
+	)
+	if err != nil {
+		panic(err)
+	}
+	err = worker.ValidateSignatureRequiredEnvs(config.Signing.RequiredEnvs)
+	if err != nil {
+		panic(err)
+	}
+	var policy *dx.Policy
+	if config.PolicyPath != "" {
+		policy, err = dx.LoadPolicy(config.PolicyPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	if config.GitopsRepo != "" &&
 		config.GitopsRepoDeployKeyPath != "" {
 		gitopsWorker := worker.NewGitopsWorker(
@@ -103,6 +199,14 @@ func main() {
 			notificationsManager,
 			eventsProcessed,
 			repoCache,
+			eventStream,
+			&worker.RenderConfig{
+				SignatureRequiredEnvs: config.Signing.RequiredEnvs,
+				ChartCache:            chartCache,
+				Policy:                policy,
+				SecretEncryption:      secretEncryption,
+				GitopsLayout:          gitopsLayout,
+			},
 		)
 		go gitopsWorker.Run()
 		logrus.Info("Gitops worker started")
@@ -137,7 +241,7 @@ func main() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
-	r := server.SetupRouter(config, store, notificationsManager, repoCache, perf)
+	r := server.SetupRouter(config, store, notificationsManager, repoCache, perf, eventStream)
 	go func() {
 		err = http.ListenAndServe(":8888", r)
 		if err != nil {
@@ -149,36 +253,103 @@ func main() {
 	logrus.Info("Successfully cleaned up resources. Stopping.")
 }
 
-func slackNotificationProvider(config *config.Config) *notifications.SlackProvider {
+func slackNotificationProvider(config *config.Config, store *store.Store, templates *notifications.Templates) *notifications.SlackProvider {
 	slackChannelMap := parseChannelMap(config)
 
 	return &notifications.SlackProvider{
 		Token:          config.Notifications.Token,
 		ChannelMapping: slackChannelMap,
 		DefaultChannel: config.Notifications.DefaultChannel,
+		Store:          store,
+		Templates:      templates,
 	}
 }
 
-func discordNotificationProvider(config *config.Config) *notifications.DiscordProvider {
+func discordNotificationProvider(config *config.Config, templates *notifications.Templates) *notifications.DiscordProvider {
 	discordChannelMapping := parseChannelMap(config)
 
 	return &notifications.DiscordProvider{
 		Token:          config.Notifications.Token,
 		ChannelMapping: discordChannelMapping,
 		ChannelID:      config.Notifications.DefaultChannel,
+		Templates:      templates,
+	}
+}
+
+func teamsNotificationProvider(config *config.Config) *notifications.TeamsProvider {
+	if config.Notifications.Teams.WebhookURL == "" && config.Notifications.Teams.WebhookMapping == "" {
+		panic("NOTIFICATIONS_TEAMS_WEBHOOK_URL or NOTIFICATIONS_TEAMS_WEBHOOK_MAPPING must be set for the Teams notification provider")
+	}
+	return &notifications.TeamsProvider{
+		DefaultWebhookURL: config.Notifications.Teams.WebhookURL,
+		WebhookMapping:    parseMapping(config.Notifications.Teams.WebhookMapping),
 	}
 }
 
+func mattermostNotificationProvider(config *config.Config) *notifications.MattermostProvider {
+	if config.Notifications.Mattermost.WebhookURL == "" {
+		panic("NOTIFICATIONS_MATTERMOST_WEBHOOK_URL must be set for the Mattermost notification provider")
+	}
+	return &notifications.MattermostProvider{
+		WebhookURL:     config.Notifications.Mattermost.WebhookURL,
+		DefaultChannel: config.Notifications.Mattermost.DefaultChannel,
+		ChannelMapping: parseMapping(config.Notifications.Mattermost.ChannelMapping),
+	}
+}
+
+func emailNotificationProvider(config *config.Config, store *store.Store) *notifications.EmailProvider {
+	if config.Notifications.Email.SMTPHost == "" {
+		panic("NOTIFICATIONS_SMTP_HOST must be set for the email notification provider")
+	}
+	return &notifications.EmailProvider{
+		Host:             config.Notifications.Email.SMTPHost,
+		Port:             config.Notifications.Email.SMTPPort,
+		Username:         config.Notifications.Email.SMTPUsername,
+		Password:         config.Notifications.Email.SMTPPassword,
+		From:             config.Notifications.Email.From,
+		To:               config.Notifications.Email.To,
+		RecipientMapping: parseMapping(config.Notifications.Email.RecipientMapping),
+		Digest:           config.Notifications.Email.Digest,
+		DigestTime:       config.Notifications.Email.DigestTime,
+		Store:            store,
+	}
+}
+
+func chartRegistries(config *config.Config) map[string]dx.ChartRegistry {
+	registries := map[string]dx.ChartRegistry{}
+	for host, credentials := range parseMapping(config.ChartRegistries.Credentials) {
+		usernamePassword := strings.SplitN(credentials, ":", 2)
+		if len(usernamePassword) != 2 {
+			logrus.Warnf("invalid credentials for chart registry %s, use the host=username:password format", host)
+			continue
+		}
+		registries[host] = dx.ChartRegistry{
+			Username: usernamePassword[0],
+			Password: usernamePassword[1],
+		}
+	}
+	return registries
+}
+
 func parseChannelMap(config *config.Config) map[string]string {
-	channelMap := map[string]string{}
-	if config.Notifications.ChannelMapping != "" {
-		pairs := strings.Split(config.Notifications.ChannelMapping, ",")
+	return parseMapping(config.Notifications.ChannelMapping)
+}
+
+// parseMapping parses comma separated key=value pairs. Values may contain = signs, like webhook URLs do
+func parseMapping(mapping string) map[string]string {
+	parsed := map[string]string{}
+	if mapping != "" {
+		pairs := strings.Split(mapping, ",")
 		for _, p := range pairs {
-			keyValue := strings.Split(p, "=")
-			channelMap[keyValue[0]] = keyValue[1]
+			keyValue := strings.SplitN(p, "=", 2)
+			if len(keyValue) != 2 {
+				logrus.Warnf("invalid mapping %s, use the key=value format", p)
+				continue
+			}
+			parsed[keyValue[0]] = keyValue[1]
 		}
 	}
-	return channelMap
+	return parsed
 }
 
 // helper function configures the logging.
@@ -16,6 +16,16 @@ var (
 		Help: "Release status",
 	}, []string{"env", "app", "sourceCommit", "commitMessage", "gitopsCommit", "gitopsCommitCreated"})
 
+	notificationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gimletd_notification_deliveries_total",
+		Help: "The total number of notification delivery attempts by outcome",
+	}, []string{"provider", "status"})
+
+	notificationOutbox = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gimletd_notification_outbox",
+		Help: "The number of pending and failed notifications in the outbox",
+	}, []string{"status"})
+
 	perf = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "gimletd_perf",
 		Help: "Performance of functions",
@@ -1,6 +1,7 @@
 package dx
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"gopkg.in/yaml.v3"
@@ -41,8 +42,17 @@ type Artifact struct {
 	// The complete set of Gimlet environments from the Gimlet environment files
 	CueEnvironments []string `json:"cueEnvironments,omitempty"`
 
+	// Gimlet environments in Jsonnet, evaluated with the artifact vars as ext vars
+	JsonnetEnvironments []string `json:"jsonnetEnvironments,omitempty"`
+
 	// CI job information, test results, Docker image information, etc
 	Items []map[string]interface{} `json:"items,omitempty"`
+
+	// Signature verification result, set by GimletD on push
+	Provenance *Provenance `json:"provenance,omitempty"`
+
+	// Where the artifact has been deployed, populated by GimletD on request
+	Deployments []*Deployment `json:"deployments,omitempty"`
 }
 
 func (a *Artifact) HasCleanupPolicy() bool {
@@ -80,7 +90,26 @@ func (a *Artifact) CueEnvironmentsToManifests() ([]*Manifest, error) {
 		}
 		for _, manifestString := range manifestStrings {
 			var m Manifest
-			yaml.Unmarshal([]byte(manifestString), &m)
+			err = yaml.Unmarshal([]byte(manifestString), &m)
+			if err != nil {
+				return manifests, fmt.Errorf("cannot parse manifest %s", err.Error())
+			}
+			manifests = append(manifests, &m)
+		}
+	}
+	return manifests, nil
+}
+
+func (a *Artifact) JsonnetEnvironmentsToManifests() ([]*Manifest, error) {
+	var manifests []*Manifest
+	for _, jsonnetManifest := range a.JsonnetEnvironments {
+		manifestStrings, err := RenderJsonnetToManifests(jsonnetManifest, a.Vars())
+		if err != nil {
+			return manifests, fmt.Errorf("cannot render jsonnet file %s", err.Error())
+		}
+		for _, manifestString := range manifestStrings {
+			var m Manifest
+			err = json.Unmarshal([]byte(manifestString), &m)
 			if err != nil {
 				return manifests, fmt.Errorf("cannot parse manifest %s", err.Error())
 			}
@@ -66,3 +66,42 @@ configs: [ for instance in _instances {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(manifests))
 }
+
+func Test_jsonnetEnvironmentsToManifests(t *testing.T) {
+	const jsonnetTemplate = `
+local app(instance) = {
+  app: 'myapp-' + instance,
+  env: 'production',
+  namespace: 'production',
+  chart: {
+    repository: 'https://chart.onechart.dev',
+    name: 'cron-job',
+    version: '0.32.0',
+  },
+  values: {
+    image: {
+      repository: '<account>.dkr.ecr.eu-west-1.amazonaws.com/myapp',
+      tag: std.extVar('GITHUB_SHA'),
+    },
+  },
+};
+
+{
+  configs: [app(instance) for instance in ['first', 'second']],
+}
+`
+
+	artifact := &Artifact{
+		Context: map[string]string{
+			"GITHUB_SHA": "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+		},
+		JsonnetEnvironments: []string{jsonnetTemplate},
+	}
+
+	manifests, err := artifact.JsonnetEnvironmentsToManifests()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(manifests))
+	assert.Equal(t, "myapp-second", manifests[1].App)
+	assert.Equal(t, "0.32.0", manifests[1].Chart.Version)
+	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", manifests[0].Values["image"].(map[string]interface{})["tag"])
+}
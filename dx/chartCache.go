@@ -0,0 +1,269 @@
+package dx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	giturl "github.com/whilp/git-urls"
+)
+
+// ChartCache is a local cache of chart archives and git chart checkouts.
+// Entries are addressed by the hash of the chart repo, name and version, or the git url and sha,
+// so only immutable chart references are cached. The least recently used entries are evicted above MaxSize
+type ChartCache struct {
+	Path string
+	// MaxSize is the size limit of the cache in bytes
+	MaxSize int64
+
+	// lock serializes the lookups, the moves into place and the evictions of entries
+	lock sync.Mutex
+	// entryLocks make concurrent fetches of the same entry wait for each other, fetches of different entries run in parallel
+	entryLocks     map[string]*entryLock
+	entryLocksLock sync.Mutex
+}
+
+type entryLock struct {
+	sync.Mutex
+	waiters int
+}
+
+type chartCacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+func NewChartCache(path string, maxSize int64) (*ChartCache, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create chart cache: %s", err)
+	}
+
+	return &ChartCache{
+		Path:       path,
+		MaxSize:    maxSize,
+		entryLocks: map[string]*entryLock{},
+	}, nil
+}
+
+// Locate returns the local path of the manifest's chart, fetching it on a cache miss.
+// It returns an empty string for charts that can't be cached, like the ones without an exact version
+func (c *ChartCache) Locate(m *Manifest, token string) (string, error) {
+	if IsGitChart(m.Chart.Name) {
+		return c.gitChart(m, token)
+	}
+	return c.repoChart(m)
+}
+
+func (c *ChartCache) repoChart(m *Manifest) (string, error) {
+	if m.Chart.Repository == "" && !isOCI(m.Chart.Name) {
+		return "", nil
+	}
+	if _, err := semver.NewVersion(m.Chart.Version); err != nil {
+		// version ranges and the latest version may resolve to a different chart any time
+		return "", nil
+	}
+
+	entryPath := c.entryPath(m.Chart.Repository, m.Chart.Name, m.Chart.Version)
+	unlock := c.lockEntry(entryPath)
+	defer unlock()
+
+	if c.cached(entryPath) {
+		if archives, _ := filepath.Glob(filepath.Join(entryPath, "*.tgz")); len(archives) == 1 {
+			return archives[0], nil
+		}
+	}
+
+	archive, err := locateChart(m)
+	if err != nil {
+		return "", err
+	}
+
+	tmpEntryPath, err := ioutil.TempDir(c.Path, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create chart cache entry: %s", err)
+	}
+	defer os.RemoveAll(tmpEntryPath)
+
+	content, err := ioutil.ReadFile(archive)
+	if err != nil {
+		return "", fmt.Errorf("cannot read chart archive: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tmpEntryPath, filepath.Base(archive)), content, 0644)
+	if err != nil {
+		return "", fmt.Errorf("cannot write chart cache entry: %s", err)
+	}
+
+	err = c.add(tmpEntryPath, entryPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(entryPath, filepath.Base(archive)), nil
+}
+
+func (c *ChartCache) gitChart(m *Manifest, token string) (string, error) {
+	gitAddress, err := giturl.Parse(m.Chart.Name)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse chart's git address: %s", err)
+	}
+	params, _ := url.ParseQuery(gitAddress.RawQuery)
+	sha := params.Get("sha")
+	if sha == "" {
+		// branches and tags may move
+		return "", nil
+	}
+	gitUrl := strings.ReplaceAll(m.Chart.Name, gitAddress.RawQuery, "")
+	gitUrl = strings.ReplaceAll(gitUrl, "?", "")
+
+	entryPath := c.entryPath(gitUrl, sha)
+	unlock := c.lockEntry(entryPath)
+	defer unlock()
+
+	if c.cached(entryPath) {
+		return entryPath + params.Get("path"), nil
+	}
+
+	tmpEntryPath, err := ioutil.TempDir(c.Path, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create chart cache entry: %s", err)
+	}
+	defer os.RemoveAll(tmpEntryPath)
+
+	_, err = cloneChart(m, token, tmpEntryPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.add(tmpEntryPath, entryPath)
+	if err != nil {
+		return "", err
+	}
+	return entryPath + params.Get("path"), nil
+}
+
+// lockEntry locks the entry for fetching, and returns the function that unlocks it
+func (c *ChartCache) lockEntry(entryPath string) func() {
+	c.entryLocksLock.Lock()
+	lock, ok := c.entryLocks[entryPath]
+	if !ok {
+		lock = &entryLock{}
+		c.entryLocks[entryPath] = lock
+	}
+	lock.waiters++
+	c.entryLocksLock.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		c.entryLocksLock.Lock()
+		defer c.entryLocksLock.Unlock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(c.entryLocks, entryPath)
+		}
+	}
+}
+
+// cached tells if the entry is in the cache, and marks it as recently used
+func (c *ChartCache) cached(entryPath string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := os.Stat(entryPath); err != nil {
+		return false
+	}
+	c.touch(entryPath)
+	return true
+}
+
+// add moves the fetched chart in place, then evicts the least recently used entries above the size limit
+func (c *ChartCache) add(tmpEntryPath string, entryPath string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := os.Rename(tmpEntryPath, entryPath)
+	if err != nil {
+		return fmt.Errorf("cannot write chart cache entry: %s", err)
+	}
+	c.touch(entryPath)
+
+	return c.evict(entryPath)
+}
+
+func (c *ChartCache) evict(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(c.Path)
+	if err != nil {
+		return fmt.Errorf("cannot list chart cache: %s", err)
+	}
+
+	var entries []chartCacheEntry
+	var total int64
+	for _, f := range files {
+		if !f.IsDir() || strings.HasPrefix(f.Name(), ".tmp-") {
+			continue
+		}
+		entryPath := filepath.Join(c.Path, f.Name())
+		size := dirSize(entryPath)
+		total += size
+		entries = append(entries, chartCacheEntry{
+			path:     entryPath,
+			size:     size,
+			lastUsed: f.ModTime(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+	for _, entry := range entries {
+		if total <= c.MaxSize {
+			break
+		}
+		if entry.path == keep {
+			continue
+		}
+		err := os.RemoveAll(entry.path)
+		if err != nil {
+			return fmt.Errorf("cannot evict chart cache entry: %s", err)
+		}
+		total -= entry.size
+	}
+	return nil
+}
+
+func (c *ChartCache) entryPath(keyParts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(keyParts, "\n")))
+	return filepath.Join(c.Path, hex.EncodeToString(hash[:]))
+}
+
+// touch marks the entry as recently used
+func (c *ChartCache) touch(entryPath string) {
+	now := time.Now()
+	os.Chtimes(entryPath, now, now)
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,149 @@
+package dx
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func Test_chartCacheRepoChart(t *testing.T) {
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	chartDir := t.TempDir()
+	chartPath, _ := chartutil.Create("my-chart", chartDir)
+	_, err := chartutil.Save(mustLoadChart(t, chartPath), chartDir)
+	assert.Nil(t, err)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.FileServer(http.Dir(chartDir)).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	index, err := repo.IndexDirectory(chartDir, server.URL)
+	assert.Nil(t, err)
+	index.WriteFile(filepath.Join(chartDir, "index.yaml"), 0644)
+
+	cache, err := NewChartCache(t.TempDir(), 0)
+	assert.Nil(t, err)
+
+	m := &Manifest{Chart: Chart{Repository: server.URL, Name: "my-chart", Version: "0.1.0"}}
+	located, err := cache.Locate(m, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "my-chart-0.1.0.tgz", filepath.Base(located))
+	assert.Positive(t, requests)
+
+	server.Close()
+	located2, err := cache.Locate(m, "")
+	assert.Nil(t, err, "should locate cached charts when the repo is unreachable")
+	assert.Equal(t, located, located2)
+
+	located, err = cache.Locate(&Manifest{Chart: Chart{Repository: server.URL, Name: "my-chart", Version: "~0.1.0"}}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "", located, "should not cache version ranges")
+}
+
+func Test_chartCacheGitChart(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "charts.git")
+	gitRepo, _ := git.PlainInit(repoPath, false)
+	os.MkdirAll(filepath.Join(repoPath, "my-chart"), 0755)
+	ioutil.WriteFile(filepath.Join(repoPath, "my-chart", "Chart.yaml"), []byte("name: my-chart\n"), 0644)
+	worktree, _ := gitRepo.Worktree()
+	worktree.Add("my-chart/Chart.yaml")
+	sha, err := worktree.Commit("chart", &git.CommitOptions{
+		Author: &object.Signature{Name: "gimlet", Email: "gimlet@example.com", When: time.Now()},
+	})
+	assert.Nil(t, err)
+
+	cache, err := NewChartCache(t.TempDir(), 0)
+	assert.Nil(t, err)
+
+	m := &Manifest{Chart: Chart{Name: "file://" + repoPath + "?sha=" + sha.String() + "&path=/my-chart"}}
+	located, err := cache.Locate(m, "")
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(located, "Chart.yaml"))
+
+	os.RemoveAll(repoPath)
+	located2, err := cache.Locate(m, "")
+	assert.Nil(t, err, "should not clone the same sha again")
+	assert.Equal(t, located, located2)
+
+	located, err = cache.Locate(&Manifest{Chart: Chart{Name: "file://" + repoPath + "?branch=main"}}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "", located, "should not cache branches")
+}
+
+func Test_chartCacheEviction(t *testing.T) {
+	cache, err := NewChartCache(t.TempDir(), 150)
+	assert.Nil(t, err)
+
+	var entries []string
+	for _, key := range []string{"first", "second", "third"} {
+		tmpEntryPath, _ := ioutil.TempDir(cache.Path, ".tmp-")
+		ioutil.WriteFile(filepath.Join(tmpEntryPath, "chart.tgz"), make([]byte, 60), 0644)
+		entryPath := cache.entryPath(key)
+		assert.Nil(t, cache.add(tmpEntryPath, entryPath))
+		entries = append(entries, entryPath)
+
+		// mtime resolution may be coarse
+		past := time.Now().Add(-time.Duration(10-len(entries)) * time.Minute)
+		os.Chtimes(entryPath, past, past)
+	}
+	assert.NoDirExists(t, entries[0], "should evict the least recently used entry")
+	assert.DirExists(t, entries[1])
+	assert.DirExists(t, entries[2])
+}
+
+func Test_chartCacheEntryLocks(t *testing.T) {
+	cache, err := NewChartCache(t.TempDir(), 0)
+	assert.Nil(t, err)
+
+	unlock := cache.lockEntry("first")
+
+	otherEntry := make(chan bool)
+	go func() {
+		cache.lockEntry("second")()
+		otherEntry <- true
+	}()
+	select {
+	case <-otherEntry:
+	case <-time.After(time.Second):
+		t.Fatal("should fetch other entries in parallel")
+	}
+
+	sameEntry := make(chan bool)
+	go func() {
+		cache.lockEntry("first")()
+		sameEntry <- true
+	}()
+	select {
+	case <-sameEntry:
+		t.Fatal("should wait for the fetch of the same entry")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	<-sameEntry
+	assert.Equal(t, 0, len(cache.entryLocks), "should release the locks of idle entries")
+}
+
+func mustLoadChart(t *testing.T, path string) *chart.Chart {
+	c, err := loader.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
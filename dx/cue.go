@@ -1,21 +1,60 @@
 package dx
 
 import (
+	_ "embed"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/load"
 	cueyaml "cuelang.org/go/encoding/yaml"
 )
 
+//go:embed cue/manifest.cue
+var manifestSchema string // the #Manifest definition that every config is unified with
+
+// manifestPackage is the import path of the manifest schema in CUE environments
+const manifestPackage = "gimlet.io/manifest"
+
+// cuePackagesPath is a directory of shared CUE packages, laid out by import path
+var cuePackagesPath string
+
+// SetCuePackagesPath configures the directory of shared CUE packages that CUE environments can import,
+// eg.: <path>/example.com/defaults/defaults.cue is imported as "example.com/defaults"
+func SetCuePackagesPath(path string) {
+	cuePackagesPath = path
+}
+
+// RenderCueToManifests evaluates the CUE file into Gimlet manifests, it gives up after the evaluation timeout
 func RenderCueToManifests(fileContent string) ([]string, error) {
+	return evaluateWithTimeout(func() ([]string, error) {
+		return renderCueToManifests(fileContent)
+	})
+}
+
+func renderCueToManifests(fileContent string) ([]string, error) {
+	moduleDir, err := cueModule(fileContent)
+	if err != nil {
+		return []string{}, fmt.Errorf("cannot load cue file: %s", err)
+	}
+	defer os.RemoveAll(moduleDir)
+	errorConfig := &errors.Config{Cwd: moduleDir}
+
 	c := cuecontext.New()
-	v := c.CompileString(fileContent)
+	instances := load.Instances([]string{"./environments.cue"}, &load.Config{Dir: moduleDir})
+	if instances[0].Err != nil {
+		return []string{}, fmt.Errorf("cannot load cue file: %s", errors.Details(instances[0].Err, errorConfig))
+	}
+	v := c.BuildInstance(instances[0])
 
-	err := v.Validate()
+	err = v.Validate()
 	if err != nil {
-		msg := errors.Details(err, nil)
+		msg := errors.Details(err, errorConfig)
 		return []string{}, fmt.Errorf("cannot parse cue file: %s", msg)
 	}
 
@@ -24,11 +63,22 @@ func RenderCueToManifests(fileContent string) ([]string, error) {
 		return []string{}, fmt.Errorf("cue files should have a `configs` field that holds an array of Gimlet manfiests")
 	}
 
+	schema := c.CompileString(manifestSchema, cue.Filename(manifestPackage+"/manifest.cue")).LookupPath(cue.ParsePath("#Manifest"))
+
 	var manifests []string
 
-	iter, _ := configs.List()
+	iter, err := configs.List()
+	if err != nil {
+		return []string{}, fmt.Errorf("`configs` should be an array of Gimlet manifests: %s", errors.Details(err, errorConfig))
+	}
 	for iter.Next() {
-		m, err := cueyaml.Encode(iter.Value())
+		manifest := iter.Value().Unify(schema)
+		err := manifest.Validate(cue.Concrete(true))
+		if err != nil {
+			return []string{}, fmt.Errorf("invalid manifest: %s", errors.Details(err, errorConfig))
+		}
+
+		m, err := cueyaml.Encode(manifest)
 		if err != nil {
 			return []string{}, err
 		}
@@ -37,3 +87,62 @@ func RenderCueToManifests(fileContent string) ([]string, error) {
 
 	return manifests, nil
 }
+
+// cueModule writes the cue file into a CUE module with the manifest schema and the shared packages
+func cueModule(fileContent string) (string, error) {
+	moduleDir, err := ioutil.TempDir("", "gimlet-cue")
+	if err != nil {
+		return "", err
+	}
+
+	files := map[string]string{
+		"cue.mod/module.cue": `module: "gimlet.io/environments"` + "\n",
+		"environments.cue":   fileContent,
+		filepath.Join("cue.mod/pkg", manifestPackage, "manifest.cue"): manifestSchema,
+	}
+	for path, content := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(moduleDir, path)), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(moduleDir, path), []byte(content), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(moduleDir)
+			return "", err
+		}
+	}
+
+	if cuePackagesPath != "" {
+		err = copyCuePackages(cuePackagesPath, filepath.Join(moduleDir, "cue.mod", "pkg"))
+		if err != nil {
+			os.RemoveAll(moduleDir)
+			return "", fmt.Errorf("cannot copy shared packages: %s", err)
+		}
+	}
+
+	return moduleDir, nil
+}
+
+func copyCuePackages(from string, to string) error {
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".cue") {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(filepath.Join(to, relativePath)), 0755)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(to, relativePath), content, 0644)
+	})
+}
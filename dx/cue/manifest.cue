@@ -0,0 +1,51 @@
+// Package manifest is the schema of Gimlet manifests.
+// GimletD unifies every item of the `configs` list with #Manifest,
+// CUE environments can also import it as "gimlet.io/manifest"
+package manifest
+
+#Manifest: {
+	app:        string & !=""
+	env:        string & !=""
+	namespace?: string
+	deploy?:    #Deploy
+	cleanup?:   #Cleanup
+	chart?:     #Chart
+	values?: {...}
+	strategicMergePatches?: string
+	json6902Patches?: [...#Json6902Patch]
+	manifests?: string
+	kustomize?: #Kustomize
+}
+
+#Chart: {
+	repository?: string
+	name:        string & !=""
+	version?:    string | number
+}
+
+#Deploy: {
+	tag?:    string
+	branch?: string
+	event?:  "push" | "tag" | "pr"
+}
+
+#Cleanup: {
+	app:     string & !=""
+	event:   "branchDeleted"
+	branch?: string
+}
+
+#Json6902Patch: {
+	patch: string
+	target: {
+		group?:   string
+		version?: string
+		kind?:    string
+		name?:    string
+	}
+}
+
+#Kustomize: {
+	repository?: string
+	path:        string
+}
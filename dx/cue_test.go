@@ -1,7 +1,11 @@
 package dx
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,3 +41,91 @@ func Test_cueRender(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(manifests))
 }
+
+func Test_cueRenderValidatesManifests(t *testing.T) {
+	_, err := RenderCueToManifests(`
+configs: [{
+  app: "myapp"
+  env: "production"
+  chart: {
+    name: "onechart"
+    verison: "0.32.0"
+  }
+}]
+`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "configs.0.chart: field not allowed: verison")
+
+	_, err = RenderCueToManifests(`
+configs: [{
+  app: "myapp"
+  env: "production"
+  deploy: event: "merge"
+}]
+`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `configs.0.deploy.event: conflicting values "push" and "merge"`)
+
+	_, err = RenderCueToManifests(`
+configs: [{
+  app: "myapp"
+}]
+`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "configs.0.env: incomplete value")
+}
+
+func Test_cueRenderImportsSharedPackages(t *testing.T) {
+	packagesPath := t.TempDir()
+	defer SetCuePackagesPath("")
+	SetCuePackagesPath(packagesPath)
+
+	os.MkdirAll(filepath.Join(packagesPath, "example.com", "defaults"), 0755)
+	ioutil.WriteFile(filepath.Join(packagesPath, "example.com", "defaults", "defaults.cue"), []byte(`
+package defaults
+
+import "gimlet.io/manifest"
+
+#App: manifest.#Manifest & {
+  namespace: *"default" | string
+  chart: {
+    repository: "https://chart.onechart.dev"
+    name:       "onechart"
+    version:    "0.32.0"
+  }
+}
+`), 0644)
+
+	manifests, err := RenderCueToManifests(`
+import "example.com/defaults"
+
+configs: [
+  defaults.#App & {
+    app: "myapp"
+    env: "staging"
+  },
+]
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(manifests))
+	assert.Contains(t, manifests[0], "namespace: default")
+	assert.Contains(t, manifests[0], "name: onechart")
+}
+
+func Test_cueRenderTimeout(t *testing.T) {
+	defer func(timeout time.Duration, slots chan struct{}) {
+		evaluationTimeout = timeout
+		evaluationSlots = slots
+	}(evaluationTimeout, evaluationSlots)
+	evaluationTimeout = 10 * time.Millisecond
+	evaluationSlots = make(chan struct{}, 1) // the abandoned evaluation keeps its slot
+
+	_, err := RenderCueToManifests(`
+import "list"
+
+_numbers: [ for x in list.Range(0, 10000000, 1) {x} ]
+configs: []
+`)
+	assert.NotNil(t, err, "should give up on long evaluations")
+	assert.Contains(t, err.Error(), "timed out")
+}
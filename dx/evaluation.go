@@ -0,0 +1,53 @@
+package dx
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// evaluationTimeout limits how long the CUE and Jsonnet environments of an artifact may evaluate
+var evaluationTimeout = 30 * time.Second
+
+// evaluationSlots bounds the number of evaluations that run at a time, abandoned evaluations included
+var evaluationSlots = make(chan struct{}, runtime.NumCPU())
+
+type evaluationResult struct {
+	manifests []string
+	err       error
+}
+
+// evaluateWithTimeout runs the evaluation in a goroutine, and gives up on it after the evaluation timeout.
+// The CUE and Jsonnet evaluators can't be cancelled, an abandoned evaluation runs to its end in the background
+// and keeps its evaluation slot until then, so runaway evaluations can't pile up
+func evaluateWithTimeout(evaluate func() ([]string, error)) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), evaluationTimeout)
+	defer cancel()
+
+	slots := evaluationSlots
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return []string{}, fmt.Errorf("no free evaluation slot in %s, too many evaluations are running", evaluationTimeout)
+	}
+
+	done := make(chan evaluationResult, 1)
+	go func() {
+		defer func() { <-slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- evaluationResult{manifests: []string{}, err: fmt.Errorf("evaluation failed: %v", r)}
+			}
+		}()
+		manifests, err := evaluate()
+		done <- evaluationResult{manifests: manifests, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.manifests, result.err
+	case <-ctx.Done():
+		return []string{}, fmt.Errorf("evaluation timed out after %s", evaluationTimeout)
+	}
+}
@@ -0,0 +1,42 @@
+package dx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_evaluateWithTimeoutSlots(t *testing.T) {
+	defer func(timeout time.Duration, slots chan struct{}) {
+		evaluationTimeout = timeout
+		evaluationSlots = slots
+	}(evaluationTimeout, evaluationSlots)
+	evaluationTimeout = 10 * time.Millisecond
+	evaluationSlots = make(chan struct{}, 1)
+
+	runaway := make(chan bool)
+	finished := make(chan bool)
+	_, err := evaluateWithTimeout(func() ([]string, error) {
+		<-runaway
+		defer close(finished)
+		return []string{}, nil
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+
+	_, err = evaluateWithTimeout(func() ([]string, error) {
+		return []string{"manifest"}, nil
+	})
+	assert.NotNil(t, err, "the abandoned evaluation should keep its slot")
+	assert.Contains(t, err.Error(), "no free evaluation slot")
+
+	close(runaway)
+	<-finished
+	evaluationTimeout = time.Second
+	manifests, err := evaluateWithTimeout(func() ([]string, error) {
+		return []string{"manifest"}, nil
+	})
+	assert.Nil(t, err, "should free the slot once the abandoned evaluation finishes")
+	assert.Equal(t, []string{"manifest"}, manifests)
+}
@@ -0,0 +1,64 @@
+package dx
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// chartDeployKeys are the private key paths by git host that SSH chart urls are cloned with
+var chartDeployKeys = map[string]string{}
+
+// chartKnownHostsPath is the known_hosts file that the host keys of chart repos are verified against.
+// The SSH_KNOWN_HOSTS env var and ~/.ssh/known_hosts are used if empty
+var chartKnownHostsPath string
+
+// SetChartDeployKeys configures the deploy keys of git hosts, and the known_hosts file of SSH chart repos
+func SetChartDeployKeys(deployKeyPaths map[string]string, knownHostsPath string) {
+	chartDeployKeys = deployKeyPaths
+	chartKnownHostsPath = knownHostsPath
+}
+
+// IsGitChart tells if the chart is referenced by a git url
+func IsGitChart(chartName string) bool {
+	return isSSHChart(chartName) ||
+		strings.Contains(chartName, ".git") // for https:// git urls
+}
+
+func isSSHChart(chartName string) bool {
+	return strings.HasPrefix(chartName, "git@") ||
+		strings.HasPrefix(chartName, "ssh://")
+}
+
+// sshChartAuth returns the SSH credentials of the chart's git host, with host key verification
+func sshChartAuth(gitAddress *url.URL) (*ssh.PublicKeys, error) {
+	deployKeyPath, ok := chartDeployKeys[gitAddress.Host]
+	if !ok {
+		deployKeyPath, ok = chartDeployKeys[gitAddress.Hostname()]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no deploy key is configured for %s", gitAddress.Hostname())
+	}
+
+	user := "git"
+	if gitAddress.User != nil && gitAddress.User.Username() != "" {
+		user = gitAddress.User.Username()
+	}
+	publicKeys, err := ssh.NewPublicKeysFromFile(user, deployKeyPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate public key from private: %s", err.Error())
+	}
+
+	var knownHostsFiles []string
+	if chartKnownHostsPath != "" {
+		knownHostsFiles = append(knownHostsFiles, chartKnownHostsPath)
+	}
+	publicKeys.HostKeyCallback, err = ssh.NewKnownHostsCallback(knownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read known hosts: %s", err)
+	}
+
+	return publicKeys, nil
+}
@@ -0,0 +1,156 @@
+package dx
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func Test_IsGitChart(t *testing.T) {
+	assert.True(t, IsGitChart("git@github.com:gimlet-io/onechart.git?path=/charts/onechart/"))
+	assert.True(t, IsGitChart("ssh://git@example.com:2222/gimlet-io/onechart?sha=abc"))
+	assert.True(t, IsGitChart("https://github.com/gimlet-io/onechart.git?branch=master"))
+	assert.False(t, IsGitChart("onechart"))
+	assert.False(t, IsGitChart("oci://ghcr.io/gimlet-io/onechart"))
+}
+
+func Test_sshChartClone(t *testing.T) {
+	dir := t.TempDir()
+	defer SetChartDeployKeys(map[string]string{}, "")
+
+	repoPath := filepath.Join(dir, "charts.git")
+	gitRepo, _ := git.PlainInit(repoPath, false)
+	os.MkdirAll(filepath.Join(repoPath, "my-chart"), 0755)
+	ioutil.WriteFile(filepath.Join(repoPath, "my-chart", "Chart.yaml"), []byte("name: my-chart\n"), 0644)
+	worktree, _ := gitRepo.Worktree()
+	worktree.Add("my-chart/Chart.yaml")
+	_, err := worktree.Commit("chart", &git.CommitOptions{
+		Author: &object.Signature{Name: "gimlet", Email: "gimlet@example.com", When: time.Now()},
+	})
+	assert.Nil(t, err)
+
+	deployKey, deployKeyPath := sshKey(t, dir, "deploy-key")
+	hostKey, _ := sshKey(t, dir, "host-key")
+	addr := sshGitServer(t, hostKey, deployKey.PublicKey())
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	ioutil.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{addr}, hostKey.PublicKey())+"\n"), 0644)
+
+	m := &Manifest{Chart: Chart{Name: "ssh://git@" + addr + repoPath + "?path=/my-chart"}}
+
+	_, err = CloneChartFromRepo(m, "")
+	assert.NotNil(t, err, "should not clone without a deploy key")
+
+	SetChartDeployKeys(map[string]string{addr: deployKeyPath}, knownHostsPath)
+	chartPath, err := CloneChartFromRepo(m, "")
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(chartPath, "Chart.yaml"))
+
+	otherHostKey, _ := sshKey(t, dir, "other-host-key")
+	ioutil.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{addr}, otherHostKey.PublicKey())+"\n"), 0644)
+	_, err = CloneChartFromRepo(m, "")
+	assert.NotNil(t, err, "should verify the host key")
+}
+
+// sshKey generates an ed25519 key, and writes it to a file
+func sshKey(t *testing.T, dir string, name string) (gossh.Signer, string) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	keyPath := filepath.Join(dir, name)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes}), 0600)
+
+	signer, err := gossh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, keyPath
+}
+
+// sshGitServer serves git-upload-pack over SSH to the holder of the authorized key
+func sshGitServer(t *testing.T, hostKey gossh.Signer, authorizedKey gossh.PublicKey) string {
+	if _, err := exec.LookPath("git-upload-pack"); err != nil {
+		t.Skip("git-upload-pack is not available")
+	}
+
+	config := &gossh.ServerConfig{
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveGitSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveGitSSH(conn net.Conn, config *gossh.ServerConfig) {
+	_, channels, requests, err := gossh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range channelRequests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				gossh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+
+				// git-upload-pack '/path/to/repo'
+				args := strings.SplitN(payload.Command, " ", 2)
+				cmd := exec.Command(args[0], strings.Trim(args[1], "'"))
+				cmd.Stdin = channel
+				cmd.Stdout = channel
+				cmd.Stderr = channel.Stderr()
+				exitStatus := 0
+				if err := cmd.Run(); err != nil {
+					exitStatus = 1
+				}
+				channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{uint32(exitStatus)}))
+				return
+			}
+		}()
+	}
+}
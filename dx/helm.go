@@ -28,12 +28,9 @@ func HelmTemplate(m *Manifest) (string, error) {
 	client.ClientOnly = true
 	client.APIVersions = []string{}
 	client.IncludeCRDs = false
-	client.ChartPathOptions.RepoURL = m.Chart.Repository
-	client.ChartPathOptions.Version = m.Chart.Version
 	client.Namespace = m.Namespace
 
-	var settings = helmCLI.New()
-	cp, err := client.ChartPathOptions.LocateChart(m.Chart.Name, settings)
+	cp, err := locateChart(m)
 	if err != nil {
 		return "", err
 	}
@@ -51,8 +48,28 @@ func HelmTemplate(m *Manifest) (string, error) {
 	return rel.Manifest, nil
 }
 
+// locateChart returns the local path of the chart, downloading it from the chart repository if needed
+func locateChart(m *Manifest) (string, error) {
+	if isOCI(m.Chart.Name) {
+		return pullOCIChart(m)
+	}
+
+	chartPathOptions := action.ChartPathOptions{
+		RepoURL: m.Chart.Repository,
+		Version: m.Chart.Version,
+	}
+
+	var settings = helmCLI.New()
+	return chartPathOptions.LocateChart(m.Chart.Name, settings)
+}
+
 // SplitHelmOutput splits helm's multifile string output into file paths and their content
 func SplitHelmOutput(input map[string]string) map[string]string {
+	return splitHelmOutput(input, filepath.Base)
+}
+
+// splitHelmOutput splits helm's output by the template sources, fileName maps the source path to the file path
+func splitHelmOutput(input map[string]string, fileName func(string) string) map[string]string {
 	if len(input) != 1 {
 		return input
 	}
@@ -76,11 +93,11 @@ func SplitHelmOutput(input map[string]string) map[string]string {
 			lines := strings.Split(p, "\n")
 			filePath := lines[0]
 			content := strings.Join(lines[1:], "\n")
-			fileName := filepath.Base(filePath)
-			if existingContent, ok := files[fileName]; ok {
-				files[fileName] = existingContent + "---\n" + content + "\n"
+			name := fileName(filePath)
+			if existingContent, ok := files[name]; ok {
+				files[name] = existingContent + "---\n" + content + "\n"
 			} else {
-				files[fileName] = "---\n" + content + "\n"
+				files[name] = "---\n" + content + "\n"
 			}
 		}
 	}
@@ -90,22 +107,38 @@ func SplitHelmOutput(input map[string]string) map[string]string {
 
 // CloneChartFromRepo returns the chart location of the specified chart
 func CloneChartFromRepo(m *Manifest, token string) (string, error) {
-	gitAddress, err := giturl.Parse(m.Chart.Name)
+	tmpChartDir, err := ioutil.TempDir("", "gimlet-git-chart")
 	if err != nil {
-		return "", fmt.Errorf("cannot parse chart's git address: %s", err)
+		return "", fmt.Errorf("cannot create tmp file: %s", err)
 	}
-	gitUrl := strings.ReplaceAll(m.Chart.Name, gitAddress.RawQuery, "")
-	gitUrl = strings.ReplaceAll(gitUrl, "?", "")
 
-	tmpChartDir, err := ioutil.TempDir("", "gimlet-git-chart")
+	return cloneChart(m, token, tmpChartDir)
+}
+
+// cloneChart clones the git repo of the chart to the given directory, and returns the path of the chart in it
+func cloneChart(m *Manifest, token string, tmpChartDir string) (string, error) {
+	return cloneGitRepo(m.Chart.Name, token, tmpChartDir)
+}
+
+// cloneGitRepo clones the repo to the given directory at the sha, tag or branch in the url params,
+// and returns the directory in it that the path param points to
+func cloneGitRepo(repoUrl string, token string, tmpChartDir string) (string, error) {
+	gitAddress, err := giturl.Parse(repoUrl)
 	if err != nil {
-		return "", fmt.Errorf("cannot create tmp file: %s", err)
+		return "", fmt.Errorf("cannot parse git address: %s", err)
 	}
+	gitUrl := strings.ReplaceAll(repoUrl, gitAddress.RawQuery, "")
+	gitUrl = strings.ReplaceAll(gitUrl, "?", "")
 
 	opts := &git.CloneOptions{
 		URL: gitUrl,
 	}
-	if token != "" {
+	if isSSHChart(repoUrl) {
+		opts.Auth, err = sshChartAuth(gitAddress)
+		if err != nil {
+			return "", err
+		}
+	} else if token != "" {
 		opts.Auth = &http.BasicAuth{
 			Username: "abc123", // this can be anything
 			Password: token,
@@ -113,7 +146,7 @@ func CloneChartFromRepo(m *Manifest, token string) (string, error) {
 	}
 	repo, err := git.PlainClone(tmpChartDir, false, opts)
 	if err != nil {
-		return "", fmt.Errorf("cannot clone chart git repo: %s", err)
+		return "", fmt.Errorf("cannot clone git repo: %s", err)
 	}
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -159,8 +192,7 @@ func TemplateChart(m *Manifest) (string, error) {
 		return "", nil
 	}
 
-	if strings.HasPrefix(m.Chart.Name, "git@") ||
-		strings.Contains(m.Chart.Name, ".git") { // for https:// git urls
+	if IsGitChart(m.Chart.Name) {
 		tmpChartDir, err := CloneChartFromRepo(m, "")
 		if err != nil {
 			fmt.Errorf("cannot fetch chart from git %s", err.Error())
@@ -186,9 +218,15 @@ func GetTemplatedManifests(m *Manifest) (string, error) {
 		return templatedManifests, fmt.Errorf("cannot template Helm chart %s", err)
 	}
 
+	kustomizedManifests, err := KustomizeBuild(m)
+	if err != nil {
+		return templatedManifests, fmt.Errorf("cannot build kustomization %s", err)
+	}
+	templatedManifests += kustomizedManifests
+
 	templatedManifests += m.Manifests
 	if templatedManifests == "" {
-		return templatedManifests, fmt.Errorf("no chart or raw yaml has been found")
+		return templatedManifests, fmt.Errorf("no chart, kustomization or raw yaml has been found")
 	}
 	return templatedManifests, nil
 
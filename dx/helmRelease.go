@@ -0,0 +1,283 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	giturl "github.com/whilp/git-urls"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+const helmReleaseApiVersion = "helm.toolkit.fluxcd.io/v2beta1"
+const fluxSourceApiVersion = "source.toolkit.fluxcd.io/v1beta2"
+
+// RenderHelmRelease renders the manifest for Flux to deploy: the chart becomes a Flux HelmRelease
+// with the HelmRepository or GitRepository source of the chart. The resolved values are passed in a Secret,
+// so they are encrypted like any other Secret of the env.
+// sourceSecrets maps the hosts of chart sources to the Flux secretRef that holds their credentials.
+// Kustomizations and raw yaml are rendered as usual. Patches apply to the chart as post renderers,
+// or to the kustomizations and raw yaml if there is no chart
+func (m *Manifest) RenderHelmRelease(sourceSecrets map[string]string) (string, error) {
+	helmRelease, err := m.helmRelease(sourceSecrets)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate HelmRelease %s", err)
+	}
+
+	manifests, err := KustomizeBuild(m)
+	if err != nil {
+		return "", fmt.Errorf("cannot build kustomization %s", err)
+	}
+	manifests += m.Manifests
+
+	// with a chart, the patches are applied by Flux as post renderers
+	if helmRelease == "" && manifests != "" && (m.StrategicMergePatches != "" || len(m.Json6902Patches) > 0) {
+		manifests, err = ApplyPatches(
+			m.StrategicMergePatches,
+			m.Json6902Patches,
+			manifests,
+		)
+		if err != nil {
+			return "", fmt.Errorf("cannot apply Kustomize patches %s", err)
+		}
+	}
+
+	if helmRelease+manifests == "" {
+		return "", fmt.Errorf("no chart, kustomization or raw yaml has been found")
+	}
+	return helmRelease + manifests, nil
+}
+
+type fluxResource struct {
+	ApiVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   fluxMetadata           `json:"metadata"`
+	Spec       map[string]interface{} `json:"spec"`
+}
+
+type fluxMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+const valuesKey = "values.yaml"
+
+type valuesSecret struct {
+	ApiVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   fluxMetadata      `json:"metadata"`
+	StringData map[string]string `json:"stringData"`
+}
+
+// helmRelease returns the HelmRelease, the source of the chart and the Secret of the values
+func (m *Manifest) helmRelease(sourceSecrets map[string]string) (string, error) {
+	if m.Chart.Name == "" {
+		return "", nil
+	}
+
+	name := sanitizeDNSName(m.App)
+	metadata := fluxMetadata{Name: name, Namespace: m.Namespace}
+	source, chart, err := m.chartSource(metadata)
+	if err != nil {
+		return "", err
+	}
+	if secretName, ok := sourceSecrets[sourceHost(source)]; ok {
+		source.Spec["secretRef"] = map[string]interface{}{
+			"name": secretName,
+		}
+	}
+
+	chartSpec := map[string]interface{}{
+		"chart": chart,
+		"sourceRef": map[string]interface{}{
+			"kind": source.Kind,
+			"name": source.Metadata.Name,
+		},
+	}
+	if m.Chart.Version != "" && source.Kind == "HelmRepository" {
+		chartSpec["version"] = m.Chart.Version
+	}
+
+	spec := map[string]interface{}{
+		"interval":    "1m",
+		"releaseName": m.App,
+		"chart": map[string]interface{}{
+			"spec": chartSpec,
+		},
+	}
+	var resources []interface{}
+	resources = append(resources, source)
+	if len(m.Values) > 0 {
+		values, err := yaml.Marshal(m.Values)
+		if err != nil {
+			return "", err
+		}
+		secret := valuesSecret{
+			ApiVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   fluxMetadata{Name: name + "-values", Namespace: m.Namespace},
+			StringData: map[string]string{valuesKey: string(values)},
+		}
+		resources = append(resources, secret)
+		spec["valuesFrom"] = []interface{}{
+			map[string]interface{}{
+				"kind":      "Secret",
+				"name":      secret.Metadata.Name,
+				"valuesKey": valuesKey,
+			},
+		}
+	}
+	postRenderer, err := m.postRenderer()
+	if err != nil {
+		return "", err
+	}
+	if postRenderer != nil {
+		spec["postRenderers"] = []interface{}{postRenderer}
+	}
+
+	helmRelease := fluxResource{
+		ApiVersion: helmReleaseApiVersion,
+		Kind:       "HelmRelease",
+		Metadata:   metadata,
+		Spec:       spec,
+	}
+
+	resources = append(resources, helmRelease)
+
+	var output string
+	for _, resource := range resources {
+		resourceBytes, err := yaml.Marshal(resource)
+		if err != nil {
+			return "", err
+		}
+		output += "---\n" + string(resourceBytes)
+	}
+	return output, nil
+}
+
+// chartSource returns the Flux source of the chart, and the chart's name or path in it
+func (m *Manifest) chartSource(metadata fluxMetadata) (*fluxResource, string, error) {
+	source := &fluxResource{
+		ApiVersion: fluxSourceApiVersion,
+		Metadata:   metadata,
+		Spec: map[string]interface{}{
+			"interval": "1m",
+		},
+	}
+
+	switch {
+	case isOCI(m.Chart.Name):
+		if m.Chart.Version == "" {
+			return nil, "", fmt.Errorf("version is required for OCI charts")
+		}
+		source.Kind = "HelmRepository"
+		source.Spec["type"] = "oci"
+		source.Spec["url"] = ociScheme + path.Dir(strings.TrimPrefix(m.Chart.Name, ociScheme))
+		return source, path.Base(m.Chart.Name), nil
+	case IsGitChart(m.Chart.Name):
+		gitAddress, err := giturl.Parse(m.Chart.Name)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot parse git address: %s", err)
+		}
+		gitUrl := strings.ReplaceAll(m.Chart.Name, gitAddress.RawQuery, "")
+		gitUrl = strings.ReplaceAll(gitUrl, "?", "")
+		if strings.HasPrefix(gitUrl, "git@") { // Flux only accepts ssh:// urls
+			gitUrl = "ssh://" + strings.Replace(gitUrl, ":", "/", 1)
+		}
+
+		params, _ := url.ParseQuery(gitAddress.RawQuery)
+		ref := map[string]interface{}{}
+		for param, field := range map[string]string{"sha": "commit", "tag": "tag", "branch": "branch"} {
+			if v, found := params[param]; found {
+				ref[field] = v[0]
+			}
+		}
+		chartPath := "./"
+		if v, found := params["path"]; found {
+			chartPath = "./" + strings.TrimPrefix(v[0], "/")
+		}
+
+		source.Kind = "GitRepository"
+		source.Spec["url"] = gitUrl
+		if len(ref) > 0 {
+			source.Spec["ref"] = ref
+		}
+		return source, chartPath, nil
+	case m.Chart.Repository != "":
+		source.Kind = "HelmRepository"
+		source.Spec["url"] = m.Chart.Repository
+		return source, m.Chart.Name, nil
+	default:
+		return nil, "", fmt.Errorf("chart %s has no repository that Flux could fetch it from", m.Chart.Name)
+	}
+}
+
+// sourceHost returns the host of the source url, that the credentials of the source are configured for
+func sourceHost(source *fluxResource) string {
+	sourceUrl, _ := source.Spec["url"].(string)
+	parsed, err := url.Parse(sourceUrl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// postRenderer turns the patches of the manifest into a Kustomize post renderer of the HelmRelease
+func (m *Manifest) postRenderer() (map[string]interface{}, error) {
+	if m.StrategicMergePatches == "" && len(m.Json6902Patches) == 0 {
+		return nil, nil
+	}
+
+	kustomize := map[string]interface{}{}
+
+	var strategicMergePatches []interface{}
+	decoder := yamlv3.NewDecoder(bytes.NewBufferString(m.StrategicMergePatches))
+	for {
+		var patch map[string]interface{}
+		err := decoder.Decode(&patch)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse strategic merge patches: %s", err)
+		}
+		if patch != nil {
+			strategicMergePatches = append(strategicMergePatches, patch)
+		}
+	}
+	if len(strategicMergePatches) > 0 {
+		kustomize["patchesStrategicMerge"] = strategicMergePatches
+	}
+
+	var jsonPatches []interface{}
+	for _, jsonPatch := range m.Json6902Patches {
+		var operations []interface{}
+		err := yaml.Unmarshal([]byte(jsonPatch.Patch), &operations)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse json6902 patch: %s", err)
+		}
+		target := map[string]interface{}{
+			"kind": jsonPatch.Target.Kind,
+			"name": jsonPatch.Target.Name,
+		}
+		if jsonPatch.Target.Group != "" {
+			target["group"] = jsonPatch.Target.Group
+		}
+		if jsonPatch.Target.Version != "" {
+			target["version"] = jsonPatch.Target.Version
+		}
+		jsonPatches = append(jsonPatches, map[string]interface{}{
+			"target": target,
+			"patch":  operations,
+		})
+	}
+	if len(jsonPatches) > 0 {
+		kustomize["patchesJson6902"] = jsonPatches
+	}
+
+	return map[string]interface{}{"kustomize": kustomize}, nil
+}
@@ -0,0 +1,100 @@
+package dx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_RenderHelmRelease(t *testing.T) {
+	m := &Manifest{
+		App:       "my-app",
+		Env:       "production",
+		Namespace: "default",
+		Chart: Chart{
+			Repository: "https://chart.onechart.dev",
+			Name:       "onechart",
+			Version:    "0.32.0",
+		},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "nginx",
+				"tag":        "1.21",
+			},
+		},
+		StrategicMergePatches: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  replicas: 2
+`,
+		Manifests: `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app-config
+`,
+	}
+
+	manifests, err := m.RenderHelmRelease(map[string]string{"chart.onechart.dev": "onechart-credentials"})
+	assert.Nil(t, err)
+
+	layout, _ := NewGitopsLayout(LayoutResource, false, "", nil, nil)
+	files, err := layout.AppFiles(manifests)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(files))
+	assert.True(t, strings.Contains(files["helmrepository-my-app.yaml"], "url: https://chart.onechart.dev"))
+	assert.True(t, strings.Contains(files["helmrepository-my-app.yaml"], "name: onechart-credentials"))
+	assert.True(t, strings.Contains(files["configmap-my-app-config.yaml"], "my-app-config"))
+
+	var helmRelease map[string]interface{}
+	err = yaml.Unmarshal([]byte(files["helmrelease-my-app.yaml"]), &helmRelease)
+	assert.Nil(t, err)
+	spec := helmRelease["spec"].(map[string]interface{})
+	chartSpec := spec["chart"].(map[string]interface{})["spec"].(map[string]interface{})
+	assert.Equal(t, "onechart", chartSpec["chart"])
+	assert.Equal(t, "0.32.0", chartSpec["version"])
+	assert.Nil(t, spec["values"], "values should not be in plain text in the HelmRelease")
+	valuesFrom := spec["valuesFrom"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "my-app-values", valuesFrom["name"])
+
+	var secret struct {
+		StringData map[string]string `json:"stringData"`
+	}
+	err = yaml.Unmarshal([]byte(files["secret-my-app-values.yaml"]), &secret)
+	assert.Nil(t, err)
+	var values map[string]interface{}
+	err = yaml.Unmarshal([]byte(secret.StringData[valuesKey]), &values)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", values["image"].(map[string]interface{})["repository"])
+	postRenderer := spec["postRenderers"].([]interface{})[0].(map[string]interface{})
+	assert.NotNil(t, postRenderer["kustomize"].(map[string]interface{})["patchesStrategicMerge"])
+}
+
+func Test_chartSource(t *testing.T) {
+	metadata := fluxMetadata{Name: "my-app"}
+
+	m := &Manifest{Chart: Chart{Name: "oci://ghcr.io/gimlet-io/charts/onechart", Version: "0.32.0"}}
+	source, chart, err := m.chartSource(metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, "HelmRepository", source.Kind)
+	assert.Equal(t, "oci://ghcr.io/gimlet-io/charts", source.Spec["url"])
+	assert.Equal(t, "onechart", chart)
+
+	m = &Manifest{Chart: Chart{Name: "git@github.com:gimlet-io/onechart.git?sha=abcd&path=/charts/onechart/"}}
+	source, chart, err = m.chartSource(metadata)
+	assert.Nil(t, err)
+	assert.Equal(t, "GitRepository", source.Kind)
+	assert.Equal(t, "ssh://git@github.com/gimlet-io/onechart.git", source.Spec["url"])
+	assert.Equal(t, map[string]interface{}{"commit": "abcd"}, source.Spec["ref"])
+	assert.Equal(t, "./charts/onechart/", chart)
+
+	m = &Manifest{Chart: Chart{Name: "/charts/onechart"}}
+	_, _, err = m.chartSource(metadata)
+	assert.NotNil(t, err, "local charts cannot be fetched by Flux")
+}
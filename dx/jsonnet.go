@@ -0,0 +1,48 @@
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-jsonnet"
+)
+
+// jsonnetMaxStack caps the depth of Jsonnet function calls, runaway recursion fails fast
+const jsonnetMaxStack = 200
+
+// RenderJsonnetToManifests evaluates the Jsonnet file with the vars as ext vars, eg.: std.extVar('GITHUB_SHA').
+// The VM is hermetic, imports are not resolved. It gives up after the evaluation timeout
+func RenderJsonnetToManifests(fileContent string, vars map[string]string) ([]string, error) {
+	return evaluateWithTimeout(func() ([]string, error) {
+		return renderJsonnetToManifests(fileContent, vars)
+	})
+}
+
+func renderJsonnetToManifests(fileContent string, vars map[string]string) ([]string, error) {
+	vm := jsonnet.MakeVM()
+	vm.MaxStack = jsonnetMaxStack
+	vm.Importer(&jsonnet.MemoryImporter{Data: map[string]jsonnet.Contents{}})
+	for k, v := range vars {
+		vm.ExtVar(k, v)
+	}
+
+	output, err := vm.EvaluateAnonymousSnippet("environments.jsonnet", fileContent)
+	if err != nil {
+		return []string{}, fmt.Errorf("cannot evaluate jsonnet file: %s", err)
+	}
+
+	var environments struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	err = json.Unmarshal([]byte(output), &environments)
+	if err != nil || environments.Configs == nil {
+		return []string{}, fmt.Errorf("jsonnet files should have a `configs` field that holds an array of Gimlet manfiests")
+	}
+
+	var manifests []string
+	for _, config := range environments.Configs {
+		manifests = append(manifests, string(config))
+	}
+
+	return manifests, nil
+}
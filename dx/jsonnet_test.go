@@ -0,0 +1,46 @@
+package dx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jsonnetRender(t *testing.T) {
+	manifests, err := RenderJsonnetToManifests(`{configs: [{app: 'myapp', env: std.extVar('ENV')}]}`, map[string]string{"ENV": "staging"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(manifests))
+	assert.JSONEq(t, `{"app":"myapp","env":"staging"}`, manifests[0])
+
+	_, err = RenderJsonnetToManifests(`[{app: 'myapp'}]`, map[string]string{})
+	assert.NotNil(t, err, "should require a configs field")
+
+	_, err = RenderJsonnetToManifests(`{configs: [{app: std.extVar('MISSING')}]}`, map[string]string{})
+	assert.NotNil(t, err, "should fail on undefined ext vars")
+}
+
+func Test_jsonnetRenderIsHermetic(t *testing.T) {
+	_, err := RenderJsonnetToManifests(`local defaults = import '/etc/gimletd/defaults.libsonnet'; {configs: [defaults]}`, map[string]string{})
+	assert.NotNil(t, err)
+
+	_, err = RenderJsonnetToManifests(`{configs: [std.native('exec')('ls')]}`, map[string]string{})
+	assert.NotNil(t, err)
+}
+
+func Test_jsonnetRenderLimits(t *testing.T) {
+	_, err := RenderJsonnetToManifests(`local f(x) = f(x + 1) + 1; {configs: [f(0)]}`, map[string]string{})
+	assert.NotNil(t, err, "should fail on runaway recursion")
+	assert.Contains(t, err.Error(), "max stack frames exceeded")
+
+	defer func(timeout time.Duration, slots chan struct{}) {
+		evaluationTimeout = timeout
+		evaluationSlots = slots
+	}(evaluationTimeout, evaluationSlots)
+	evaluationTimeout = 10 * time.Millisecond
+	evaluationSlots = make(chan struct{}, 1) // the abandoned evaluation keeps its slot
+
+	_, err = RenderJsonnetToManifests(`{configs: [std.foldl(function(acc, x) acc + x, std.range(1, 100000000), 0)]}`, map[string]string{})
+	assert.NotNil(t, err, "should give up on long evaluations")
+	assert.Contains(t, err.Error(), "timed out")
+}
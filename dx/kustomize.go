@@ -2,6 +2,11 @@ package dx
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
@@ -9,6 +14,141 @@ import (
 	"sigs.k8s.io/kustomize/api/krusty"
 )
 
+// Kustomize references a Kustomize base or overlay directory that is built alongside, or instead of the Helm chart
+type Kustomize struct {
+	// Repository is the git url of the kustomization, with optional sha, tag or branch params,
+	// eg.: https://github.com/gimlet-io/my-app.git?tag=v1.0.0.
+	// Defaults to the app repository at the commit of the artifact
+	Repository string `yaml:"repository,omitempty" json:"repository,omitempty"`
+	// Path of the kustomization directory in the repository
+	Path string `yaml:"path" json:"path"`
+
+	// clonePath is the local clone of the repository, made by GimletD
+	clonePath string
+}
+
+// ResolveRepository defaults the repository to the app repository at the commit of the artifact
+func (k *Kustomize) ResolveRepository(version Version) {
+	if k == nil || k.Repository != "" {
+		return
+	}
+	k.Repository = fmt.Sprintf("https://github.com/%s.git?sha=%s", version.RepositoryName, version.SHA)
+}
+
+// UseClone builds the kustomization from a local clone of the repository, see CloneKustomization
+func (k *Kustomize) UseClone(clonePath string) {
+	k.clonePath = clonePath
+}
+
+// allowedRepositoryPrefixes are the remote git urls that kustomizations are cloned from.
+// Local paths, file:// urls and git's transport helpers like ext:: are refused
+var allowedRepositoryPrefixes = []string{"https://", "ssh://", "git@"}
+
+// validateRepository refuses repositories that are not remote git urls
+func (k *Kustomize) validateRepository() error {
+	for _, prefix := range allowedRepositoryPrefixes {
+		if strings.HasPrefix(k.Repository, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("kustomization repository %s must be a https://, ssh:// or git@ git url", k.Repository)
+}
+
+// kustomizationDir returns the path of the kustomization in the repository, refuses paths that point out of it
+func (k *Kustomize) kustomizationDir() (string, error) {
+	relativePath := filepath.Clean(strings.TrimPrefix(k.Path, "/"))
+	if relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("kustomization path %s points out of the repository", k.Path)
+	}
+	return filepath.Join("/", relativePath), nil
+}
+
+// CloneKustomization clones the git repository of the manifest's kustomization, and returns its local path
+func CloneKustomization(m *Manifest, token string) (string, error) {
+	err := m.Kustomize.validateRepository()
+	if err != nil {
+		return "", err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "gimlet-kustomization")
+	if err != nil {
+		return "", fmt.Errorf("cannot create tmp file: %s", err)
+	}
+
+	_, err = cloneGitRepo(m.Kustomize.Repository, token, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	return tmpDir, nil
+}
+
+// KustomizeBuild builds the manifest's kustomization with its bases, components and generators.
+// The build only sees the files of the repository, bases can't reference other directories of the host
+func KustomizeBuild(m *Manifest) (string, error) {
+	if m.Kustomize == nil {
+		return "", nil
+	}
+
+	dir, err := m.Kustomize.kustomizationDir()
+	if err != nil {
+		return "", err
+	}
+
+	repoPath := m.Kustomize.clonePath
+	if repoPath == "" {
+		repoPath, err = CloneKustomization(m, "")
+		if err != nil {
+			return "", fmt.Errorf("cannot fetch kustomization from git %s", err.Error())
+		}
+		defer os.RemoveAll(repoPath)
+	}
+
+	fSys, err := inMemoryRepository(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot read kustomization: %s", err)
+	}
+
+	b := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := b.Run(fSys, dir)
+	if err != nil {
+		return "", err
+	}
+
+	yaml, err := resources.AsYaml()
+	if err != nil {
+		return "", err
+	}
+	return "---\n" + string(yaml), nil
+}
+
+// inMemoryRepository copies the regular files of the repository to an in-memory file system, rooted at /
+func inMemoryRepository(repoPath string) (filesys.FileSystem, error) {
+	fSys := filesys.MakeFsInMemory()
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() { // directories are created with the files, symlinks are skipped
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fSys.WriteFile(filepath.Join("/", relativePath), content)
+	})
+	return fSys, err
+}
+
 const bareKustomization = `
 apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
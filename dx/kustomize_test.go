@@ -1,9 +1,15 @@
 package dx
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -102,3 +108,142 @@ spec:
 	assert.True(t, strings.Contains(patched, "myapp-replaced"))
 	assert.True(t, strings.Contains(patched, "Always"))
 }
+
+var kustomization = map[string]string{
+	"base/kustomization.yaml": `
+resources:
+- deployment.yaml
+`,
+	"base/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  template:
+    spec:
+      containers:
+      - name: myapp
+        image: myapp
+`,
+	"components/debug/kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1alpha1
+kind: Component
+configMapGenerator:
+- name: debug
+  literals:
+  - LOG_LEVEL=debug
+`,
+	"overlays/staging/kustomization.yaml": `
+resources:
+- ../../base
+components:
+- ../../components/debug
+namePrefix: staging-
+images:
+- name: myapp
+  newName: ghcr.io/gimlet-io/myapp
+  newTag: v1.0.0
+configMapGenerator:
+- name: myapp
+  literals:
+  - ENV=staging
+`,
+}
+
+func writeKustomization(t *testing.T, dir string) {
+	for path, content := range kustomization {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)
+		err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644)
+		assert.Nil(t, err)
+	}
+}
+
+func Test_KustomizeBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeKustomization(t, dir)
+
+	m := &Manifest{
+		Kustomize: &Kustomize{
+			Path: "overlays/staging",
+		},
+	}
+	m.Kustomize.UseClone(dir)
+	manifests, err := GetTemplatedManifests(m)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(manifests, "---\n"))
+	assert.Contains(t, manifests, "name: staging-myapp\n")
+	assert.Contains(t, manifests, "image: ghcr.io/gimlet-io/myapp:v1.0.0")
+	assert.Contains(t, manifests, "ENV: staging")
+	assert.Contains(t, manifests, "LOG_LEVEL: debug", "should include components")
+}
+
+func Test_KustomizeBuildFromGit(t *testing.T) {
+	dir := t.TempDir()
+	writeKustomization(t, dir)
+	repo, _ := git.PlainInit(dir, false)
+	worktree, _ := repo.Worktree()
+	worktree.Add(".")
+	sha, err := worktree.Commit("kustomization", &git.CommitOptions{
+		Author: &object.Signature{Name: "gimlet", Email: "gimlet@example.com", When: time.Now()},
+	})
+	assert.Nil(t, err)
+
+	cloneDir := t.TempDir()
+	_, err = cloneGitRepo("file://"+dir+"?sha="+sha.String(), "", cloneDir)
+	assert.Nil(t, err)
+
+	m := &Manifest{
+		Kustomize: &Kustomize{
+			Path: "overlays/staging",
+		},
+		Manifests: "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: raw\n",
+	}
+	m.Kustomize.UseClone(cloneDir)
+	manifests, err := GetTemplatedManifests(m)
+	assert.Nil(t, err)
+	assert.Contains(t, manifests, "name: staging-myapp\n")
+	assert.Contains(t, manifests, "name: raw")
+}
+
+func Test_KustomizeResolveRepository(t *testing.T) {
+	k := &Kustomize{Path: "deploy/overlays/production"}
+	k.ResolveRepository(Version{RepositoryName: "gimlet-io/myapp", SHA: "abc123"})
+	assert.Equal(t, "https://github.com/gimlet-io/myapp.git?sha=abc123", k.Repository)
+
+	k.ResolveRepository(Version{RepositoryName: "gimlet-io/other", SHA: "def456"})
+	assert.Equal(t, "https://github.com/gimlet-io/myapp.git?sha=abc123", k.Repository, "should keep the configured repository")
+
+	var noKustomize *Kustomize
+	noKustomize.ResolveRepository(Version{})
+}
+
+func Test_KustomizeBuildRefusesHostPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeKustomization(t, dir)
+
+	_, err := KustomizeBuild(&Manifest{Kustomize: &Kustomize{Repository: dir, Path: "overlays/staging"}})
+	assert.NotNil(t, err, "should refuse local directories from artifacts")
+	_, err = KustomizeBuild(&Manifest{Kustomize: &Kustomize{Repository: "file://" + dir, Path: "overlays/staging"}})
+	assert.NotNil(t, err, "should refuse file urls from artifacts")
+	for _, repository := range []string{"../my-app", "ext::sh -c touch% /tmp/pwned", "http://github.com/gimlet-io/my-app.git"} {
+		err = (&Kustomize{Repository: repository}).validateRepository()
+		assert.NotNil(t, err, "should refuse %s", repository)
+	}
+	for _, repository := range []string{"https://github.com/gimlet-io/my-app.git?sha=abc", "ssh://git@github.com/gimlet-io/my-app.git", "git@github.com:gimlet-io/my-app.git"} {
+		err = (&Kustomize{Repository: repository}).validateRepository()
+		assert.Nil(t, err, "should accept %s", repository)
+	}
+
+	m := &Manifest{Kustomize: &Kustomize{Path: "../../etc"}}
+	m.Kustomize.UseClone(filepath.Join(dir, "overlays"))
+	_, err = KustomizeBuild(m)
+	assert.NotNil(t, err, "should refuse paths out of the repository")
+
+	escaping := t.TempDir()
+	ioutil.WriteFile(filepath.Join(escaping, "kustomization.yaml"), []byte("resources:\n- ../base\n"), 0644)
+	m = &Manifest{Kustomize: &Kustomize{Path: "/"}}
+	m.Kustomize.UseClone(escaping)
+	_, err = KustomizeBuild(m)
+	assert.NotNil(t, err, "bases should not reach out of the repository")
+}
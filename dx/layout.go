@@ -0,0 +1,174 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// LayoutFlat writes the helm templates to env/app/<basename>.yaml, templates with the same basename are concatenated
+const LayoutFlat = "flat"
+
+// LayoutChart preserves the directory structure of the chart, eg.: env/app/onechart/templates/deployment.yaml
+const LayoutChart = "chart"
+
+// LayoutResource writes one file per resource, named by kind and name, eg.: env/app/deployment-my-app.yaml
+const LayoutResource = "resource"
+
+// LayoutSingle writes all resources to env/app/manifest.yaml
+const LayoutSingle = "single"
+
+const defaultFluxSourceName = "flux-system"
+
+// GitopsLayout controls how the rendered manifests of an app are laid out in the gitops repo
+type GitopsLayout struct {
+	// Files is one of LayoutFlat, LayoutChart, LayoutResource or LayoutSingle
+	Files string
+	// FluxKustomization generates a Flux Kustomization for each app that syncs the env/app folder
+	FluxKustomization bool
+	// FluxSourceName is the GitRepository of the gitops repo in Flux, defaults to flux-system
+	FluxSourceName string
+	// HelmReleaseEnvs get a Flux HelmRelease of the chart instead of the rendered chart, Flux renders the chart in-cluster.
+	// Glob patterns like preview-* are supported
+	HelmReleaseEnvs []string
+	// SourceSecrets maps chart source hosts to the Flux secret that holds their credentials
+	SourceSecrets map[string]string
+}
+
+// NewGitopsLayout validates the layout settings
+func NewGitopsLayout(
+	files string,
+	fluxKustomization bool,
+	fluxSourceName string,
+	helmReleaseEnvs []string,
+	sourceSecrets map[string]string,
+) (*GitopsLayout, error) {
+	switch files {
+	case "":
+		files = LayoutFlat
+	case LayoutFlat, LayoutChart, LayoutResource, LayoutSingle:
+	default:
+		return nil, fmt.Errorf("invalid gitops layout %s, use %s, %s, %s or %s", files, LayoutFlat, LayoutChart, LayoutResource, LayoutSingle)
+	}
+	if fluxSourceName == "" {
+		fluxSourceName = defaultFluxSourceName
+	}
+	for _, pattern := range helmReleaseEnvs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid HelmRelease env pattern %s: %s", pattern, err)
+		}
+	}
+
+	return &GitopsLayout{
+		Files:             files,
+		FluxKustomization: fluxKustomization,
+		FluxSourceName:    fluxSourceName,
+		HelmReleaseEnvs:   helmReleaseEnvs,
+		SourceSecrets:     sourceSecrets,
+	}, nil
+}
+
+// HelmRelease tells if the charts of the env are deployed with a Flux HelmRelease
+func (l *GitopsLayout) HelmRelease(env string) bool {
+	if l == nil {
+		return false
+	}
+	for _, pattern := range l.HelmReleaseEnvs {
+		if matched, _ := path.Match(pattern, env); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AppFiles splits the rendered manifests into the files of the app folder, paths are relative to env/app.
+// A nil layout is the flat layout
+func (l *GitopsLayout) AppFiles(manifests string) (map[string]string, error) {
+	input := map[string]string{"manifest.yaml": manifests}
+	if l == nil {
+		return SplitHelmOutput(input), nil
+	}
+
+	switch l.Files {
+	case LayoutChart:
+		return splitHelmOutput(input, path.Clean), nil
+	case LayoutResource:
+		return splitResources(manifests)
+	case LayoutSingle:
+		return input, nil
+	default:
+		return SplitHelmOutput(input), nil
+	}
+}
+
+// EnvFiles returns the files that the app needs outside of its folder, paths are relative to the repo root
+func (l *GitopsLayout) EnvFiles(env string, app string) map[string]string {
+	if l == nil || !l.FluxKustomization {
+		return map[string]string{}
+	}
+
+	sourceName := l.FluxSourceName
+	if sourceName == "" {
+		sourceName = defaultFluxSourceName
+	}
+
+	kustomization := fmt.Sprintf(`---
+apiVersion: kustomize.toolkit.fluxcd.io/v1beta2
+kind: Kustomization
+metadata:
+  name: %s
+  namespace: flux-system
+spec:
+  interval: 1m
+  path: ./%s
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: %s
+`, sanitizeDNSName(env+"-"+app), filepath.ToSlash(filepath.Join(env, app)), sourceName)
+
+	return map[string]string{
+		FluxKustomizationPath(env, app): kustomization,
+	}
+}
+
+// FluxKustomizationPath is where the Flux Kustomization of the app is written, next to the Flux manifests of the env
+func FluxKustomizationPath(env string, app string) string {
+	return filepath.Join(env, "flux", "kustomization-"+app+".yaml")
+}
+
+// splitResources writes each resource to <kind>-<name>.yaml, resources with the same kind and name are concatenated
+func splitResources(manifests string) (map[string]string, error) {
+	files := map[string]string{}
+
+	for _, document := range yamlDocumentSeparator.Split(manifests, -1) {
+		var doc yamlv3.Node
+		err := yamlv3.NewDecoder(bytes.NewBufferString(document)).Decode(&doc)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("cannot parse manifests: %s", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+			continue // empty or comment only document
+		}
+
+		kind := mappingValue(doc.Content[0], "kind")
+		name := resourceName(&doc)
+		if kind == nil || name == "" {
+			return nil, fmt.Errorf("cannot determine the kind and name of resource:\n%s", strings.TrimSpace(document))
+		}
+
+		fileName := strings.ToLower(fmt.Sprintf("%s-%s.yaml", kind.Value, name))
+		content := strings.TrimLeft(document, "\n")
+		if !strings.HasSuffix(content, "\n") {
+			content = content + "\n"
+		}
+		files[fileName] = files[fileName] + "---\n" + content
+	}
+
+	return files, nil
+}
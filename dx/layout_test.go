@@ -0,0 +1,106 @@
+package dx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const chartOutput = `
+---
+# Source: onechart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+---
+# Source: onechart/charts/redis/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app-redis
+---
+# Source: onechart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+`
+
+func Test_AppFiles(t *testing.T) {
+	var layout *GitopsLayout
+	files, err := layout.AppFiles(chartOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files), "flat layout concatenates templates with the same basename")
+	assert.True(t, strings.Contains(files["deployment.yaml"], "my-app-redis"))
+
+	layout, _ = NewGitopsLayout(LayoutChart, false, "", nil, nil)
+	files, err = layout.AppFiles(chartOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	assert.True(t, strings.Contains(files["onechart/charts/redis/templates/deployment.yaml"], "my-app-redis"))
+	assert.False(t, strings.Contains(files["onechart/templates/deployment.yaml"], "my-app-redis"))
+
+	layout, _ = NewGitopsLayout(LayoutResource, false, "", nil, nil)
+	files, err = layout.AppFiles(chartOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	assert.True(t, strings.Contains(files["deployment-my-app-redis.yaml"], "name: my-app-redis"))
+	assert.True(t, strings.Contains(files["service-my-app.yaml"], "kind: Service"))
+
+	layout, _ = NewGitopsLayout(LayoutSingle, false, "", nil, nil)
+	files, err = layout.AppFiles(chartOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, chartOutput, files["manifest.yaml"])
+}
+
+func Test_AppFiles_resourceWithoutName(t *testing.T) {
+	layout, _ := NewGitopsLayout(LayoutResource, false, "", nil, nil)
+	_, err := layout.AppFiles(`
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  key: value
+`)
+	assert.NotNil(t, err)
+}
+
+func Test_NewGitopsLayout(t *testing.T) {
+	_, err := NewGitopsLayout("nested", false, "", nil, nil)
+	assert.NotNil(t, err)
+
+	layout, err := NewGitopsLayout("", false, "", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, LayoutFlat, layout.Files)
+	assert.Equal(t, "flux-system", layout.FluxSourceName)
+
+	_, err = NewGitopsLayout("", false, "", []string{"preview-["}, nil)
+	assert.NotNil(t, err, "should validate the HelmRelease env patterns")
+}
+
+func Test_EnvFiles(t *testing.T) {
+	layout, _ := NewGitopsLayout(LayoutFlat, false, "", nil, nil)
+	assert.Empty(t, layout.EnvFiles("staging", "my-app"))
+
+	layout, _ = NewGitopsLayout(LayoutFlat, true, "gitops-repo", nil, nil)
+	files := layout.EnvFiles("staging", "my_app")
+	kustomization := files["staging/flux/kustomization-my_app.yaml"]
+	assert.True(t, strings.Contains(kustomization, "name: staging-my-app\n"))
+	assert.True(t, strings.Contains(kustomization, "path: ./staging/my_app\n"))
+	assert.True(t, strings.Contains(kustomization, "name: gitops-repo\n"))
+}
+
+func Test_HelmRelease(t *testing.T) {
+	var layout *GitopsLayout
+	assert.False(t, layout.HelmRelease("production"))
+
+	layout, _ = NewGitopsLayout(LayoutFlat, false, "", []string{"production"}, nil)
+	assert.True(t, layout.HelmRelease("production"))
+	assert.False(t, layout.HelmRelease("staging"))
+
+	layout, _ = NewGitopsLayout(LayoutFlat, false, "", []string{"preview-*"}, nil)
+	assert.True(t, layout.HelmRelease("preview-my-branch"))
+	assert.False(t, layout.HelmRelease("preview"))
+}
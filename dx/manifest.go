@@ -7,7 +7,6 @@ import (
 	"strings"
 	"text/template"
 
-	"github.com/Masterminds/sprig/v3"
 	"sigs.k8s.io/yaml"
 )
 
@@ -22,6 +21,7 @@ type Manifest struct {
 	StrategicMergePatches string                 `yaml:"strategicMergePatches" json:"strategicMergePatches"`
 	Json6902Patches       []Json6902Patch        `yaml:"json6902Patches" json:"json6902Patches"`
 	Manifests             string                 `yaml:"manifests" json:"manifests"`
+	Kustomize             *Kustomize             `yaml:"kustomize,omitempty" json:"kustomize,omitempty"`
 }
 
 type Json6902Patch struct {
@@ -55,6 +55,48 @@ type Cleanup struct {
 }
 
 func (m *Manifest) ResolveVars(vars map[string]string) error {
+	return m.resolveVars(vars, templateFuncs(nil))
+}
+
+// ResolveEnv resolves the env name of the manifest with the artifact vars, the same way ResolveArtifactVars does.
+// Callers use it to filter manifests by env before resolving the rest of the manifest
+func (m *Manifest) ResolveEnv(artifact *Artifact) (string, error) {
+	return resolveString(m.Env, artifact.TemplateVars())
+}
+
+// ResolveArtifactVars resolves the manifest with the artifact vars, the target env and the currently deployed release.
+// The env and app names are resolved first, without the deployed release
+func (m *Manifest) ResolveArtifactVars(artifact *Artifact, deployed DeployedReleases) error {
+	vars := artifact.TemplateVars()
+
+	env, err := resolveString(m.Env, vars)
+	if err != nil {
+		return err
+	}
+	app, err := resolveString(m.App, vars)
+	if err != nil {
+		return err
+	}
+
+	var release *Release
+	if deployed != nil {
+		release, err = deployed.Release(env, app)
+		if err != nil {
+			return fmt.Errorf("cannot look up the deployed release: %s", err)
+		}
+	}
+	vars["Env"] = env
+	vars["Release"] = release
+
+	return m.resolveVars(vars, templateFuncs(func() ([]string, error) {
+		if deployed == nil {
+			return nil, nil
+		}
+		return deployed.Images(env, app)
+	}))
+}
+
+func (m *Manifest) resolveVars(vars interface{}, functions map[string]interface{}) error {
 	cleanupBkp := m.Cleanup
 	m.Cleanup = nil // cleanup only supports the BRANCH variable, not resolving it here
 	manifestString, err := yaml.Marshal(m)
@@ -62,11 +104,6 @@ func (m *Manifest) ResolveVars(vars map[string]string) error {
 		return fmt.Errorf("cannot marshal manifest %s", err.Error())
 	}
 
-	functions := make(map[string]interface{})
-	for k, v := range sprig.GenericFuncMap() {
-		functions[k] = v
-	}
-	functions["sanitizeDNSName"] = sanitizeDNSName
 	tpl, err := template.New("").
 		Option("missingkey=error").
 		Funcs(functions).
@@ -113,13 +150,8 @@ func (c *Cleanup) ResolveVars(vars map[string]string) error {
 		return fmt.Errorf("cannot marshal cleanup policy %s", err.Error())
 	}
 
-	functions := make(map[string]interface{})
-	for k, v := range sprig.GenericFuncMap() {
-		functions[k] = v
-	}
-	functions["sanitizeDNSName"] = sanitizeDNSName
 	tpl, err := template.New("").
-		Funcs(functions).
+		Funcs(templateFuncs(nil)).
 		Parse(string(cleanupPolicyString))
 	if err != nil {
 		return err
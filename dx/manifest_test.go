@@ -104,3 +104,140 @@ app: hello
 	assert.Nil(t, err)
 	assert.Equal(t, "hello", m.App)
 }
+
+type fakeDeployedReleases struct {
+	release *Release
+	images  []string
+}
+
+func (f *fakeDeployedReleases) Release(env string, app string) (*Release, error) {
+	if env != "staging" || app != "my-app-feature-x" {
+		return nil, nil
+	}
+	return f.release, nil
+}
+
+func (f *fakeDeployedReleases) Images(env string, app string) ([]string, error) {
+	return f.images, nil
+}
+
+func Test_resolveArtifactVars(t *testing.T) {
+	artifact := &Artifact{
+		Version: Version{
+			SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			Tag: "v1.2.3",
+		},
+		Context: map[string]string{
+			"BRANCH": "feature/x",
+		},
+		Items: []map[string]interface{}{
+			{
+				"image": map[string]interface{}{
+					"repository": "ghcr.io/gimlet-io/my-app",
+				},
+			},
+		},
+	}
+	deployed := &fakeDeployedReleases{
+		release: &Release{ArtifactID: "my-app-previous"},
+		images: []string{
+			"ghcr.io/gimlet-io/sidecar:v0.1.0",
+			"ghcr.io/gimlet-io/my-app:abc1234",
+		},
+	}
+
+	m := &Manifest{
+		App:       "my-app-{{ .BRANCH | sanitizeDNSName }}",
+		Env:       "staging",
+		Namespace: "my-namespace",
+		Values: map[string]interface{}{
+			"image":        "{{ (index .Items 0).image.repository }}:{{ .Version.SHA | shortSHA }}",
+			"previous":     `{{ lookupPreviousImage "ghcr.io/gimlet-io/my-app" }}`,
+			"notDeployed":  `{{ lookupPreviousImage "ghcr.io/gimlet-io/other" }}`,
+			"major":        "{{ (semver .Version.Tag).Major }}",
+			"env":          "{{ .Env }}",
+			"lastArtifact": "{{ .Release.ArtifactID }}",
+			"branch":       "{{ .Context.BRANCH }}",
+		},
+	}
+
+	err := m.ResolveArtifactVars(artifact, deployed)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-feature-x", m.App)
+	assert.Equal(t, "ghcr.io/gimlet-io/my-app:ea9ab7c", m.Values["image"])
+	assert.Equal(t, "ghcr.io/gimlet-io/my-app:abc1234", m.Values["previous"])
+	assert.Equal(t, "", m.Values["notDeployed"])
+	assert.Equal(t, "1", m.Values["major"])
+	assert.Equal(t, "staging", m.Values["env"])
+	assert.Equal(t, "my-app-previous", m.Values["lastArtifact"])
+	assert.Equal(t, "feature/x", m.Values["branch"])
+
+	m = &Manifest{
+		App: "my-app",
+		Env: "production",
+		Values: map[string]interface{}{
+			"firstDeploy": "{{ if .Release }}false{{ else }}true{{ end }}",
+		},
+	}
+	err = m.ResolveArtifactVars(artifact, deployed)
+	assert.Nil(t, err)
+	assert.Equal(t, "true", m.Values["firstDeploy"])
+}
+
+func Test_ResolveEnv(t *testing.T) {
+	artifact := &Artifact{
+		Context: map[string]string{
+			"BRANCH": "feature/x",
+		},
+	}
+
+	m := &Manifest{
+		Env: "preview-{{ .BRANCH | sanitizeDNSName }}",
+		App: "my-app-{{ .MISSING }}",
+	}
+	env, err := m.ResolveEnv(artifact)
+	assert.Nil(t, err, "should resolve only the env name")
+	assert.Equal(t, "preview-feature-x", env)
+	assert.Equal(t, "preview-{{ .BRANCH | sanitizeDNSName }}", m.Env, "should not modify the manifest")
+}
+
+func Test_resolveVars_envAccess(t *testing.T) {
+	t.Setenv("GIMLET_TEST_VAR", "x")
+
+	m := &Manifest{
+		App: `my-app-{{ env "GIMLET_TEST_VAR" }}`,
+	}
+	err := m.ResolveVars(map[string]string{})
+	assert.NotNil(t, err, "templates must not read the environment")
+
+	c := &Cleanup{
+		AppToCleanup: `my-app-{{ expandenv "$GIMLET_TEST_VAR" }}`,
+	}
+	err = c.ResolveVars(map[string]string{})
+	assert.NotNil(t, err, "cleanup policies must not read the environment")
+
+	c = &Cleanup{
+		AppToCleanup: `my-app-{{ getHostByName "localhost" }}`,
+	}
+	err = c.ResolveVars(map[string]string{})
+	assert.NotNil(t, err, "cleanup policies must not use the network")
+
+	m = &Manifest{
+		App: `my-app-{{ env "GIMLET_TEST_VAR" }}`,
+	}
+	err = m.ResolveArtifactVars(&Artifact{}, nil)
+	assert.NotNil(t, err, "artifact templates must not read the environment")
+}
+
+func Test_cleanupResolveVars(t *testing.T) {
+	c := &Cleanup{
+		AppToCleanup: "my-app-{{ .BRANCH | sanitizeDNSName }}-{{ .SHA | shortSHA }}",
+	}
+
+	err := c.ResolveVars(map[string]string{
+		"BRANCH": "feature/x",
+		"SHA":    "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-feature-x-ea9ab7c", c.AppToCleanup)
+}
@@ -0,0 +1,107 @@
+package dx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+const ociScheme = "oci://"
+
+// registryConfigFile is where Helm's registry client reads the credentials from, `helm registry login` writes it too
+const registryConfigFile = "registry.json"
+
+// ChartRegistry is the access configuration of an OCI chart registry.
+// Registries on localhost are accessed over http, all others over https
+type ChartRegistry struct {
+	Username string
+	Password string
+}
+
+func isOCI(chartName string) bool {
+	return strings.HasPrefix(chartName, ociScheme)
+}
+
+// LoginChartRegistries points Helm's config home to a directory owned by GimletD,
+// then writes the credentials of OCI chart registries by registry host in Helm's registry config,
+// the same way `helm registry login` does. The config is rewritten on every start, so removed registries don't linger
+func LoginChartRegistries(helmConfigHome string, registries map[string]ChartRegistry) error {
+	err := os.MkdirAll(helmConfigHome, 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %s", helmConfigHome, err)
+	}
+	err = os.Setenv("HELM_CONFIG_HOME", helmConfigHome)
+	if err != nil {
+		return err
+	}
+
+	auths := map[string]interface{}{}
+	for host, registry := range registries {
+		auths[host] = map[string]string{
+			"auth": base64.StdEncoding.EncodeToString([]byte(registry.Username + ":" + registry.Password)),
+		}
+	}
+	configBytes, err := json.MarshalIndent(map[string]interface{}{"auths": auths}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	configPath := helmpath.ConfigPath(registryConfigFile)
+	err = os.MkdirAll(filepath.Dir(configPath), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(configPath, configBytes, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %s", configPath, err)
+	}
+	return os.Chmod(configPath, 0600)
+}
+
+// pullOCIChart downloads the chart archive from an OCI registry to the Helm repository cache,
+// with Helm's registry client that verifies the digests of the pulled layers
+func pullOCIChart(m *Manifest) (string, error) {
+	if m.Chart.Version == "" {
+		return "", fmt.Errorf("version is required for OCI charts")
+	}
+
+	ref := strings.TrimPrefix(m.Chart.Name, ociScheme)
+	if !strings.Contains(ref, "/") {
+		return "", fmt.Errorf("invalid OCI chart reference %s, use the oci://registry/repository format", m.Chart.Name)
+	}
+
+	ociGetter, err := getter.NewOCIGetter()
+	if err != nil {
+		return "", fmt.Errorf("cannot create registry client: %s", err)
+	}
+	archive, err := ociGetter.Get(m.Chart.Name, getter.WithTagName(m.Chart.Version))
+	if err != nil {
+		return "", fmt.Errorf("cannot pull chart %s:%s: %s", m.Chart.Name, m.Chart.Version, err)
+	}
+
+	archivePath := ociCachePath(helmCLI.New().RepositoryCache, ref, m.Chart.Version)
+	err = os.MkdirAll(filepath.Dir(archivePath), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(archivePath, archive.Bytes(), 0644)
+	if err != nil {
+		return "", fmt.Errorf("cannot write chart: %s", err)
+	}
+	return archivePath, nil
+}
+
+// ociCachePath keys the cached archive by the full chart reference,
+// so charts of the same name from different registries or repositories don't overwrite each other
+func ociCachePath(repositoryCache string, ref string, version string) string {
+	ref = strings.ReplaceAll(ref, ":", "_") // registry ports
+	return filepath.Join(repositoryCache, "oci", filepath.FromSlash(ref), version+".tgz")
+}
@@ -0,0 +1,147 @@
+package dx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// ociRegistry is a registry stand-in that serves a single chart behind basic authentication
+func ociRegistry(t *testing.T, archive []byte) *httptest.Server {
+	blobs := map[string][]byte{}
+	descriptor := func(mediaType string, content []byte) map[string]interface{} {
+		hash := sha256.Sum256(content)
+		digest := "sha256:" + hex.EncodeToString(hash[:])
+		blobs[digest] = content
+		return map[string]interface{}{"mediaType": mediaType, "digest": digest, "size": len(content)}
+	}
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config":        descriptor("application/vnd.cncf.helm.config.v1+json", []byte(`{"name":"my-chart","version":"0.1.0"}`)),
+		"layers": []interface{}{
+			descriptor("application/vnd.cncf.helm.chart.content.v1.tar+gzip", archive),
+		},
+	})
+	hash := sha256.Sum256(manifest)
+	manifestDigest := "sha256:" + hex.EncodeToString(hash[:])
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "gimlet" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/charts/my-chart/manifests/0.1.0" ||
+			r.URL.Path == "/v2/charts/my-chart/manifests/"+manifestDigest:
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Header().Set("Content-Length", fmt.Sprint(len(manifest)))
+			if r.Method != http.MethodHead {
+				w.Write(manifest)
+			}
+		case strings.HasPrefix(r.URL.Path, "/v2/charts/my-chart/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/charts/my-chart/blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func Test_HelmTemplateOCIChart(t *testing.T) {
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	chartDir := t.TempDir()
+	chartPath, _ := chartutil.Create("my-chart", chartDir)
+	archivePath, err := chartutil.Save(mustLoadChart(t, chartPath), chartDir)
+	assert.Nil(t, err)
+	archive, _ := ioutil.ReadFile(archivePath)
+
+	server := ociRegistry(t, archive)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	m := &Manifest{
+		App:       "my-app",
+		Namespace: "default",
+		Chart: Chart{
+			Name:    "oci://" + host + "/charts/my-chart",
+			Version: "0.1.0",
+		},
+	}
+
+	helmConfigHome := os.Getenv("HELM_CONFIG_HOME")
+	err = LoginChartRegistries(helmConfigHome, map[string]ChartRegistry{
+		host: {Username: "gimlet", Password: "wrong"},
+	})
+	assert.Nil(t, err)
+	_, err = HelmTemplate(m)
+	assert.NotNil(t, err, "should not pull with wrong credentials")
+
+	err = LoginChartRegistries(helmConfigHome, map[string]ChartRegistry{
+		host: {Username: "gimlet", Password: "secret"},
+	})
+	assert.Nil(t, err)
+	templated, err := HelmTemplate(m)
+	assert.Nil(t, err)
+	assert.Contains(t, templated, "kind: Deployment")
+	assert.Contains(t, templated, "name: my-app-my-chart")
+
+	m.Chart.Version = "0.2.0"
+	_, err = HelmTemplate(m)
+	assert.NotNil(t, err, "should not find missing versions")
+}
+
+func Test_LoginChartRegistries(t *testing.T) {
+	t.Setenv("HELM_CONFIG_HOME", "")
+	helmConfigHome := filepath.Join(t.TempDir(), "helm")
+
+	err := LoginChartRegistries(helmConfigHome, map[string]ChartRegistry{
+		"registry.example.com": {Username: "gimlet", Password: "secret"},
+		"removed.example.com":  {Username: "gimlet", Password: "secret"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, helmConfigHome, os.Getenv("HELM_CONFIG_HOME"), "should use the config home of GimletD")
+
+	err = LoginChartRegistries(helmConfigHome, map[string]ChartRegistry{
+		"registry.example.com": {Username: "gimlet", Password: "secret"},
+	})
+	assert.Nil(t, err)
+
+	configPath := filepath.Join(helmConfigHome, registryConfigFile)
+	info, err := os.Stat(configPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	configBytes, _ := ioutil.ReadFile(configPath)
+	assert.Contains(t, string(configBytes), "registry.example.com")
+	assert.NotContains(t, string(configBytes), "removed.example.com", "should not keep registries that are no longer configured")
+}
+
+func Test_ociCachePath(t *testing.T) {
+	assert.NotEqual(t,
+		ociCachePath("/cache", "registry.example.com/team-a/my-chart", "0.1.0"),
+		ociCachePath("/cache", "registry.example.com/team-b/my-chart", "0.1.0"),
+		"charts of the same name from different repositories should not collide",
+	)
+	assert.Equal(t, "/cache/oci/localhost_5000/charts/my-chart/0.1.0.tgz", ociCachePath("/cache", "localhost:5000/charts/my-chart", "0.1.0"))
+}
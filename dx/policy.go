@@ -0,0 +1,311 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+const PolicyEnforce = "enforce"
+const PolicyWarn = "warn"
+
+const defaultSchemaLocation = "https://raw.githubusercontent.com/yannh/kubernetes-json-schema/master"
+
+// Policy validates the rendered manifests before they are written to the gitops repo
+type Policy struct {
+	// KubernetesVersion selects the Kubernetes JSON schemas that the manifests are validated against, eg.: 1.22.0
+	KubernetesVersion string `yaml:"kubernetesVersion" json:"kubernetesVersion"`
+	// SchemaLocation is the url or local directory of the schemas, in the yannh/kubernetes-json-schema layout
+	SchemaLocation string `yaml:"schemaLocation" json:"schemaLocation"`
+	// Envs are evaluated in order, the first one that matches the env applies
+	Envs []EnvPolicy `yaml:"envs" json:"envs"`
+
+	schemas    map[string]*gojsonschema.Schema
+	schemaLock sync.Mutex
+}
+
+// EnvPolicy holds the rules of the envs that match the Env glob pattern
+type EnvPolicy struct {
+	Env string `yaml:"env" json:"env"`
+	// Mode is enforce to fail the deploy on violations, or warn to only report them
+	Mode  string      `yaml:"mode" json:"mode"`
+	Rules PolicyRules `yaml:"rules" json:"rules"`
+}
+
+type PolicyRules struct {
+	// KubernetesSchemas validates the manifests against the Kubernetes JSON schemas
+	KubernetesSchemas     bool `yaml:"kubernetesSchemas" json:"kubernetesSchemas"`
+	NoLatestTag           bool `yaml:"noLatestTag" json:"noLatestTag"`
+	RequireResourceLimits bool `yaml:"requireResourceLimits" json:"requireResourceLimits"`
+	NoPrivileged          bool `yaml:"noPrivileged" json:"noPrivileged"`
+}
+
+// PolicyViolations is the readable report of a failed policy validation
+type PolicyViolations struct {
+	Env        string
+	App        string
+	Violations []string
+}
+
+func (v *PolicyViolations) Error() string {
+	return fmt.Sprintf("policy violations in %s/%s:\n- %s", v.Env, v.App, strings.Join(v.Violations, "\n- "))
+}
+
+// LoadPolicy reads the policy from a yaml file
+func LoadPolicy(policyPath string) (*Policy, error) {
+	policyBytes, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy: %s", err)
+	}
+
+	var policy Policy
+	err = yaml.UnmarshalStrict(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse policy: %s", err)
+	}
+
+	schemasRequired := false
+	for _, envPolicy := range policy.Envs {
+		schemasRequired = schemasRequired || envPolicy.Rules.KubernetesSchemas
+		if _, err := path.Match(envPolicy.Env, ""); err != nil {
+			return nil, fmt.Errorf("invalid env pattern in policy: %s", envPolicy.Env)
+		}
+		if envPolicy.Mode != PolicyEnforce && envPolicy.Mode != PolicyWarn {
+			return nil, fmt.Errorf("invalid policy mode %s for %s, use %s or %s", envPolicy.Mode, envPolicy.Env, PolicyEnforce, PolicyWarn)
+		}
+		if envPolicy.Rules.KubernetesSchemas && policy.KubernetesVersion == "" {
+			return nil, fmt.Errorf("kubernetesVersion is required to validate against Kubernetes schemas")
+		}
+	}
+
+	schemaDir := policy.schemaDir()
+	if schemasRequired && !remoteSchema(schemaDir) {
+		if _, err := os.Stat(filepath.FromSlash(schemaDir)); err != nil {
+			return nil, fmt.Errorf("cannot find the schemas of Kubernetes %s: %s", policy.KubernetesVersion, err)
+		}
+	}
+
+	return &policy, nil
+}
+
+// EnvPolicy returns the policy that applies to the env, or nil if the env has no policy
+func (p *Policy) EnvPolicy(env string) *EnvPolicy {
+	if p == nil {
+		return nil
+	}
+	for _, envPolicy := range p.Envs {
+		if matched, _ := path.Match(envPolicy.Env, env); matched {
+			return &envPolicy
+		}
+	}
+	return nil
+}
+
+// Validate checks the rendered manifests of an app against the rules of the env.
+// It returns the violations, or nil if the manifests comply
+func (p *Policy) Validate(env string, app string, manifests string) (*PolicyViolations, error) {
+	envPolicy := p.EnvPolicy(env)
+	if envPolicy == nil {
+		return nil, nil
+	}
+
+	var violations []string
+	decoder := yamlv3.NewDecoder(bytes.NewBufferString(manifests))
+	for {
+		var resource map[string]interface{}
+		err := decoder.Decode(&resource)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse manifests: %s", err)
+		}
+		if resource == nil {
+			continue
+		}
+
+		kind, _ := resource["kind"].(string)
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		resourceName := kind + "/" + name
+
+		if envPolicy.Rules.KubernetesSchemas {
+			schemaViolations, err := p.validateSchema(resource)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range schemaViolations {
+				violations = append(violations, fmt.Sprintf("%s: %s", resourceName, v))
+			}
+		}
+
+		for _, container := range containers(resource) {
+			containerName, _ := container["name"].(string)
+			image, _ := container["image"].(string)
+			if envPolicy.Rules.NoLatestTag && latestTag(image) {
+				violations = append(violations, fmt.Sprintf("%s: container %s uses the latest tag of %s", resourceName, containerName, image))
+			}
+			if envPolicy.Rules.RequireResourceLimits && !hasResourceLimits(container) {
+				violations = append(violations, fmt.Sprintf("%s: container %s has no resource limits", resourceName, containerName))
+			}
+			if envPolicy.Rules.NoPrivileged && privileged(container) {
+				violations = append(violations, fmt.Sprintf("%s: container %s is privileged", resourceName, containerName))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil, nil
+	}
+	return &PolicyViolations{
+		Env:        env,
+		App:        app,
+		Violations: violations,
+	}, nil
+}
+
+func (p *Policy) validateSchema(resource map[string]interface{}) ([]string, error) {
+	schema, err := p.schema(resource)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil { // custom resources have no schema
+		return nil, nil
+	}
+
+	result, err := schema.Validate(gojsonschema.NewGoLoader(resource))
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate against schema: %s", err)
+	}
+
+	var violations []string
+	for _, e := range result.Errors() {
+		violations = append(violations, e.String())
+	}
+	return violations, nil
+}
+
+// schema loads the Kubernetes JSON schema of the resource kind, or nil if there is none
+func (p *Policy) schema(resource map[string]interface{}) (*gojsonschema.Schema, error) {
+	kind, _ := resource["kind"].(string)
+	apiVersion, _ := resource["apiVersion"].(string)
+	if kind == "" || apiVersion == "" {
+		return nil, fmt.Errorf("resource without kind or apiVersion")
+	}
+
+	// eg.: deployment-apps-v1.json, service-v1.json
+	schemaFile := strings.ToLower(kind)
+	if strings.Contains(apiVersion, "/") {
+		groupVersion := strings.SplitN(apiVersion, "/", 2)
+		group := strings.Split(groupVersion[0], ".")[0]
+		schemaFile = fmt.Sprintf("%s-%s-%s", schemaFile, group, groupVersion[1])
+	} else {
+		schemaFile = fmt.Sprintf("%s-%s", schemaFile, apiVersion)
+	}
+	schemaFile = schemaFile + ".json"
+	schemaPath := p.schemaDir() + "/" + schemaFile
+
+	p.schemaLock.Lock()
+	defer p.schemaLock.Unlock()
+	if p.schemas == nil {
+		p.schemas = map[string]*gojsonschema.Schema{}
+	}
+	if schema, ok := p.schemas[schemaPath]; ok {
+		return schema, nil
+	}
+
+	schemaBytes, err := readSchema(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	var schema *gojsonschema.Schema
+	if schemaBytes != nil {
+		schema, err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schemaBytes))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse schema %s: %s", schemaPath, err)
+		}
+	}
+	p.schemas[schemaPath] = schema
+	return schema, nil
+}
+
+// schemaDir is the url or local directory of the schemas of the Kubernetes version
+func (p *Policy) schemaDir() string {
+	version := p.KubernetesVersion
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	location := p.SchemaLocation
+	if location == "" {
+		location = defaultSchemaLocation
+	}
+	return strings.TrimSuffix(location, "/") + "/" + version + "-standalone-strict"
+}
+
+func remoteSchema(schemaPath string) bool {
+	return strings.HasPrefix(schemaPath, "http://") || strings.HasPrefix(schemaPath, "https://")
+}
+
+// readSchema reads the schema from a url or a file, returns nil if the kind has no schema
+func readSchema(schemaPath string) ([]byte, error) {
+	if !remoteSchema(schemaPath) {
+		schemaBytes, err := ioutil.ReadFile(filepath.FromSlash(schemaPath))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read schema %s: %s", schemaPath, err)
+		}
+		return schemaBytes, nil
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schema %s: %s", schemaPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot get schema %s: %s", schemaPath, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// latestTag tells if the image refers to the latest tag, explicitly or by omitting the tag
+func latestTag(image string) bool {
+	if strings.Contains(image, "@") { // pinned to a digest
+		return false
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if !strings.Contains(name, ":") {
+		return true
+	}
+	return strings.HasSuffix(name, ":latest")
+}
+
+func hasResourceLimits(container map[string]interface{}) bool {
+	resources, _ := container["resources"].(map[string]interface{})
+	limits, _ := resources["limits"].(map[string]interface{})
+	return len(limits) > 0
+}
+
+func privileged(container map[string]interface{}) bool {
+	securityContext, _ := container["securityContext"].(map[string]interface{})
+	privileged, _ := securityContext["privileged"].(bool)
+	return privileged
+}
@@ -0,0 +1,148 @@
+package dx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const deploymentSchema = `{
+  "type": "object",
+  "required": ["apiVersion", "kind", "metadata", "spec"],
+  "properties": {
+    "spec": {
+      "type": "object",
+      "properties": {
+        "replicas": {"type": "integer"}
+      }
+    }
+  }
+}`
+
+const policyManifests = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  replicas: "2"
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: my-app:v1.0.0
+        resources:
+          limits:
+            memory: 200Mi
+      containers:
+      - name: app
+        image: registry.example.com:5000/my-app
+        securityContext:
+          privileged: true
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+spec:
+  type: ClusterIP
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-app
+`
+
+func Test_PolicyValidate(t *testing.T) {
+	dir := t.TempDir()
+	schemaDir := filepath.Join(dir, "v1.22.0-standalone-strict")
+	os.MkdirAll(schemaDir, 0755)
+	ioutil.WriteFile(filepath.Join(schemaDir, "deployment-apps-v1.json"), []byte(deploymentSchema), 0644)
+	ioutil.WriteFile(filepath.Join(schemaDir, "service-v1.json"), []byte(`{"type": "object"}`), 0644)
+
+	policyPath := filepath.Join(dir, "policy.yaml")
+	ioutil.WriteFile(policyPath, []byte(`
+kubernetesVersion: 1.22.0
+schemaLocation: `+dir+`
+envs:
+- env: production
+  mode: enforce
+  rules:
+    kubernetesSchemas: true
+    noLatestTag: true
+    requireResourceLimits: true
+    noPrivileged: true
+- env: "*"
+  mode: warn
+  rules:
+    noLatestTag: true
+`), 0644)
+
+	policy, err := LoadPolicy(policyPath)
+	assert.Nil(t, err)
+
+	violations, err := policy.Validate("production", "my-app", policyManifests)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"Deployment/my-app: spec.replicas: Invalid type. Expected: integer, given: string",
+		"Deployment/my-app: container app uses the latest tag of registry.example.com:5000/my-app",
+		"Deployment/my-app: container app has no resource limits",
+		"Deployment/my-app: container app is privileged",
+	}, violations.Violations)
+	assert.Contains(t, violations.Error(), "policy violations in production/my-app:\n- Deployment/my-app")
+
+	assert.Equal(t, PolicyWarn, policy.EnvPolicy("staging").Mode)
+	violations, err = policy.Validate("staging", "my-app", policyManifests)
+	assert.Nil(t, err)
+	assert.Len(t, violations.Violations, 1)
+
+	var noPolicy *Policy
+	violations, err = noPolicy.Validate("production", "my-app", policyManifests)
+	assert.Nil(t, err)
+	assert.Nil(t, violations)
+}
+
+func Test_LoadPolicy(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+
+	ioutil.WriteFile(policyPath, []byte(`
+envs:
+- env: production
+  mode: block
+`), 0644)
+	_, err := LoadPolicy(policyPath)
+	assert.NotNil(t, err, "should reject unknown modes")
+
+	ioutil.WriteFile(policyPath, []byte(`
+envs:
+- env: production
+  mode: enforce
+  rules:
+    kubernetesSchemas: true
+`), 0644)
+	_, err = LoadPolicy(policyPath)
+	assert.NotNil(t, err, "should require a Kubernetes version for schema validation")
+
+	ioutil.WriteFile(policyPath, []byte(`
+kubernetesVersion: 1.22.0
+schemaLocation: `+filepath.Dir(policyPath)+`
+envs:
+- env: production
+  mode: enforce
+  rules:
+    kubernetesSchemas: true
+`), 0644)
+	_, err = LoadPolicy(policyPath)
+	assert.NotNil(t, err, "should fail on a missing schema version directory")
+}
+
+func Test_latestTag(t *testing.T) {
+	assert.True(t, latestTag("nginx"))
+	assert.True(t, latestTag("nginx:latest"))
+	assert.True(t, latestTag("localhost:5000/nginx"))
+	assert.False(t, latestTag("localhost:5000/nginx:1.21"))
+	assert.False(t, latestTag("nginx@sha256:4a1c4b21597c1b4415bdbecb28a3296c6b5e23ca4f9feeb599860a1dac6a0108"))
+}
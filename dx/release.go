@@ -8,7 +8,8 @@ type Release struct {
 	ArtifactID  string `json:"artifactId"`
 	TriggeredBy string `json:"triggeredBy"`
 
-	Version *Version `json:"version"`
+	Version    *Version    `json:"version"`
+	Provenance *Provenance `json:"provenance,omitempty"`
 
 	GitopsRef  string `json:"gitopsRef"`
 	GitopsRepo string `json:"gitopsRepo"`
@@ -25,6 +26,12 @@ type ReleaseRequest struct {
 	TriggeredBy string `json:"triggeredBy"`
 }
 
+// BatchReleaseRequest releases several artifacts and apps in a single gitops commit
+type BatchReleaseRequest struct {
+	Releases    []ReleaseRequest `json:"releases"`
+	TriggeredBy string           `json:"triggeredBy"`
+}
+
 // RollbackRequest contains all metadata about the rollback intent
 type RollbackRequest struct {
 	Env         string `json:"env"`
@@ -40,8 +47,27 @@ type GitopsStatus struct {
 	StatusDesc string `json:"statusDesc,omitempty"`
 }
 
+// Deployment holds where and when an artifact was rolled out, and the Flux status of it
+type Deployment struct {
+	Env              string `json:"env"`
+	App              string `json:"app"`
+	GitopsRef        string `json:"gitopsRef"`
+	GitopsStatus     string `json:"gitopsStatus,omitempty"`
+	GitopsStatusDesc string `json:"gitopsStatusDesc,omitempty"`
+	TriggeredBy      string `json:"triggeredBy"`
+	Created          int64  `json:"created"`
+}
+
 type ReleaseStatus struct {
 	Status       string         `json:"status"`
 	StatusDesc   string         `json:"statusDesc"`
 	GitopsHashes []GitopsStatus `json:"gitopsHashes"`
 }
+
+// EventUpdate is streamed to clients when an event or a gitops commit changes state
+type EventUpdate struct {
+	EventID       string         `json:"eventId,omitempty"`
+	Envs          []string       `json:"envs,omitempty"`
+	ReleaseStatus *ReleaseStatus `json:"releaseStatus,omitempty"`
+	GitopsCommit  *GitopsStatus  `json:"gitopsCommit,omitempty"`
+}
@@ -0,0 +1,261 @@
+package dx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"go.mozilla.org/sops/v3"
+	sopsaes "go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/pgp"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	sopsversion "go.mozilla.org/sops/v3/version"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// secretEncryptedRegex limits the encryption to the data fields of Secrets
+const secretEncryptedRegex = "^(data|stringData)$"
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// SecretEncryption encrypts the Kubernetes Secrets of the rendered manifests in the SOPS format,
+// with the age and PGP keys of the env
+type SecretEncryption struct {
+	ageRecipients map[string][]string
+	pgpKeys       map[string]openpgp.EntityList
+	protectedEnvs []string
+}
+
+// NewSecretEncryption parses the age recipients and the armored PGP public key files, both by env.
+// Protected envs refuse to commit Secrets in plain text, they are glob patterns like the envs of the policy
+func NewSecretEncryption(
+	ageRecipients map[string][]string,
+	pgpKeyPaths map[string][]string,
+	protectedEnvs []string,
+) (*SecretEncryption, error) {
+	s := &SecretEncryption{
+		ageRecipients: map[string][]string{},
+		pgpKeys:       map[string]openpgp.EntityList{},
+		protectedEnvs: protectedEnvs,
+	}
+
+	for _, pattern := range protectedEnvs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected env pattern %s: %s", pattern, err)
+		}
+	}
+
+	for env, recipients := range ageRecipients {
+		for _, r := range recipients {
+			recipient := strings.TrimSpace(r)
+			_, err := sopsage.MasterKeyFromRecipient(recipient)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient for %s: %s", env, err)
+			}
+			s.ageRecipients[env] = append(s.ageRecipients[env], recipient)
+		}
+	}
+
+	for env, keyPaths := range pgpKeyPaths {
+		for _, keyPath := range keyPaths {
+			keyBytes, err := ioutil.ReadFile(keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read PGP key of %s: %s", env, err)
+			}
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyBytes))
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse PGP key of %s: %s", env, err)
+			}
+			s.pgpKeys[env] = append(s.pgpKeys[env], entities...)
+		}
+	}
+
+	return s, nil
+}
+
+// isProtected tells if the env refuses plain text Secrets
+func (s *SecretEncryption) isProtected(env string) bool {
+	if s == nil {
+		return false
+	}
+	for _, pattern := range s.protectedEnvs {
+		if matched, _ := path.Match(pattern, env); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypt encrypts the Secrets in the manifest files of the env. Other resources are left untouched.
+// It fails if a protected env has a plain text Secret that it has no keys to encrypt with
+func (s *SecretEncryption) Encrypt(env string, files map[string]string) (map[string]string, error) {
+	if s == nil {
+		return files, nil
+	}
+
+	hasKeys := len(s.ageRecipients[env]) > 0 || len(s.pgpKeys[env]) > 0
+	protected := s.isProtected(env)
+
+	encryptedFiles := map[string]string{}
+	for fileName, content := range files {
+		documents := yamlDocumentSeparator.Split(content, -1)
+		changed := false
+		for i, document := range documents {
+			var doc yamlv3.Node
+			err := yamlv3.Unmarshal([]byte(document), &doc)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %s", fileName, err)
+			}
+			if !plainSecret(&doc) {
+				continue
+			}
+
+			if !hasKeys {
+				if protected {
+					return nil, fmt.Errorf("%s is protected, refusing to commit the plain text Secret %s, configure encryption keys for the env", env, resourceName(&doc))
+				}
+				continue
+			}
+
+			encrypted, err := s.encryptDocument(env, &doc)
+			if err != nil {
+				return nil, fmt.Errorf("cannot encrypt Secret %s: %s", resourceName(&doc), err)
+			}
+			documents[i] = "\n" + encrypted
+			changed = true
+		}
+
+		if changed {
+			encryptedFiles[fileName] = strings.Join(documents, "---")
+		} else {
+			encryptedFiles[fileName] = content
+		}
+	}
+
+	return encryptedFiles, nil
+}
+
+// plainSecret tells if the document is a Secret without SOPS metadata
+func plainSecret(doc *yamlv3.Node) bool {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return false
+	}
+	resource := doc.Content[0]
+	return mappingValue(resource, "kind") != nil &&
+		mappingValue(resource, "kind").Value == "Secret" &&
+		mappingValue(resource, "sops") == nil
+}
+
+func resourceName(doc *yamlv3.Node) string {
+	metadata := mappingValue(doc.Content[0], "metadata")
+	if metadata == nil || mappingValue(metadata, "name") == nil {
+		return ""
+	}
+	return mappingValue(metadata, "name").Value
+}
+
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// encryptDocument encrypts the data fields of the Secret the way the sops cli does with --encrypted-regex
+func (s *SecretEncryption) encryptDocument(env string, doc *yamlv3.Node) (string, error) {
+	plain, err := yamlv3.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	store := &sopsyaml.Store{}
+	branches, err := store.LoadPlainFile(plain)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	var keyGroup sops.KeyGroup
+	for _, recipient := range s.ageRecipients[env] {
+		key, err := sopsage.MasterKeyFromRecipient(recipient)
+		if err != nil {
+			return "", err
+		}
+		err = key.Encrypt(dataKey)
+		if err != nil {
+			return "", err
+		}
+		keyGroup = append(keyGroup, key)
+	}
+	for _, entity := range s.pgpKeys[env] {
+		enc, err := pgpEncrypt(dataKey, entity)
+		if err != nil {
+			return "", err
+		}
+		keyGroup = append(keyGroup, &pgp.MasterKey{
+			Fingerprint:  fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+			EncryptedKey: enc,
+			CreationDate: time.Now().UTC(),
+		})
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:      []sops.KeyGroup{keyGroup},
+			EncryptedRegex: secretEncryptedRegex,
+			Version:        sopsversion.Version,
+		},
+	}
+	cipher := sopsaes.NewCipher()
+	mac, err := tree.Encrypt(dataKey, cipher)
+	if err != nil {
+		return "", err
+	}
+	tree.Metadata.LastModified = time.Now().UTC()
+	tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+func pgpEncrypt(dataKey []byte, entity *openpgp.Entity) (string, error) {
+	var buffer bytes.Buffer
+	armorWriter, err := pgparmor.Encode(&buffer, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", err
+	}
+	w, err := openpgp.Encrypt(armorWriter, openpgp.EntityList{entity}, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := armorWriter.Close(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
@@ -0,0 +1,158 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"go.mozilla.org/sops/v3/decrypt"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const secretManifests = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app
+data:
+  LOG_LEVEL: debug
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-app
+  labels:
+    app: my-app
+type: Opaque
+stringData:
+  DB_PASSWORD: s3cret
+  RETRIES: 3
+`
+
+func Test_SecretEncryptionAge(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	ioutil.WriteFile(keyFile, []byte(identity.String()), 0600)
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+
+	secretEncryption, err := NewSecretEncryption(
+		map[string][]string{"production": {identity.Recipient().String()}},
+		map[string][]string{},
+		[]string{},
+	)
+	assert.Nil(t, err)
+
+	files, err := secretEncryption.Encrypt("production", map[string]string{"manifests.yaml": secretManifests})
+	assert.Nil(t, err)
+	encrypted := files["manifests.yaml"]
+	assert.Contains(t, encrypted, "LOG_LEVEL: debug", "should leave other resources untouched")
+	assert.NotContains(t, encrypted, "s3cret")
+
+	secret := secretDocument(t, encrypted)
+	ageKey := mappingValue(mappingValue(secret, "sops"), "age").Content[0]
+	assert.Equal(t, identity.Recipient().String(), mappingValue(ageKey, "recipient").Value)
+	assert.Equal(t, "my-app", mappingValue(mappingValue(mappingValue(secret, "metadata"), "labels"), "app").Value, "should only encrypt the data fields")
+
+	decrypted := sopsDecrypt(t, encrypted)
+	assert.Equal(t, "s3cret", mappingValue(mappingValue(decrypted, "stringData"), "DB_PASSWORD").Value)
+	assert.Equal(t, "3", mappingValue(mappingValue(decrypted, "stringData"), "RETRIES").Value)
+
+	files, err = secretEncryption.Encrypt("production", files)
+	assert.Nil(t, err)
+	assert.Equal(t, encrypted, files["manifests.yaml"], "should not encrypt twice")
+}
+
+func Test_SecretEncryptionPGP(t *testing.T) {
+	entity, _ := openpgp.NewEntity("gimlet", "", "gimlet@example.com", nil)
+	var publicKey bytes.Buffer
+	w, _ := pgparmor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	entity.Serialize(w)
+	w.Close()
+	keyPath := filepath.Join(t.TempDir(), "key.asc")
+	ioutil.WriteFile(keyPath, publicKey.Bytes(), 0644)
+
+	gnupgHome := t.TempDir()
+	var secring bytes.Buffer
+	entity.SerializePrivate(&secring, nil)
+	ioutil.WriteFile(filepath.Join(gnupgHome, "secring.gpg"), secring.Bytes(), 0600)
+	t.Setenv("GNUPGHOME", gnupgHome)
+
+	secretEncryption, err := NewSecretEncryption(
+		map[string][]string{},
+		map[string][]string{"production": {keyPath}},
+		[]string{},
+	)
+	assert.Nil(t, err)
+
+	files, err := secretEncryption.Encrypt("production", map[string]string{"manifests.yaml": secretManifests})
+	assert.Nil(t, err)
+
+	secret := secretDocument(t, files["manifests.yaml"])
+	pgpKey := mappingValue(mappingValue(secret, "sops"), "pgp").Content[0]
+	assert.Equal(t, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), mappingValue(pgpKey, "fp").Value)
+
+	decrypted := sopsDecrypt(t, files["manifests.yaml"])
+	assert.Equal(t, "s3cret", mappingValue(mappingValue(decrypted, "stringData"), "DB_PASSWORD").Value)
+}
+
+func Test_SecretEncryptionProtectedEnvs(t *testing.T) {
+	secretEncryption, err := NewSecretEncryption(map[string][]string{}, map[string][]string{}, []string{"production"})
+	assert.Nil(t, err)
+
+	_, err = secretEncryption.Encrypt("production", map[string]string{"manifests.yaml": secretManifests})
+	assert.NotNil(t, err, "should refuse plain text secrets in protected envs")
+
+	files, err := secretEncryption.Encrypt("staging", map[string]string{"manifests.yaml": secretManifests})
+	assert.Nil(t, err)
+	assert.Equal(t, secretManifests, files["manifests.yaml"])
+}
+
+func Test_SecretEncryptionProtectedEnvGlobs(t *testing.T) {
+	_, err := NewSecretEncryption(map[string][]string{}, map[string][]string{}, []string{"production-["})
+	assert.NotNil(t, err, "should reject malformed patterns")
+
+	secretEncryption, err := NewSecretEncryption(map[string][]string{}, map[string][]string{}, []string{"production-*"})
+	assert.Nil(t, err)
+
+	_, err = secretEncryption.Encrypt("production-eu", map[string]string{"manifests.yaml": secretManifests})
+	assert.NotNil(t, err, "should match protected envs as globs")
+
+	_, err = secretEncryption.Encrypt("production", map[string]string{"manifests.yaml": secretManifests})
+	assert.Nil(t, err)
+}
+
+func secretDocument(t *testing.T, manifests string) *yamlv3.Node {
+	for _, document := range yamlDocumentSeparator.Split(manifests, -1) {
+		var doc yamlv3.Node
+		err := yamlv3.Unmarshal([]byte(document), &doc)
+		assert.Nil(t, err)
+		if len(doc.Content) > 0 && mappingValue(doc.Content[0], "kind").Value == "Secret" {
+			return doc.Content[0]
+		}
+	}
+	t.Fatal("no Secret in manifests")
+	return nil
+}
+
+// sopsDecrypt decrypts the Secret of the manifests with sops, that also verifies the MAC
+func sopsDecrypt(t *testing.T, manifests string) *yamlv3.Node {
+	var secret string
+	for _, document := range yamlDocumentSeparator.Split(manifests, -1) {
+		if strings.Contains(document, "kind: Secret") {
+			secret = document
+		}
+	}
+
+	decrypted, err := decrypt.Data([]byte(secret), "yaml")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return secretDocument(t, string(decrypted))
+}
@@ -0,0 +1,67 @@
+package dx
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// SignatureHeader holds the base64 encoded detached signature of the artifact body on push
+const SignatureHeader = "X-Gimlet-Signature"
+
+const SignatureVerified = "verified"
+const SignatureUnsigned = "unsigned"
+
+// Provenance holds the signature verification result of an artifact
+type Provenance struct {
+	SignatureStatus string `json:"signatureStatus"`
+	KeyID           string `json:"keyId,omitempty"`
+	Verified        int64  `json:"verified,omitempty"`
+}
+
+func (p *Provenance) IsVerified() bool {
+	return p != nil && p.SignatureStatus == SignatureVerified
+}
+
+// SignArtifact returns the base64 encoded detached ed25519 signature of the serialized artifact
+func SignArtifact(privateKey ed25519.PrivateKey, artifactBytes []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, artifactBytes))
+}
+
+// VerifyArtifactSignature checks the detached signature against the given public keys
+// and returns the ID of the key that verified it
+func VerifyArtifactSignature(publicKeys []ed25519.PublicKey, artifactBytes []byte, signature string) (string, error) {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode signature: %s", err)
+	}
+
+	for _, publicKey := range publicKeys {
+		if ed25519.Verify(publicKey, artifactBytes, signatureBytes) {
+			return KeyID(publicKey), nil
+		}
+	}
+
+	return "", fmt.Errorf("signature does not match any of the keys configured for the repository")
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode public key: %s", err)
+	}
+	if len(keyBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key size: %d", len(keyBytes))
+	}
+
+	return ed25519.PublicKey(keyBytes), nil
+}
+
+// KeyID is a short fingerprint of the public key
+func KeyID(publicKey ed25519.PublicKey) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:8])
+}
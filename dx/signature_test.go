@@ -0,0 +1,33 @@
+package dx
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_verifyArtifactSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	anotherPublicKey, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+
+	parsedKey, err := ParsePublicKey(base64.StdEncoding.EncodeToString(publicKey))
+	assert.Nil(t, err)
+
+	artifactBytes := []byte(`{"version":{"repositoryName":"my-app","sha":"ea9ab7cc31b2599bf4afcfd639da516ca27a4780"}}`)
+	signature := SignArtifact(privateKey, artifactBytes)
+
+	keyID, err := VerifyArtifactSignature([]ed25519.PublicKey{anotherPublicKey, parsedKey}, artifactBytes, signature)
+	assert.Nil(t, err)
+	assert.Equal(t, KeyID(publicKey), keyID)
+
+	_, err = VerifyArtifactSignature([]ed25519.PublicKey{anotherPublicKey}, artifactBytes, signature)
+	assert.NotNil(t, err, "should not verify with a different key")
+
+	tamperedBytes := []byte(`{"version":{"repositoryName":"my-app","sha":"tampered"}}`)
+	_, err = VerifyArtifactSignature([]ed25519.PublicKey{parsedKey}, tamperedBytes, signature)
+	assert.NotNil(t, err, "should not verify a tampered artifact")
+}
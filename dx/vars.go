@@ -0,0 +1,102 @@
+package dx
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// DeployedReleases looks up what currently runs of an app in an env
+type DeployedReleases interface {
+	// Release returns the current release of the app, nil if the app is not deployed
+	Release(env string, app string) (*Release, error)
+	// Images returns the container images in the current manifests of the app.
+	// Envs that deploy HelmReleases have no rendered manifests in the gitops repo, so they have no images
+	Images(env string, app string) ([]string, error)
+}
+
+// TemplateVars returns the variables that manifests are templated with:
+// the flat artifact vars, eg.: {{ .GITHUB_SHA }}, and the structured .Version, .Items and .Context of the artifact
+func (a *Artifact) TemplateVars() map[string]interface{} {
+	vars := map[string]interface{}{}
+	for k, v := range a.Vars() {
+		vars[k] = v
+	}
+
+	vars["Version"] = a.Version
+	vars["Items"] = a.Items
+	vars["Context"] = a.Context
+	return vars
+}
+
+// templateFuncs are the functions of manifest templates.
+// previousImages lists the images that the app currently runs with, it is only called if the template uses them.
+// lookupPreviousImage returns an empty string if the app is not deployed yet, or if the env deploys HelmReleases
+// as Flux renders their charts in-cluster
+func templateFuncs(previousImages func() ([]string, error)) map[string]interface{} {
+	functions := make(map[string]interface{})
+	for k, v := range sprig.GenericFuncMap() {
+		functions[k] = v
+	}
+	// templates must not read the environment or the network of GimletD
+	delete(functions, "env")
+	delete(functions, "expandenv")
+	delete(functions, "getHostByName")
+
+	functions["sanitizeDNSName"] = sanitizeDNSName
+	functions["shortSHA"] = shortSHA
+	functions["lookupPreviousImage"] = func(repository string) (string, error) {
+		if previousImages == nil {
+			return "", nil
+		}
+		images, err := previousImages()
+		if err != nil {
+			return "", err
+		}
+		return lookupImage(images, repository), nil
+	}
+	return functions
+}
+
+// resolveString resolves a single manifest field
+func resolveString(field string, vars map[string]interface{}) (string, error) {
+	tpl, err := template.New("").
+		Option("missingkey=error").
+		Funcs(templateFuncs(nil)).
+		Parse(field)
+	if err != nil {
+		return "", err
+	}
+
+	var templated bytes.Buffer
+	err = tpl.Execute(&templated, vars)
+	return templated.String(), err
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// lookupImage returns the first image from the given repository, or an empty string
+func lookupImage(images []string, repository string) string {
+	for _, image := range images {
+		if imageRepository(image) == repository {
+			return image
+		}
+	}
+	return ""
+}
+
+// imageRepository strips the tag and the digest of the image
+func imageRepository(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	if lastColon := strings.LastIndex(image, ":"); lastColon > strings.LastIndex(image, "/") {
+		return image[:lastColon]
+	}
+	return image
+}
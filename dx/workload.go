@@ -0,0 +1,63 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ContainerImages returns the images of the containers in the manifests
+func ContainerImages(manifests string) ([]string, error) {
+	var images []string
+	decoder := yamlv3.NewDecoder(bytes.NewBufferString(manifests))
+	for {
+		var resource map[string]interface{}
+		err := decoder.Decode(&resource)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse manifests: %s", err)
+		}
+
+		for _, container := range containers(resource) {
+			if image, ok := container["image"].(string); ok {
+				images = append(images, image)
+			}
+		}
+	}
+	return images, nil
+}
+
+// containers returns the containers and init containers of pods and workload resources
+func containers(resource map[string]interface{}) []map[string]interface{} {
+	var podSpecPath []string
+	switch resource["kind"] {
+	case "Pod":
+		podSpecPath = []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		podSpecPath = []string{"spec", "template", "spec"}
+	case "CronJob":
+		podSpecPath = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil
+	}
+
+	podSpec := resource
+	for _, field := range podSpecPath {
+		podSpec, _ = podSpec[field].(map[string]interface{})
+	}
+
+	var containers []map[string]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := podSpec[field].([]interface{})
+		for _, c := range list {
+			if container, ok := c.(map[string]interface{}); ok {
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
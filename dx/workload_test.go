@@ -0,0 +1,30 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ContainerImages(t *testing.T) {
+	images, err := ContainerImages(policyManifests)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"my-app:v1.0.0", "registry.example.com:5000/my-app"}, images)
+
+	images, err = ContainerImages(`---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: my-job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: my-job:v2
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"my-job:v2"}, images)
+}
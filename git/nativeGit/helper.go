@@ -115,6 +115,26 @@ func NativeRevert(repoPath string, sha string) error {
 	return execCommand(repoPath, "git", "revert", sha)
 }
 
+// NativeRevertPath reverts the changes of the commit under the path, and leaves the rest of the repository as is.
+// Commits that changed several apps, eg.: batch releases, are only reverted for the given app
+func NativeRevertPath(repoPath string, sha string, path string) error {
+	err := execCommand(repoPath, "git", "rm", "-r", "-q", "--ignore-unmatch", "--", path)
+	if err != nil {
+		return err
+	}
+
+	existedBefore := execCommand(repoPath, "git", "cat-file", "-e", sha+"^:"+path) == nil
+	if existedBefore {
+		err = execCommand(repoPath, "git", "checkout", sha+"^", "--", path)
+		if err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("Revert %s in %s\n\nThis reverts commit %s.", sha[:7], path, sha)
+	return execCommand(repoPath, "git", "commit", "--allow-empty", "-m", message)
+}
+
 func NativePush(repoPath string, privateKeyPath string, branch string) error {
 	sshCommand := fmt.Sprintf("ssh -i %s", privateKeyPath)
 	err := execCommand(repoPath, "git", "config", "core.sshCommand", sshCommand)
@@ -181,7 +201,11 @@ func DelDir(repo *git.Repository, path string) error {
 
 	for _, file := range files {
 		if file.IsDir() {
-			DelDir(repo, file.Name())
+			err = DelDir(repo, filepath.Join(path, file.Name()))
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
 		_, err = worktree.Remove(filepath.Join(path, file.Name()))
@@ -195,6 +219,22 @@ func DelDir(repo *git.Repository, path string) error {
 	return err
 }
 
+// DelFile removes the file from the worktree and the index, if it exists
+func DelFile(repo *git.Repository, path string) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	_, err = worktree.Filesystem.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	_, err = worktree.Remove(path)
+	return err
+}
+
 func StageFolder(repo *git.Repository, folder string) error {
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -213,6 +253,20 @@ func CommitFilesToGit(
 	app string,
 	message string,
 	releaseString string,
+) (string, error) {
+	return CommitAppToGit(repo, files, nil, env, app, message, releaseString)
+}
+
+// CommitAppToGit writes the files of the app to env/app, and the env files, eg.: Flux resources of the app,
+// to their path relative to the repo root
+func CommitAppToGit(
+	repo *git.Repository,
+	files map[string]string,
+	envFiles map[string]string,
+	env string,
+	app string,
+	message string,
+	releaseString string,
 ) (string, error) {
 	empty, err := NothingToCommit(repo)
 	if err != nil {
@@ -222,20 +276,47 @@ func CommitFilesToGit(
 		return "", fmt.Errorf("there are staged changes in the gitops repo. Commit them first then try again")
 	}
 
+	err = StageApp(repo, files, envFiles, env, app, releaseString)
+	if err != nil {
+		return "", err
+	}
+
+	empty, err = NothingToCommit(repo)
+	if err != nil {
+		return "", err
+	}
+	if empty {
+		return "", nil
+	}
+
+	gitMessage := fmt.Sprintf("[Gimlet] %s/%s %s", env, app, message)
+	return Commit(repo, gitMessage)
+}
+
+// StageApp replaces the files of the app in env/app, writes the env files and the release metadata,
+// and stages them without committing
+func StageApp(
+	repo *git.Repository,
+	files map[string]string,
+	envFiles map[string]string,
+	env string,
+	app string,
+	releaseString string,
+) error {
 	w, err := repo.Worktree()
 	if err != nil {
-		return "", fmt.Errorf("cannot get worktree %s", err)
+		return fmt.Errorf("cannot get worktree %s", err)
 	}
 
 	// first delete, then recreate app dir
 	// to remove stale template files
 	err = DelDir(repo, filepath.Join(env, app))
 	if err != nil {
-		return "", fmt.Errorf("cannot del dir: %s", err)
+		return fmt.Errorf("cannot del dir: %s", err)
 	}
 	err = w.Filesystem.MkdirAll(filepath.Join(env, app), Dir_RWX_RX_R)
 	if err != nil {
-		return "", fmt.Errorf("cannot create dir %s", err)
+		return fmt.Errorf("cannot create dir %s", err)
 	}
 
 	for path, content := range files {
@@ -243,9 +324,24 @@ func CommitFilesToGit(
 			content = content + "\n"
 		}
 
-		err = stageFile(w, content, filepath.Join(env, app, filepath.Base(path)))
+		filePath, err := pathInFolder(filepath.Join(env, app), path)
 		if err != nil {
-			return "", fmt.Errorf("cannot stage file %s", err)
+			return err
+		}
+		err = stageFile(w, content, filePath)
+		if err != nil {
+			return fmt.Errorf("cannot stage file %s", err)
+		}
+	}
+
+	for path, content := range envFiles {
+		filePath, err := pathInFolder(".", path)
+		if err != nil {
+			return err
+		}
+		err = stageFile(w, content, filePath)
+		if err != nil {
+			return fmt.Errorf("cannot stage file %s", err)
 		}
 	}
 
@@ -255,27 +351,31 @@ func CommitFilesToGit(
 		}
 		err = stageFile(w, releaseString, filepath.Join(env, "release.json"))
 		if err != nil {
-			return "", fmt.Errorf("cannot stage file %s", err)
+			return fmt.Errorf("cannot stage file %s", err)
 		}
 		err = stageFile(w, releaseString, filepath.Join(env, app, "release.json"))
 		if err != nil {
-			return "", fmt.Errorf("cannot stage file %s", err)
+			return fmt.Errorf("cannot stage file %s", err)
 		}
 	}
 
-	empty, err = NothingToCommit(repo)
-	if err != nil {
-		return "", err
-	}
-	if empty {
-		return "", nil
-	}
+	return nil
+}
 
-	gitMessage := fmt.Sprintf("[Gimlet] %s/%s %s", env, app, message)
-	return Commit(repo, gitMessage)
+// pathInFolder joins the relative path to the folder, and refuses paths that point out of the folder
+func pathInFolder(folder string, path string) (string, error) {
+	relativePath := filepath.Clean(path)
+	if filepath.IsAbs(relativePath) || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file path %s, it points out of %s", path, folder)
+	}
+	return filepath.Join(folder, relativePath), nil
 }
 
 func stageFile(worktree *git.Worktree, content string, path string) error {
+	err := worktree.Filesystem.MkdirAll(filepath.Dir(path), Dir_RWX_RX_R)
+	if err != nil {
+		return err
+	}
 	createdFile, err := worktree.Filesystem.Create(path)
 	if err != nil {
 		return err
@@ -326,6 +426,38 @@ func Content(repo *git.Repository, path string) (string, error) {
 	return string(content), nil
 }
 
+// Tree returns the file contents of a folder and its subfolders, keyed by the path relative to the folder
+func Tree(repo *git.Repository, path string) (map[string]string, error) {
+	files, err := Folder(repo, path)
+	if err != nil {
+		return files, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return files, err
+	}
+	fileInfos, err := worktree.Filesystem.ReadDir(path)
+	if err != nil {
+		return files, err
+	}
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() {
+			continue
+		}
+
+		subfolderFiles, err := Tree(repo, filepath.Join(path, fileInfo.Name()))
+		if err != nil {
+			return files, err
+		}
+		for name, content := range subfolderFiles {
+			files[filepath.Join(fileInfo.Name(), name)] = content
+		}
+	}
+
+	return files, nil
+}
+
 // Folder returns the file contents of a folder (non-recursive)
 func Folder(repo *git.Repository, path string) (map[string]string, error) {
 	files := map[string]string{}
@@ -401,13 +533,10 @@ func Releases(
 			return nil
 		}
 
-		releaseFile, err := c.File(env + "/release.json")
+		releaseFile, err := releaseFile(c, env, app)
 		if err != nil {
-			releaseFile, err = c.File(path + "/release.json")
-			if err != nil {
-				logrus.Debugf("no release file for %s: %s", c.Hash.String(), err)
-				return nil
-			}
+			logrus.Debugf("no release file for %s: %s", c.Hash.String(), err)
+			return nil
 		}
 
 		buf := new(bytes.Buffer)
@@ -458,6 +587,18 @@ func Releases(
 	return releases, nil
 }
 
+// releaseFile returns the release metadata of the commit. The app's release.json is preferred,
+// as commits of batch releases write several apps, and env/release.json only holds the last one
+func releaseFile(c *object.Commit, env string, app string) (*object.File, error) {
+	if app != "" {
+		file, err := c.File(env + "/" + app + "/release.json")
+		if err == nil {
+			return file, nil
+		}
+	}
+	return c.File(env + "/release.json")
+}
+
 func Status(
 	repo *git.Repository,
 	app, env string,
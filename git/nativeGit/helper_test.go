@@ -53,6 +53,45 @@ func Test_Status(t *testing.T) {
 	assert.Equal(t, 2, len(status), "should get release status for all apps")
 }
 
+func Test_CommitAppToGit(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+
+	_, err := CommitAppToGit(
+		repo,
+		map[string]string{
+			"onechart/templates/deployment.yaml": "deployment",
+		},
+		map[string]string{
+			"staging/flux/kustomization-my-app.yaml": "kustomization",
+		},
+		"staging",
+		"my-app",
+		"1st commit",
+		"{}",
+	)
+	assert.Nil(t, err)
+	content, _ := Content(repo, "staging/my-app/onechart/templates/deployment.yaml")
+	assert.Equal(t, "deployment\n", content)
+	content, _ = Content(repo, "staging/flux/kustomization-my-app.yaml")
+	assert.Equal(t, "kustomization", content)
+	files, err := Tree(repo, "staging/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files), "should read the files of subfolders")
+
+	_, err = CommitAppToGit(repo, map[string]string{"deployment.yaml": "deployment"}, nil, "staging", "my-app", "2nd commit", "{}")
+	assert.Nil(t, err)
+	content, _ = Content(repo, "staging/my-app/onechart/templates/deployment.yaml")
+	assert.Equal(t, "", content, "should delete stale files in subfolders")
+
+	_, err = CommitAppToGit(repo, map[string]string{"../release.json": "{}"}, nil, "staging", "my-app", "3rd commit", "{}")
+	assert.NotNil(t, err, "should not write out of the app folder")
+
+	err = DelFile(repo, "staging/flux/kustomization-my-app.yaml")
+	assert.Nil(t, err)
+	content, _ = Content(repo, "staging/flux/kustomization-my-app.yaml")
+	assert.Equal(t, "", content)
+}
+
 func initHistory() *git.Repository {
 	repo, _ := git.Init(memory.NewStorage(), memfs.New())
 
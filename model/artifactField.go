@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gimlet-io/gimletd/dx"
+)
+
+// ArtifactField is a searchable, flattened field of an artifact
+type ArtifactField struct {
+	ID      int64  `json:"-"  meddler:"id,pk"`
+	EventID string `json:"eventId"  meddler:"event_id"`
+	Name    string `json:"name"  meddler:"name"`
+	Value   string `json:"value"  meddler:"value"`
+}
+
+// TextSearchFields are matched by free text artifact search
+var TextSearchFields = []string{"version.message", "version.authorName", "version.authorEmail"}
+
+// ArtifactFields flattens the context, items and commit metadata of an artifact into searchable fields.
+// Context variables are indexed as context.<KEY>, item fields as item.<path>,
+// and items with a name field also as item.<name>.<path>, eg.: item.image.tag
+// Fields of different items may share a name, all their values are indexed
+func ArtifactFields(artifact *dx.Artifact) []*ArtifactField {
+	fields := map[ArtifactField]bool{}
+
+	for k, v := range artifact.Context {
+		fields[ArtifactField{Name: "context." + k, Value: v}] = true
+	}
+
+	for _, item := range artifact.Items {
+		flatten(fields, "item", item)
+		if name, ok := item["name"].(string); ok && name != "" {
+			flatten(fields, "item."+name, item)
+		}
+	}
+
+	if artifact.Version.Message != "" {
+		fields[ArtifactField{Name: "version.message", Value: artifact.Version.Message}] = true
+	}
+	if artifact.Version.AuthorName != "" {
+		fields[ArtifactField{Name: "version.authorName", Value: artifact.Version.AuthorName}] = true
+	}
+	if artifact.Version.AuthorEmail != "" {
+		fields[ArtifactField{Name: "version.authorEmail", Value: artifact.Version.AuthorEmail}] = true
+	}
+
+	var sorted []*ArtifactField
+	for field := range fields {
+		field := field
+		sorted = append(sorted, &field)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	return sorted
+}
+
+func flatten(fields map[ArtifactField]bool, prefix string, values map[string]interface{}) {
+	for k, v := range values {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flatten(fields, prefix+"."+k, value)
+		case []interface{}:
+			continue
+		case nil:
+			continue
+		default:
+			fields[ArtifactField{Name: prefix + "." + k, Value: fmt.Sprint(value)}] = true
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import "github.com/gimlet-io/gimletd/dx"
+
+// Deployment records a rollout of an artifact to an env
+type Deployment struct {
+	ID          int64  `json:"-"  meddler:"id,pk"`
+	ArtifactID  string `json:"artifactId"  meddler:"artifact_id"`
+	EventID     string `json:"eventId"  meddler:"event_id"`
+	Env         string `json:"env"  meddler:"env"`
+	App         string `json:"app"  meddler:"app"`
+	GitopsRef   string `json:"gitopsRef"  meddler:"gitops_ref"`
+	TriggeredBy string `json:"triggeredBy"  meddler:"triggered_by"`
+	Created     int64  `json:"created"  meddler:"created"`
+}
+
+func ToDeployment(d *Deployment, gitopsCommit *GitopsCommit) *dx.Deployment {
+	deployment := &dx.Deployment{
+		Env:          d.Env,
+		App:          d.App,
+		GitopsRef:    d.GitopsRef,
+		GitopsStatus: "N/A",
+		TriggeredBy:  d.TriggeredBy,
+		Created:      d.Created,
+	}
+
+	if gitopsCommit != nil {
+		deployment.GitopsStatus = gitopsCommit.Status
+		deployment.GitopsStatusDesc = gitopsCommit.StatusDesc
+	}
+
+	return deployment
+}
@@ -12,6 +12,7 @@ const StatusError = "error"
 
 const TypeArtifact = "artifact"
 const TypeRelease = "release"
+const TypeBatchRelease = "batchRelease"
 const TypeRollback = "rollback"
 const TypeBranchDeleted = "branchDeleted"
 
@@ -33,6 +34,9 @@ type Event struct {
 	Tag          string      `json:"tag,omitempty"  meddler:"tag"`
 	SHA          string      `json:"sha"  meddler:"sha"`
 	ArtifactID   string      `json:"artifactID"  meddler:"artifact_id"`
+
+	// IdempotencyKey deduplicates artifact pushes, see DefaultIdempotencyKey
+	IdempotencyKey string `json:"-"  meddler:"idempotency_key"`
 }
 
 func ToEvent(artifact dx.Artifact) (*Event, error) {
@@ -55,8 +59,31 @@ func ToEvent(artifact dx.Artifact) (*Event, error) {
 	}, nil
 }
 
+// DefaultIdempotencyKey identifies an artifact by the repository, SHA, git event and refs that produced it,
+// so CI retries for the same commit don't create a new artifact,
+// but the same commit on another branch or tag gets its own artifact and deploy policies
+func DefaultIdempotencyKey(artifact dx.Artifact) string {
+	return fmt.Sprintf("%s-%s-%s-%s-%s-%s-%s",
+		artifact.Version.RepositoryName,
+		artifact.Version.SHA,
+		artifact.Version.Event.String(),
+		artifact.Version.Branch,
+		artifact.Version.Tag,
+		artifact.Version.SourceBranch,
+		artifact.Version.TargetBranch,
+	)
+}
+
+// ClientIdempotencyKey scopes the idempotency key sent by the client to the repository of the artifact
+func ClientIdempotencyKey(artifact dx.Artifact, key string) string {
+	return fmt.Sprintf("%s-client-%s", artifact.Version.RepositoryName, key)
+}
+
 func ToArtifact(a *Event) (*dx.Artifact, error) {
 	var artifact dx.Artifact
-	json.Unmarshal([]byte(a.Blob), &artifact)
+	err := json.Unmarshal([]byte(a.Blob), &artifact)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse artifact: %s", err)
+	}
 	return &artifact, nil
 }
@@ -29,4 +29,7 @@ type KeyValue struct {
 
 	// Value is the setting itself
 	Value string `json:"value"  meddler:"value"`
+
+	// Expires is the unix time after which the key-value is deleted, zero never expires
+	Expires int64 `json:"expires,omitempty"  meddler:"expires"`
 }
@@ -0,0 +1,20 @@
+package model
+
+const NotificationPending = "pending"
+const NotificationDelivered = "delivered"
+const NotificationFailed = "failed"
+
+// Notification is a message in the notification outbox, addressed to a single provider
+type Notification struct {
+	ID          int64  `json:"id"  meddler:"id,pk"`
+	Provider    string `json:"provider"  meddler:"provider"`
+	Type        string `json:"type"  meddler:"type"`
+	Env         string `json:"env"  meddler:"env"`
+	Payload     string `json:"payload"  meddler:"payload"`
+	Status      string `json:"status"  meddler:"status"`
+	Attempts    int    `json:"attempts"  meddler:"attempts"`
+	NextAttempt int64  `json:"nextAttempt"  meddler:"next_attempt"`
+	LastError   string `json:"lastError,omitempty"  meddler:"last_error"`
+	Created     int64  `json:"created"  meddler:"created"`
+	Delivered   int64  `json:"delivered,omitempty"  meddler:"delivered"`
+}
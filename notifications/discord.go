@@ -2,16 +2,18 @@ package notifications
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-const githubCommitLinkFormatForDiscord = "[%s](https://github.com/%s/commit/%s)"
-
 type DiscordProvider struct {
 	Token          string
 	ChannelID      string
 	ChannelMapping map[string]string
+	// Templates of the message texts, the built-in templates are used if nil
+	Templates *Templates
 }
 
 type discordMessage struct {
@@ -19,6 +21,10 @@ type discordMessage struct {
 	Embed *discordgo.MessageEmbed `json:"embed"`
 }
 
+func (s *DiscordProvider) name() string {
+	return "discord"
+}
+
 func (s *DiscordProvider) send(msg Message) error {
 
 	discordBot, err := discordgo.New("Bot " + s.Token)
@@ -26,7 +32,7 @@ func (s *DiscordProvider) send(msg Message) error {
 		return fmt.Errorf("error creating Discord session, %s", err)
 	}
 
-	discordMessage, err := msg.AsDiscordMessage()
+	discordMessage, err := s.Templates.discordMessage(msg)
 	if err != nil {
 		return fmt.Errorf("cannot create slack message: %s", err)
 	}
@@ -35,6 +41,9 @@ func (s *DiscordProvider) send(msg Message) error {
 	if ch, ok := s.ChannelMapping[msg.Env()]; ok {
 		channel = ch
 	}
+	if ch := routedChannel(msg); ch != "" {
+		channel = ch
+	}
 	s.ChannelID = channel
 
 	return s.post(discordBot, discordMessage)
@@ -48,9 +57,27 @@ func (s *DiscordProvider) post(d *discordgo.Session, msg *discordMessage) error
 	return nil
 }
 
-func discordCommitLink(repo string, ref string) string {
-	if len(ref) < 8 {
-		return ""
+// discordMessage assembles the message from the "text", "description" and "color" templates
+func (t *Templates) discordMessage(msg Message) (*discordMessage, error) {
+	parts, err := t.render("discord", msg, "text", "description", "color")
+	if err != nil || parts == nil {
+		return nil, err
+	}
+
+	color := 0
+	if parts["color"] != "" {
+		color, err = strconv.Atoi(strings.TrimSpace(parts["color"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid discord color: %s", err)
+		}
 	}
-	return fmt.Sprintf(githubCommitLinkFormatForDiscord, ref[0:7], repo, ref)
+
+	return &discordMessage{
+		Text: parts["text"],
+		Embed: &discordgo.MessageEmbed{
+			Type:        "article",
+			Description: parts["description"],
+			Color:       color,
+		},
+	}, nil
 }
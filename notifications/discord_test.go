@@ -22,7 +22,7 @@ func TestSendingFluxMessage(t *testing.T) {
 		env:        "staging",
 	}
 
-	discordMessageHealthCheckPassed, err := msgHealthCheckPassed.AsDiscordMessage()
+	discordMessageHealthCheckPassed, err := defaultTemplates.discordMessage(&msgHealthCheckPassed)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -42,7 +42,7 @@ func TestSendingFluxMessage(t *testing.T) {
 		env:        "staging",
 	}
 
-	discordMessageHealthCheckProgressing, err := msgHealthCheckProgressing.AsDiscordMessage()
+	discordMessageHealthCheckProgressing, err := defaultTemplates.discordMessage(&msgHealthCheckProgressing)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -62,7 +62,7 @@ func TestSendingFluxMessage(t *testing.T) {
 		env:        "staging",
 	}
 
-	discordMessageHealthCheckFailed, err := msgHealthCheckFailed.AsDiscordMessage()
+	discordMessageHealthCheckFailed, err := defaultTemplates.discordMessage(&msgHealthCheckFailed)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -87,7 +87,7 @@ func TestSendingGitopsDeleteMessage(t *testing.T) {
 		},
 	}
 
-	discordMessageDeleteFailed, err := msgDeleteFailed.AsDiscordMessage()
+	discordMessageDeleteFailed, err := defaultTemplates.discordMessage(&msgDeleteFailed)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -108,7 +108,7 @@ func TestSendingGitopsDeleteMessage(t *testing.T) {
 		},
 	}
 
-	discordMessagePolicyDeletion, err := msgPolicyDeletion.AsDiscordMessage()
+	discordMessagePolicyDeletion, err := defaultTemplates.discordMessage(&msgPolicyDeletion)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -143,7 +143,7 @@ func TestSendingGitopsDeployMessage(t *testing.T) {
 		},
 	}
 
-	discordMessageSendFailure, err := msgSendFailure.AsDiscordMessage()
+	discordMessageSendFailure, err := defaultTemplates.discordMessage(&msgSendFailure)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -169,7 +169,7 @@ func TestSendingGitopsDeployMessage(t *testing.T) {
 		},
 	}
 
-	discordMessageSendByGimlet, err := msgSendByGimlet.AsDiscordMessage()
+	discordMessageSendByGimlet, err := defaultTemplates.discordMessage(&msgSendByGimlet)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -197,7 +197,7 @@ func TestSendingGitopsRollbackMessage(t *testing.T) {
 		},
 	}
 
-	discordMessageRollbackFailed, err := msgRollbackFailed.AsDiscordMessage()
+	discordMessageRollbackFailed, err := defaultTemplates.discordMessage(&msgRollbackFailed)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -221,7 +221,7 @@ func TestSendingGitopsRollbackMessage(t *testing.T) {
 		},
 	}
 
-	discordMessageRollbackSuccess, err := msgRollbackSuccess.AsDiscordMessage()
+	discordMessageRollbackSuccess, err := defaultTemplates.discordMessage(&msgRollbackSuccess)
 	if err != nil {
 		t.Errorf("Failed to create Discord message!")
 	}
@@ -0,0 +1,358 @@
+package notifications
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+const emailDigestKey = "emailDigest"
+
+// EmailProvider sends notifications over SMTP, either one by one, or in a daily digest
+type EmailProvider struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// To is the default list of recipients
+	To               []string
+	RecipientMapping map[string]string
+	// Digest collects the messages and sends a summary once a day, at DigestTime
+	Digest bool
+	// DigestTime is the time of the day in UTC, in 15:04 format
+	DigestTime string
+	// Store persists the collected digest entries between restarts
+	Store *store.Store
+
+	lock sync.Mutex
+}
+
+// emailDigest is the template data of the daily digest
+type emailDigest struct {
+	Date string
+	Envs []*emailDigestEnv
+}
+
+// emailDigestEntry is a collected message and the recipients it is addressed to
+type emailDigestEntry struct {
+	webhookMessage
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+type emailDigestEnv struct {
+	Env       string
+	Deploys   int
+	Rollbacks int
+	Deletes   int
+	Failures  int
+	Entries   []*webhookMessage
+}
+
+func (e *EmailProvider) name() string {
+	return "email"
+}
+
+func (e *EmailProvider) send(msg Message) error {
+	attributes, err := msg.AsWebhookMessage()
+	if err != nil {
+		return fmt.Errorf("cannot create email: %s", err)
+	}
+	if attributes == nil {
+		return nil
+	}
+	// Flux progress is too chatty for email, only its failures are sent
+	if attributes.Type == webhookTypeGitopsCommit && outcome(attributes) != outcomeFailure {
+		return nil
+	}
+
+	recipients := e.To
+	if to, ok := e.RecipientMapping[attributes.Env]; ok {
+		recipients = []string{to}
+	}
+	if to := routedChannel(msg); to != "" {
+		recipients = []string{to}
+	}
+	if len(recipients) == 0 {
+		return &permanentError{fmt.Errorf("no email recipient for %s", attributes.Env)}
+	}
+
+	if e.Digest {
+		attributes.Created = time.Now().Unix()
+		return e.collect(&emailDigestEntry{webhookMessage: *attributes, Recipients: recipients})
+	}
+
+	templates, ok := emailTemplates[attributes.Type]
+	if !ok {
+		return nil
+	}
+	return e.sendTemplate(recipients, templates, attributes)
+}
+
+// RunDigest sends the collected messages once a day
+func (e *EmailProvider) RunDigest() {
+	for {
+		time.Sleep(time.Until(nextDigest(time.Now().UTC(), e.DigestTime)))
+
+		err := e.sendDigest()
+		if err != nil {
+			logrus.Warnf("cannot send email digest: %s", err)
+		}
+	}
+}
+
+func (e *EmailProvider) collect(entry *emailDigestEntry) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	entries, err := e.digestEntries()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+	return e.saveDigestEntries(entries)
+}
+
+// sendDigest sends a digest to each recipient with the entries addressed to them.
+// Entries that could not be sent are kept for the next digest
+func (e *EmailProvider) sendDigest() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	entries, err := e.digestEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	groups := map[string][]*emailDigestEntry{}
+	for _, entry := range entries {
+		recipients := entry.Recipients
+		if len(recipients) == 0 { // entries collected before recipients were stored
+			recipients = e.To
+		}
+		key := strings.Join(recipients, ",")
+		groups[key] = append(groups[key], entry)
+	}
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	unsent := []*emailDigestEntry{}
+	var errs []string
+	for _, key := range keys {
+		if key == "" {
+			unsent = append(unsent, groups[key]...)
+			errs = append(errs, fmt.Sprintf("no email recipient for %d digest entries", len(groups[key])))
+			continue
+		}
+
+		var messages []*webhookMessage
+		for _, entry := range groups[key] {
+			messages = append(messages, &entry.webhookMessage)
+		}
+		err = e.sendTemplate(strings.Split(key, ","), digestTemplates, summarize(messages, time.Now().UTC()))
+		if err != nil {
+			unsent = append(unsent, groups[key]...)
+			errs = append(errs, err.Error())
+		}
+	}
+
+	err = e.saveDigestEntries(unsent)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (e *EmailProvider) digestEntries() ([]*emailDigestEntry, error) {
+	keyValue, err := e.Store.KeyValue(emailDigestKey)
+	if err == sql.ErrNoRows {
+		return []*emailDigestEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []*emailDigestEntry
+	err = json.Unmarshal([]byte(keyValue.Value), &entries)
+	return entries, err
+}
+
+func (e *EmailProvider) saveDigestEntries(entries []*emailDigestEntry) error {
+	entriesBytes, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	return e.Store.SaveKeyValue(&model.KeyValue{
+		Key:   emailDigestKey,
+		Value: string(entriesBytes),
+	})
+}
+
+func (e *EmailProvider) sendTemplate(recipients []string, templates *emailTemplate, data interface{}) error {
+	if len(recipients) == 0 {
+		return &permanentError{fmt.Errorf("no email recipient")}
+	}
+
+	subject := new(bytes.Buffer)
+	err := templates.text.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return fmt.Errorf("cannot render email subject: %s", err)
+	}
+	text := new(bytes.Buffer)
+	err = templates.text.ExecuteTemplate(text, "text", data)
+	if err != nil {
+		return fmt.Errorf("cannot render email: %s", err)
+	}
+	html := new(bytes.Buffer)
+	err = templates.html.ExecuteTemplate(html, "html", data)
+	if err != nil {
+		return fmt.Errorf("cannot render email: %s", err)
+	}
+
+	body, err := e.mime(recipients, subject.String(), text.Bytes(), html.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	err = smtp.SendMail(fmt.Sprintf("%s:%d", e.Host, e.Port), auth, e.From, recipients, body)
+	if err != nil {
+		return fmt.Errorf("could not send email: %s", err)
+	}
+	return nil
+}
+
+// mime builds a multipart/alternative message with a text and an html part.
+// The subject is rendered from message contents, so it is folded to a single line and encoded
+func (e *EmailProvider) mime(recipients []string, subject string, text []byte, html []byte) ([]byte, error) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	subject = strings.Join(strings.Fields(subject), " ")
+	fmt.Fprintf(body, "From: %s\r\n", e.From)
+	fmt.Fprintf(body, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(body, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(body, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.content)
+	}
+
+	err := writer.Close()
+	return body.Bytes(), err
+}
+
+// summarize groups the digest entries per env
+func summarize(entries []*webhookMessage, date time.Time) *emailDigest {
+	envs := map[string]*emailDigestEnv{}
+	for _, entry := range entries {
+		env, ok := envs[entry.Env]
+		if !ok {
+			env = &emailDigestEnv{Env: entry.Env}
+			envs[entry.Env] = env
+		}
+
+		env.Entries = append(env.Entries, entry)
+		if outcome(entry) == outcomeFailure {
+			env.Failures++
+			continue
+		}
+		switch entry.Type {
+		case webhookTypeDeploy:
+			env.Deploys++
+		case webhookTypeRollback:
+			env.Rollbacks++
+		case webhookTypeDelete:
+			env.Deletes++
+		}
+	}
+
+	digest := &emailDigest{Date: date.Format("2006-01-02")}
+	for _, env := range envs {
+		digest.Envs = append(digest.Envs, env)
+	}
+	sort.Slice(digest.Envs, func(i, j int) bool {
+		return digest.Envs[i].Env < digest.Envs[j].Env
+	})
+	return digest
+}
+
+// nextDigest returns the next occurrence of the 15:04 formatted digest time
+func nextDigest(now time.Time, digestTime string) time.Time {
+	t, err := time.Parse("15:04", digestTime)
+	if err != nil {
+		t, _ = time.Parse("15:04", "08:00")
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// emailTemplate defines the subject, text and html parts of an email,
+// the html part is rendered with html/template so message contents are escaped
+type emailTemplate struct {
+	text *textTemplate.Template
+	html *htmlTemplate.Template
+}
+
+func mustLoadEmailTemplate(name string) *emailTemplate {
+	content, err := builtinTemplates.ReadFile("templates/email/" + name + ".tmpl")
+	if err != nil {
+		panic(err)
+	}
+	return &emailTemplate{
+		text: textTemplate.Must(textTemplate.New(name).Parse(string(content))),
+		html: htmlTemplate.Must(htmlTemplate.New(name).Parse(string(content))),
+	}
+}
+
+var emailTemplates = map[string]*emailTemplate{
+	webhookTypeDeploy:       mustLoadEmailTemplate(webhookTypeDeploy),
+	webhookTypeRollback:     mustLoadEmailTemplate(webhookTypeRollback),
+	webhookTypeDelete:       mustLoadEmailTemplate(webhookTypeDelete),
+	webhookTypeGitopsCommit: mustLoadEmailTemplate(webhookTypeGitopsCommit),
+}
+
+var digestTemplates = mustLoadEmailTemplate("digest")
@@ -0,0 +1,237 @@
+package notifications
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentEmail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink is a minimal SMTP server that records the received emails
+func smtpSink(t *testing.T) (string, int, chan sentEmail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	emails := make(chan sentEmail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, emails)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, emails
+}
+
+func serveSMTP(conn net.Conn, emails chan sentEmail) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost sink")
+	var email sentEmail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			email = sentEmail{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			email.to = append(email.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			email.data = data.String()
+			emails <- email
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func deployMessage(env string, status events.Status) Message {
+	return MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{App: "my-app", Env: env},
+		Artifact: &dx.Artifact{Version: dx.Version{
+			RepositoryName: "gimlet-io/my-app",
+			SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+		}},
+		TriggeredBy: "policy",
+		Status:      status,
+		GitopsRef:   "abc123",
+		GitopsRepo:  "gimlet-io/gitops",
+	})
+}
+
+func TestEmailSend(t *testing.T) {
+	host, port, emails := smtpSink(t)
+	provider := &EmailProvider{
+		Host:             host,
+		Port:             port,
+		From:             "gimletd@example.com",
+		To:               []string{"team@example.com"},
+		RecipientMapping: map[string]string{"production": "ops@example.com"},
+	}
+
+	err := provider.send(deployMessage("production", events.Success))
+	assert.Nil(t, err)
+
+	email := <-emails
+	assert.Equal(t, "gimletd@example.com", email.from)
+	assert.Equal(t, []string{"ops@example.com"}, email.to)
+	assert.Contains(t, email.data, "Subject: my-app is rolling out to production")
+	assert.Contains(t, email.data, "multipart/alternative")
+	assert.Contains(t, email.data, "policy is rolling out my-app of gimlet-io/my-app to production")
+	assert.Contains(t, email.data, `<a href="https://github.com/gimlet-io/gitops/commit/abc123">abc123</a>`)
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "abc123",
+		Status: model.Progressing,
+	}, "staging"))
+	assert.Nil(t, err)
+	select {
+	case <-emails:
+		t.Error("should not send Flux progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	host, port, emails := smtpSink(t)
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	provider := &EmailProvider{
+		Host:             host,
+		Port:             port,
+		From:             "gimletd@example.com",
+		To:               []string{"team@example.com"},
+		RecipientMapping: map[string]string{"production": "ops@example.com"},
+		Digest:           true,
+		Store:            s,
+	}
+
+	assert.Nil(t, provider.send(deployMessage("production", events.Success)))
+	assert.Nil(t, provider.send(deployMessage("production", events.Failure)))
+	assert.Nil(t, provider.send(deployMessage("staging", events.Success)))
+	assert.Nil(t, provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:        "abc123",
+		Status:     model.HealthCheckFailed,
+		StatusDesc: "my-app is not ready",
+	}, "staging")))
+
+	select {
+	case <-emails:
+		t.Error("should not send before the digest")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err := provider.sendDigest()
+	assert.Nil(t, err)
+
+	email := <-emails
+	assert.Equal(t, []string{"ops@example.com"}, email.to, "should send the entries of each recipient separately")
+	assert.Contains(t, email.data, "Subject: GimletD daily digest")
+	assert.Contains(t, email.data, "production: 1 deploys, 0 rollbacks, 0 deletes, 1 failures")
+	assert.NotContains(t, email.data, "staging:")
+
+	email = <-emails
+	assert.Equal(t, []string{"team@example.com"}, email.to)
+	assert.Contains(t, email.data, "staging: 1 deploys, 0 rollbacks, 0 deletes, 1 failures")
+	assert.NotContains(t, email.data, "production:")
+
+	entries, err := provider.digestEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries), "should clear the digest once sent")
+}
+
+func TestEmailWithoutRecipient(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	provider := &EmailProvider{
+		Host:   "127.0.0.1",
+		Port:   25,
+		From:   "gimletd@example.com",
+		Digest: true,
+		Store:  s,
+	}
+
+	err := provider.send(deployMessage("production", events.Success))
+	assert.NotNil(t, err)
+	assert.True(t, isPermanent(err))
+
+	provider.saveDigestEntries([]*emailDigestEntry{
+		{webhookMessage: webhookMessage{Type: webhookTypeDeploy, Env: "staging", App: "my-app"}},
+	})
+	err = provider.sendDigest()
+	assert.NotNil(t, err)
+	entries, _ := provider.digestEntries()
+	assert.Equal(t, 1, len(entries), "should keep the entries that have no recipient")
+}
+
+func TestEmailSubject(t *testing.T) {
+	provider := &EmailProvider{From: "gimletd@example.com"}
+
+	body, err := provider.mime([]string{"team@example.com"}, "my-app\r\nBcc: attacker@example.com", nil, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(body), "\r\nBcc:", "should not allow header injection")
+	assert.Contains(t, string(body), "Subject: my-app Bcc: attacker@example.com\r\n")
+
+	body, err = provider.mime([]string{"team@example.com"}, "árvíztűrő is rolling out", nil, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "Subject: =?utf-8?q?")
+}
+
+func TestNextDigest(t *testing.T) {
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, 9, 2, 8, 0, 0, 0, time.UTC), nextDigest(now, "08:00"))
+	assert.Equal(t, time.Date(2021, 9, 1, 17, 30, 0, 0, time.UTC), nextDigest(now, "17:30"))
+	assert.Equal(t, time.Date(2021, 9, 2, 8, 0, 0, 0, time.UTC), nextDigest(now, "invalid"), "should default to 08:00")
+}
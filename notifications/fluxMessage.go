@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/gimlet-io/gimletd/model"
-	githubLib "github.com/google/go-github/v37/github"
 )
 
 type fluxMessage struct {
@@ -15,111 +13,78 @@ type fluxMessage struct {
 	env          string
 }
 
-func (fm *fluxMessage) AsSlackMessage() (*slackMessage, error) {
-	msg := &slackMessage{
-		Text:   "",
-		Blocks: []Block{},
+func (fm *fluxMessage) Env() string {
+	return fm.env
+}
+
+func (fm *fluxMessage) AsTeamsMessage() (*teamsMessage, error) {
+	link := markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha)
+	facts := []teamsFact{
+		{Title: "Environment", Value: strings.Title(fm.env)},
 	}
 
 	switch fm.gitopsCommit.Status {
 	case model.Progressing:
 		if strings.Contains(fm.gitopsCommit.StatusDesc, "Health check passed") {
-			msg.Text = fmt.Sprintf(":heavy_check_mark: Applied resources from %s are up and healthy", commitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
-		} else {
-			msg.Text = fmt.Sprintf(":hourglass_flowing_sand: Applying gitops changes from %s", commitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+			return newTeamsMessage(fmt.Sprintf("Applied resources from %s are up and healthy", link), fm.gitopsCommit.StatusDesc, false, facts), nil
 		}
+		return newTeamsMessage(fmt.Sprintf("Applying gitops changes from %s", link), "", false, facts), nil
 	case model.ValidationFailed:
 		fallthrough
 	case model.ReconciliationFailed:
-		msg.Text = fmt.Sprintf(":exclamation: Gitops changes from %s failed to apply", commitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		return newTeamsMessage(fmt.Sprintf("Gitops changes from %s failed to apply", link), fm.gitopsCommit.StatusDesc, true, facts), nil
 	case model.HealthCheckFailed:
-		msg.Text = fmt.Sprintf(":ambulance: Gitops changes from %s have health issues", commitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		return newTeamsMessage(fmt.Sprintf("Gitops changes from %s have health issues", link), fm.gitopsCommit.StatusDesc, true, facts), nil
 	default:
-		msg.Text = fmt.Sprintf("%s: %s", fm.gitopsCommit.Status, commitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		return newTeamsMessage(fmt.Sprintf("%s: %s", fm.gitopsCommit.Status, link), "", false, facts), nil
 	}
-
-	msg.Blocks = append(msg.Blocks,
-		Block{
-			Type: section,
-			Text: &Text{
-				Type: markdown,
-				Text: msg.Text,
-			},
-		},
-	)
-
-	var contextText string
-	switch fm.gitopsCommit.Status {
-	case model.ValidationFailed:
-		fallthrough
-	case model.ReconciliationFailed:
-		fallthrough
-	case model.HealthCheckFailed:
-		contextText = fm.gitopsCommit.StatusDesc
-	case model.Progressing:
-		if strings.Contains(fm.gitopsCommit.StatusDesc, "Health check passed") {
-			contextText = fm.gitopsCommit.StatusDesc
-		}
-	}
-
-	if contextText != "" {
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{
-						Type: markdown,
-						Text: contextText,
-					},
-				},
-			},
-		)
-	}
-
-	return msg, nil
 }
 
-func (fm *fluxMessage) Env() string {
-	return fm.env
-}
-
-func (fm *fluxMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
-	return nil, nil
-}
-
-func (fm *fluxMessage) AsDiscordMessage() (*discordMessage, error) {
-
-	msg := &discordMessage{
-		Text: "Health check",
-		Embed: &discordgo.MessageEmbed{
-			Type:        "article",
-			Description: "",
-			Color:       3066993,
-		},
+func (fm *fluxMessage) AsMattermostMessage() (*mattermostMessage, error) {
+	msg := &mattermostMessage{}
+	attachment := mattermostAttachment{
+		Color: mattermostSuccessColor,
 	}
 
 	switch fm.gitopsCommit.Status {
 	case model.Progressing:
 		if strings.Contains(fm.gitopsCommit.StatusDesc, "Health check passed") {
-			msg.Embed.Description = fmt.Sprintf(":heavy_check_mark: Applied resources from %s are up and healthy", discordCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+			msg.Text = fmt.Sprintf(":heavy_check_mark: Applied resources from %s are up and healthy", markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+			attachment.Text = fm.gitopsCommit.StatusDesc
 		} else {
-			msg.Embed.Description = fmt.Sprintf(":hourglass_flowing_sand: Applying gitops changes from %s", discordCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+			msg.Text = fmt.Sprintf(":hourglass_flowing_sand: Applying gitops changes from %s", markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
 		}
 	case model.ValidationFailed:
 		fallthrough
 	case model.ReconciliationFailed:
-		msg.Embed.Description = fmt.Sprintf(":exclamation: Gitops changes from %s failed to apply", discordCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
-		msg.Embed.Color = 15158332
+		msg.Text = fmt.Sprintf(":exclamation: Gitops changes from %s failed to apply", markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		attachment.Text = fm.gitopsCommit.StatusDesc
+		attachment.Color = mattermostFailureColor
 	case model.HealthCheckFailed:
-		msg.Embed.Description = fmt.Sprintf(":ambulance: Gitops changes from %s have health issues", discordCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
-		msg.Embed.Color = 15158332
+		msg.Text = fmt.Sprintf(":ambulance: Gitops changes from %s have health issues", markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		attachment.Text = fm.gitopsCommit.StatusDesc
+		attachment.Color = mattermostFailureColor
 	default:
-		msg.Embed.Description = fmt.Sprintf("%s: %s", fm.gitopsCommit.Status, discordCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
+		msg.Text = fmt.Sprintf("%s: %s", fm.gitopsCommit.Status, markdownCommitLink(fm.gitopsRepo, fm.gitopsCommit.Sha))
 	}
 
+	if attachment.Text != "" {
+		msg.Attachments = []mattermostAttachment{attachment}
+	}
 	return msg, nil
 }
 
+func (fm *fluxMessage) AsWebhookMessage() (*webhookMessage, error) {
+	return &webhookMessage{
+		Type:       webhookTypeGitopsCommit,
+		Status:     fm.gitopsCommit.Status,
+		StatusDesc: fm.gitopsCommit.StatusDesc,
+		Env:        fm.env,
+		GitopsRepo: fm.gitopsRepo,
+		GitopsRefs: gitopsRefs(fm.gitopsCommit.Sha),
+	}, nil
+}
+
 func NewMessage(gitopsRepo string, gitopsCommit *model.GitopsCommit, env string) Message {
 	return &fluxMessage{
 		gitopsCommit: gitopsCommit,
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/gimlet-io/gimletd/store"
 	githubLib "github.com/google/go-github/v37/github"
 	"golang.org/x/oauth2"
 	"strings"
@@ -12,16 +13,44 @@ import (
 
 type github struct {
 	tokenManager customScm.NonImpersonatedTokenManager
+	// store tracks the deployments created for gitops commits, deployment tracking is disabled without it
+	store *store.Store
+	// baseURL of the GitHub API, the public API is used if empty
+	baseURL   string
+	templates *Templates
 }
 
-func NewGithubProvider(tokenManager customScm.NonImpersonatedTokenManager) *github {
+func NewGithubProvider(tokenManager customScm.NonImpersonatedTokenManager, store *store.Store, templates *Templates) *github {
 	return &github{
 		tokenManager: tokenManager,
+		store:        store,
+		templates:    templates,
 	}
 }
 
+func (g *github) name() string {
+	return "github"
+}
+
 func (g *github) send(msg Message) error {
-	status, err := msg.AsGithubStatus()
+	return g.sendDelivery(msg, "")
+}
+
+// sendDelivery uses the delivery ID to reuse the GitHub Deployment of earlier attempts
+func (g *github) sendDelivery(msg Message, delivery string) error {
+	err := g.sendStatus(msg)
+	if err != nil {
+		return err
+	}
+
+	if g.store == nil {
+		return nil
+	}
+	return g.sendDeployment(msg, delivery)
+}
+
+func (g *github) sendStatus(msg Message) error {
+	status, err := g.templates.githubStatus(msg)
 	if err != nil {
 		return fmt.Errorf("cannot create github status message: %s", err)
 	}
@@ -47,13 +76,10 @@ func (g *github) post(owner string, repo string, sha string, status *githubLib.R
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	token, _, err := g.tokenManager.Token()
+	client, err := g.client(ctx)
 	if err != nil {
-		return fmt.Errorf("couldn't get scm token: %s", err)
+		return err
 	}
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
-	client := githubLib.NewClient(tc)
 
 	opts := &githubLib.ListOptions{PerPage: 50}
 	statuses, _, err := client.Repositories.ListStatuses(ctx, owner, repo, sha, opts)
@@ -72,6 +98,20 @@ func (g *github) post(owner string, repo string, sha string, status *githubLib.R
 	return nil
 }
 
+func (g *github) client(ctx context.Context) (*githubLib.Client, error) {
+	token, _, err := g.tokenManager.Token()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	tc := oauth2.NewClient(ctx, ts)
+
+	if g.baseURL != "" {
+		return githubLib.NewEnterpriseClient(g.baseURL, g.baseURL, tc)
+	}
+	return githubLib.NewClient(tc), nil
+}
+
 func statusExists(statuses []*githubLib.RepoStatus, status *githubLib.RepoStatus) bool {
 	for _, s := range statuses {
 		if *s.Context == *status.Context {
@@ -85,3 +125,31 @@ func statusExists(statuses []*githubLib.RepoStatus, status *githubLib.RepoStatus
 
 	return false
 }
+
+// githubStatus assembles the commit status from the "state", "context", "description" and "targetURL" templates.
+// Messages without a github template don't have a commit status
+func (t *Templates) githubStatus(msg Message) (*githubLib.RepoStatus, error) {
+	parts, err := t.render("github", msg, "state", "context", "description", "targetURL")
+	if err != nil || parts == nil {
+		return nil, err
+	}
+
+	state := parts["state"]
+	context := parts["context"]
+	desc := parts["description"]
+	if len(desc) > 140 {
+		desc = desc[:140]
+	}
+	var targetURL *string
+	if parts["targetURL"] != "" {
+		url := parts["targetURL"]
+		targetURL = &url
+	}
+
+	return &githubLib.RepoStatus{
+		State:       &state,
+		Context:     &context,
+		Description: &desc,
+		TargetURL:   targetURL,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+const (
+	deploymentInProgress = "in_progress"
+	deploymentSuccess    = "success"
+	deploymentFailure    = "failure"
+	deploymentInactive   = "inactive"
+)
+
+// githubDeploymentRetention is how long the deployment of a delivery and of a gitops commit is tracked.
+// The deployment of an env and app is kept until the next release replaces it
+const githubDeploymentRetention = 30 * 24 * time.Hour
+
+// githubDeployment is a GitHub Deployment object that GimletD created for a release
+type githubDeployment struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	ID    int64  `json:"id"`
+	Env   string `json:"env"`
+}
+
+// sendDeployment creates GitHub Deployments on releases,
+// and tracks their state from the Flux reconciliation of the gitops commits.
+// Retries of a delivery reuse the deployment that the first attempt created
+func (g *github) sendDeployment(msg Message, delivery string) error {
+	attributes, err := msg.AsWebhookMessage()
+	if err != nil || attributes == nil {
+		return err
+	}
+
+	switch attributes.Type {
+	case webhookTypeDeploy:
+		return g.createDeployment(attributes, delivery)
+	case webhookTypeGitopsCommit:
+		state := deploymentState(attributes)
+		if state == "" {
+			return nil
+		}
+		for _, gitopsRef := range attributes.GitopsRefs {
+			err := g.updateDeployment(githubDeploymentKey(gitopsRef), state, attributes.StatusDesc)
+			if err != nil {
+				return err
+			}
+		}
+	case webhookTypeDelete:
+		if attributes.Status == outcomeFailure {
+			return nil
+		}
+		return g.updateDeployment(githubDeploymentKey(attributes.Env, attributes.App), deploymentInactive, "deleted by "+attributes.TriggeredBy)
+	case webhookTypeRollback:
+		// the rolled back deployment is no longer running
+		if attributes.Status == outcomeFailure {
+			return nil
+		}
+		return g.updateDeployment(githubDeploymentKey(attributes.Env, attributes.App), deploymentInactive, "rolled back by "+attributes.TriggeredBy)
+	}
+
+	return nil
+}
+
+func (g *github) createDeployment(attributes *webhookMessage, delivery string) error {
+	parts := strings.Split(attributes.Repository, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("cannot determine repo owner and name")
+	}
+	owner := parts[0]
+	repo := parts[1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	client, err := g.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("%s released by %s", attributes.App, attributes.TriggeredBy)
+
+	var trackedDeployment githubDeployment
+	deliveredDeployment, err := g.deliveredDeployment(delivery)
+	if err != nil {
+		return err
+	}
+	if deliveredDeployment != nil {
+		trackedDeployment = *deliveredDeployment
+	} else {
+		deployment, _, err := client.Repositories.CreateDeployment(ctx, owner, repo, &githubLib.DeploymentRequest{
+			Ref:              &attributes.SHA,
+			Environment:      &attributes.Env,
+			Description:      &description,
+			AutoMerge:        githubLib.Bool(false),
+			RequiredContexts: &[]string{},
+			Payload: map[string]interface{}{
+				"app":        attributes.App,
+				"gitopsRepo": attributes.GitopsRepo,
+				"gitopsRefs": attributes.GitopsRefs,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not create deployment: %v", err)
+		}
+
+		trackedDeployment = githubDeployment{
+			Owner: owner,
+			Repo:  repo,
+			ID:    deployment.GetID(),
+			Env:   attributes.Env,
+		}
+		if delivery != "" {
+			err = g.saveDeployment(githubDeploymentKey("delivery", delivery), trackedDeployment, githubDeploymentRetention)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	state := deploymentInProgress
+	if attributes.Status == outcomeFailure {
+		state = deploymentFailure
+		description = attributes.StatusDesc
+	}
+	err = g.createDeploymentStatus(ctx, client, owner, repo, trackedDeployment.ID, attributes.Env, state, description)
+	if err != nil {
+		return err
+	}
+
+	if attributes.Status == outcomeFailure {
+		return nil
+	}
+
+	for _, gitopsRef := range attributes.GitopsRefs {
+		err = g.saveDeployment(githubDeploymentKey(gitopsRef), trackedDeployment, githubDeploymentRetention)
+		if err != nil {
+			return err
+		}
+	}
+	return g.saveDeployment(githubDeploymentKey(attributes.Env, attributes.App), trackedDeployment, 0)
+}
+
+func (g *github) updateDeployment(key string, state string, description string) error {
+	deployment, err := g.deployment(key)
+	if err != nil {
+		return err
+	}
+	if deployment == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	client, err := g.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	return g.createDeploymentStatus(ctx, client, deployment.Owner, deployment.Repo, deployment.ID, deployment.Env, state, description)
+}
+
+func (g *github) createDeploymentStatus(
+	ctx context.Context,
+	client *githubLib.Client,
+	owner, repo string,
+	deploymentID int64,
+	env, state, description string,
+) error {
+	if len(description) > 140 {
+		description = description[:140]
+	}
+
+	_, _, err := client.Repositories.CreateDeploymentStatus(ctx, owner, repo, deploymentID, &githubLib.DeploymentStatusRequest{
+		State:       &state,
+		Environment: &env,
+		Description: &description,
+		// GitHub marks the earlier deployments of the env inactive
+		AutoInactive: githubLib.Bool(state == deploymentSuccess),
+	})
+	if err != nil {
+		return fmt.Errorf("could not create deployment status: %v", err)
+	}
+	return nil
+}
+
+// saveDeployment tracks the deployment under the key, for the given retention or forever if zero
+func (g *github) saveDeployment(key string, deployment githubDeployment, retention time.Duration) error {
+	deploymentBytes, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	var expires int64
+	if retention != 0 {
+		expires = time.Now().Add(retention).Unix()
+	}
+	return g.store.SaveKeyValue(&model.KeyValue{
+		Key:     key,
+		Value:   string(deploymentBytes),
+		Expires: expires,
+	})
+}
+
+// deliveredDeployment is the deployment that an earlier attempt of the delivery created
+func (g *github) deliveredDeployment(delivery string) (*githubDeployment, error) {
+	if delivery == "" {
+		return nil, nil
+	}
+	return g.deployment(githubDeploymentKey("delivery", delivery))
+}
+
+func (g *github) deployment(key string) (*githubDeployment, error) {
+	keyValue, err := g.store.KeyValue(key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var deployment githubDeployment
+	err = json.Unmarshal([]byte(keyValue.Value), &deployment)
+	return &deployment, err
+}
+
+func githubDeploymentKey(parts ...string) string {
+	return "githubDeployment/" + strings.Join(parts, "/")
+}
+
+// deploymentState maps the Flux reconciliation result to a GitHub deployment state
+func deploymentState(attributes *webhookMessage) string {
+	switch outcome(attributes) {
+	case outcomeSuccess:
+		return deploymentSuccess
+	case outcomeFailure:
+		return deploymentFailure
+	case outcomeProgressing:
+		if attributes.Status == model.Progressing {
+			return deploymentInProgress
+		}
+	}
+	return ""
+}
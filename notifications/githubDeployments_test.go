@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTokenManager struct{}
+
+func (f *fakeTokenManager) Token() (string, string, error) {
+	return "token", "user", nil
+}
+
+func TestGithubDeployments(t *testing.T) {
+	var deploymentRequests []map[string]interface{}
+	var statusRequests []map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/commits/ea9ab7cc31b2599bf4afcfd639da516ca27a4780/statuses", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/statuses/ea9ab7cc31b2599bf4afcfd639da516ca27a4780", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/deployments", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		deploymentRequests = append(deploymentRequests, request)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 42}`))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/deployments/42/statuses", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		statusRequests = append(statusRequests, request)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := store.NewTest()
+	provider := NewGithubProvider(&fakeTokenManager{}, store, nil)
+	provider.baseURL = server.URL
+
+	err := provider.send(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{App: "my-app", Env: "staging"},
+		Artifact: &dx.Artifact{
+			Version: dx.Version{
+				RepositoryName: "gimlet-io/my-app",
+				SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			},
+		},
+		TriggeredBy: "policy",
+		GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		GitopsRepo:  "gimlet-io/gitops",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deploymentRequests))
+	assert.Equal(t, "staging", deploymentRequests[0]["environment"])
+	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", deploymentRequests[0]["ref"])
+	assert.Equal(t, deploymentInProgress, statusRequests[0]["state"])
+
+	tracked, err := store.KeyValue(githubDeploymentKey("76ab7d611242f7c6742f0ab662133e02b2ba2b1c"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), tracked.Expires, "should expire the deployments of gitops commits")
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:        "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status:     model.Progressing,
+		StatusDesc: "Health check passed",
+	}, "staging"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(statusRequests))
+	assert.Equal(t, deploymentSuccess, statusRequests[1]["state"])
+	assert.Equal(t, true, statusRequests[1]["auto_inactive"])
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "unknown-gitops-sha",
+		Status: model.ReconciliationFailed,
+	}, "staging"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(statusRequests), "should ignore gitops commits without a deployment")
+
+	err = provider.send(MessageFromRollbackEvent(&events.RollbackEvent{
+		RollbackRequest: &dx.RollbackRequest{
+			Env:         "staging",
+			App:         "my-app",
+			TargetSHA:   "5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d",
+			TriggeredBy: "jane",
+		},
+		Status: events.Success,
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(statusRequests))
+	assert.Equal(t, deploymentInactive, statusRequests[2]["state"], "should mark the rolled back deployment inactive")
+	assert.Equal(t, "rolled back by jane", statusRequests[2]["description"])
+
+	err = provider.send(MessageFromDeleteEvent(&events.DeleteEvent{
+		App:         "my-app",
+		Env:         "staging",
+		TriggeredBy: "policy",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(statusRequests))
+	assert.Equal(t, deploymentInactive, statusRequests[3]["state"])
+}
+
+func TestGithubDeploymentRetries(t *testing.T) {
+	deploymentRequests := 0
+	statusRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/commits/ea9ab7cc31b2599bf4afcfd639da516ca27a4780/statuses", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/statuses/ea9ab7cc31b2599bf4afcfd639da516ca27a4780", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/deployments", func(w http.ResponseWriter, r *http.Request) {
+		deploymentRequests++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 42}`))
+	})
+	mux.HandleFunc("/api/v3/repos/gimlet-io/my-app/deployments/42/statuses", func(w http.ResponseWriter, r *http.Request) {
+		statusRequests++
+		if statusRequests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider := NewGithubProvider(&fakeTokenManager{}, store.NewTest(), nil)
+	provider.baseURL = server.URL
+
+	msg := MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{App: "my-app", Env: "staging"},
+		Artifact: &dx.Artifact{
+			Version: dx.Version{
+				RepositoryName: "gimlet-io/my-app",
+				SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			},
+		},
+		TriggeredBy: "policy",
+		GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+	})
+
+	err := provider.sendDelivery(msg, "delivery-1")
+	assert.NotNil(t, err)
+	err = provider.sendDelivery(msg, "delivery-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deploymentRequests, "a retry should reuse the deployment of the failed attempt")
+	assert.Equal(t, 2, statusRequests)
+}
@@ -4,110 +4,82 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/gimlet-io/gimletd/worker/events"
-	githubLib "github.com/google/go-github/v37/github"
 )
 
 type gitopsDeleteMessage struct {
 	event *events.DeleteEvent
 }
 
-func (gm *gitopsDeleteMessage) AsSlackMessage() (*slackMessage, error) {
-	msg := &slackMessage{
-		Text:   "",
-		Blocks: []Block{},
-	}
-
-	if gm.event.Status == events.Failure {
-		msg.Text = fmt.Sprintf("Failed to delete %s of %s", gm.event.App, gm.event.Env)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: section,
-				Text: &Text{
-					Type: markdown,
-					Text: msg.Text,
-				},
-			},
-		)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{
-						Type: markdown,
-						Text: fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s", gm.event.StatusDesc),
-					},
-				},
-			},
-		)
-	} else {
-		if gm.event.TriggeredBy == "policy" {
-			msg.Text = fmt.Sprintf("Policy based deletion of %s on %s", gm.event.App, gm.event.Env)
-		} else {
-			msg.Text = fmt.Sprintf("%s is deleting %s on %s", gm.event.TriggeredBy, gm.event.App, gm.event.Env)
-		}
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: section,
-				Text: &Text{
-					Type: markdown,
-					Text: msg.Text,
-				},
-			},
-		)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{Type: markdown, Text: fmt.Sprintf(":dart: %s", strings.Title(gm.event.Env))},
-					{Type: markdown, Text: fmt.Sprintf(":paperclip: %s", commitLink(gm.event.GitopsRepo, gm.event.GitopsRef))},
-				},
-			},
-		)
-	}
-
-	return msg, nil
-}
-
 func (gm *gitopsDeleteMessage) Env() string {
 	return gm.event.Env
 }
 
-func (gm *gitopsDeleteMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
-	return nil, nil
-}
+func (gm *gitopsDeleteMessage) AsTeamsMessage() (*teamsMessage, error) {
+	if gm.event.Status == events.Failure {
+		return newTeamsMessage(
+			fmt.Sprintf("Failed to delete %s of %s", gm.event.App, gm.event.Env),
+			gm.event.StatusDesc,
+			true,
+			nil,
+		), nil
+	}
 
-func (gm *gitopsDeleteMessage) AsDiscordMessage() (*discordMessage, error) {
+	var title string
+	if gm.event.TriggeredBy == "policy" {
+		title = fmt.Sprintf("Policy based deletion of %s on %s", gm.event.App, gm.event.Env)
+	} else {
+		title = fmt.Sprintf("%s is deleting %s on %s", gm.event.TriggeredBy, gm.event.App, gm.event.Env)
+	}
 
-	msg := &discordMessage{
-		Text: "",
-		Embed: &discordgo.MessageEmbed{
-			Type:        "article",
-			Description: "",
-			Color:       0,
+	return newTeamsMessage(
+		title,
+		"",
+		false,
+		[]teamsFact{
+			{Title: "Environment", Value: strings.Title(gm.event.Env)},
+			{Title: "Gitops commit", Value: markdownCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef)},
 		},
-	}
+	), nil
+}
+
+func (gm *gitopsDeleteMessage) AsMattermostMessage() (*mattermostMessage, error) {
+	msg := &mattermostMessage{}
+	attachment := mattermostAttachment{}
 
 	if gm.event.Status == events.Failure {
 		msg.Text = fmt.Sprintf("Failed to delete %s of %s", gm.event.App, gm.event.Env)
-		msg.Embed.Description += fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s", gm.event.StatusDesc)
-		msg.Embed.Color = 15158332
+		attachment.Text += fmt.Sprintf(":exclamation: **Error** :exclamation: \n%s", gm.event.StatusDesc)
+		attachment.Color = mattermostFailureColor
 	} else {
 		if gm.event.TriggeredBy == "policy" {
 			msg.Text = fmt.Sprintf("Policy based deletion of %s on %s", gm.event.App, gm.event.Env)
 		} else {
 			msg.Text = fmt.Sprintf("%s is deleting %s on %s", gm.event.TriggeredBy, gm.event.App, gm.event.Env)
 		}
-		msg.Embed.Description += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Env))
-		msg.Embed.Description += fmt.Sprintf(":paperclip: %s\n", discordCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef))
-
-		msg.Embed.Color = 3066993
+		attachment.Text += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Env))
+		attachment.Text += fmt.Sprintf(":paperclip: %s\n", markdownCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef))
+		attachment.Color = mattermostSuccessColor
 	}
 
+	msg.Attachments = []mattermostAttachment{attachment}
 	return msg, nil
 }
 
+func (gm *gitopsDeleteMessage) AsWebhookMessage() (*webhookMessage, error) {
+	return &webhookMessage{
+		Type:        webhookTypeDelete,
+		Status:      webhookStatus(gm.event.Status),
+		StatusDesc:  gm.event.StatusDesc,
+		Env:         gm.event.Env,
+		App:         gm.event.App,
+		Repository:  gm.event.BranchDeletedEvent.Repo,
+		TriggeredBy: gm.event.TriggeredBy,
+		GitopsRepo:  gm.event.GitopsRepo,
+		GitopsRefs:  gitopsRefs(gm.event.GitopsRef),
+	}, nil
+}
+
 func MessageFromDeleteEvent(event *events.DeleteEvent) Message {
 	return &gitopsDeleteMessage{
 		event: event,
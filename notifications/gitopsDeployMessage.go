@@ -3,135 +3,61 @@ package notifications
 import (
 	"fmt"
 	"strings"
-	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/gimlet-io/gimletd/worker/events"
-	githubLib "github.com/google/go-github/v37/github"
 )
 
-const githubCommitLink = "https://github.com/%s/commit/%s"
-const contextFormat = "gitops/%s@%s"
-
 type gitopsDeployMessage struct {
 	event *events.DeployEvent
 }
 
-func (gm *gitopsDeployMessage) AsSlackMessage() (*slackMessage, error) {
-	msg := &slackMessage{
-		Text:   "",
-		Blocks: []Block{},
-	}
-
-	if gm.event.Status == events.Failure {
-		msg.Text = fmt.Sprintf("Failed to roll out %s of %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: section,
-				Text: &Text{
-					Type: markdown,
-					Text: msg.Text,
-				},
-			},
-		)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{
-						Type: markdown,
-						Text: fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s", gm.event.StatusDesc),
-					},
-				},
-			},
-		)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{Type: markdown, Text: fmt.Sprintf(":dart: %s", strings.Title(gm.event.Manifest.Env))},
-					{Type: markdown, Text: fmt.Sprintf(":clipboard: %s", gm.event.Artifact.Version.URL)},
-				},
-			},
-		)
-	} else {
-		if gm.event.TriggeredBy == "policy" {
-			msg.Text = fmt.Sprintf("Policy based rollout of %s on %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
-		} else {
-			msg.Text = fmt.Sprintf("%s is rolling out %s on %s", gm.event.TriggeredBy, gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
-		}
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: section,
-				Text: &Text{
-					Type: markdown,
-					Text: msg.Text,
-				},
-			},
-		)
-		msg.Blocks = append(msg.Blocks,
-			Block{
-				Type: contextString,
-				Elements: []Text{
-					{Type: markdown, Text: fmt.Sprintf(":dart: %s", strings.Title(gm.event.Manifest.Env))},
-					{Type: markdown, Text: fmt.Sprintf(":clipboard: %s", gm.event.Artifact.Version.URL)},
-					{Type: markdown, Text: fmt.Sprintf(":paperclip: %s", commitLink(gm.event.GitopsRepo, gm.event.GitopsRef))},
-				},
-			},
-		)
-	}
-
-	return msg, nil
-}
-
 func (gm *gitopsDeployMessage) Env() string {
 	return gm.event.Manifest.Env
 }
 
-func (gm *gitopsDeployMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
-	context := fmt.Sprintf(contextFormat, gm.event.Manifest.Env, time.Now().Format(time.RFC3339))
-	desc := gm.event.StatusDesc
-	if len(desc) > 140 {
-		desc = desc[:140]
+func (gm *gitopsDeployMessage) AsTeamsMessage() (*teamsMessage, error) {
+	if gm.event.Status == events.Failure {
+		return newTeamsMessage(
+			fmt.Sprintf("Failed to roll out %s of %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName),
+			gm.event.StatusDesc,
+			true,
+			[]teamsFact{
+				{Title: "Environment", Value: strings.Title(gm.event.Manifest.Env)},
+				{Title: "Commit", Value: gm.event.Artifact.Version.URL},
+			},
+		), nil
 	}
 
-	state := "success"
-	targetURL := fmt.Sprintf(githubCommitLink, gm.event.GitopsRepo, gm.event.GitopsRef)
-	targetURLPtr := &targetURL
-
-	if gm.event.Status == events.Failure {
-		state = "failure"
-		targetURLPtr = nil
+	var title string
+	if gm.event.TriggeredBy == "policy" {
+		title = fmt.Sprintf("Policy based rollout of %s on %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
+	} else {
+		title = fmt.Sprintf("%s is rolling out %s on %s", gm.event.TriggeredBy, gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
 	}
 
-	return &githubLib.RepoStatus{
-		State:       &state,
-		Context:     &context,
-		Description: &desc,
-		TargetURL:   targetURLPtr,
-	}, nil
+	return newTeamsMessage(
+		title,
+		"",
+		false,
+		[]teamsFact{
+			{Title: "Environment", Value: strings.Title(gm.event.Manifest.Env)},
+			{Title: "Commit", Value: gm.event.Artifact.Version.URL},
+			{Title: "Gitops commit", Value: markdownCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef)},
+		},
+	), nil
 }
 
-func (gm *gitopsDeployMessage) AsDiscordMessage() (*discordMessage, error) {
-
-	msg := &discordMessage{
-		Text: "",
-		Embed: &discordgo.MessageEmbed{
-			Type:        "article",
-			Description: "",
-			Color:       0,
-		},
-	}
+func (gm *gitopsDeployMessage) AsMattermostMessage() (*mattermostMessage, error) {
+	msg := &mattermostMessage{}
+	attachment := mattermostAttachment{}
 
 	if gm.event.Status == events.Failure {
 		msg.Text = fmt.Sprintf("Failed to roll out %s of %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
 
-		msg.Embed.Description += fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s\n", gm.event.StatusDesc)
-		msg.Embed.Description += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Manifest.Env))
-		msg.Embed.Description += fmt.Sprintf(":clipboard: %s\n", gm.event.Artifact.Version.URL)
-
-		msg.Embed.Color = 15158332
-
+		attachment.Text += fmt.Sprintf(":exclamation: **Error** :exclamation: \n%s\n", gm.event.StatusDesc)
+		attachment.Text += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Manifest.Env))
+		attachment.Text += fmt.Sprintf(":clipboard: %s\n", gm.event.Artifact.Version.URL)
+		attachment.Color = mattermostFailureColor
 	} else {
 		if gm.event.TriggeredBy == "policy" {
 			msg.Text = fmt.Sprintf("Policy based rollout of %s on %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
@@ -139,16 +65,30 @@ func (gm *gitopsDeployMessage) AsDiscordMessage() (*discordMessage, error) {
 			msg.Text = fmt.Sprintf("%s is rolling out %s on %s", gm.event.TriggeredBy, gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
 		}
 
-		msg.Embed.Description += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Manifest.Env))
-		msg.Embed.Description += fmt.Sprintf(":clipboard: %s\n", gm.event.Artifact.Version.URL)
-		msg.Embed.Description += fmt.Sprintf(":paperclip: %s\n", discordCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef))
-
-		msg.Embed.Color = 3066993
-
+		attachment.Text += fmt.Sprintf(":dart: %s\n", strings.Title(gm.event.Manifest.Env))
+		attachment.Text += fmt.Sprintf(":clipboard: %s\n", gm.event.Artifact.Version.URL)
+		attachment.Text += fmt.Sprintf(":paperclip: %s\n", markdownCommitLink(gm.event.GitopsRepo, gm.event.GitopsRef))
+		attachment.Color = mattermostSuccessColor
 	}
 
+	msg.Attachments = []mattermostAttachment{attachment}
 	return msg, nil
+}
 
+func (gm *gitopsDeployMessage) AsWebhookMessage() (*webhookMessage, error) {
+	return &webhookMessage{
+		Type:        webhookTypeDeploy,
+		Status:      webhookStatus(gm.event.Status),
+		StatusDesc:  gm.event.StatusDesc,
+		Env:         gm.event.Manifest.Env,
+		App:         gm.event.Manifest.App,
+		Repository:  gm.event.Artifact.Version.RepositoryName,
+		SHA:         gm.event.Artifact.Version.SHA,
+		ArtifactID:  gm.event.Artifact.ID,
+		TriggeredBy: gm.event.TriggeredBy,
+		GitopsRepo:  gm.event.GitopsRepo,
+		GitopsRefs:  gitopsRefs(gm.event.GitopsRef),
+	}, nil
 }
 
 func MessageFromGitOpsEvent(event *events.DeployEvent) Message {
@@ -1,26 +1,92 @@
 package notifications
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
+const outboxPollInterval = 1 * time.Second
+const outboxBatchSize = 10
+const outboxMetricsInterval = 30 * time.Second
+const outboxSweepInterval = 1 * time.Hour
+
+// defaultOutboxRetention is how long delivered and failed notifications are kept in the outbox
+const defaultOutboxRetention = 7 * 24 * time.Hour
+
 type Manager interface {
 	Broadcast(msg Message)
 	AddProvider(provider Provider)
 }
 
+// DeliveryPolicy controls the retries and the rate of deliveries to a provider
+type DeliveryPolicy struct {
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled on every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MinInterval is the minimum time between two deliveries to the provider
+	MinInterval time.Duration
+}
+
+var defaultDeliveryPolicy = DeliveryPolicy{
+	MaxAttempts: 10,
+	Backoff:     10 * time.Second,
+	MaxBackoff:  30 * time.Minute,
+}
+
+// chat APIs allow roughly one message per second
+var defaultDeliveryPolicies = map[string]DeliveryPolicy{
+	"slack": {
+		MaxAttempts: 10,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  30 * time.Minute,
+		MinInterval: 1 * time.Second,
+	},
+	"discord": {
+		MaxAttempts: 10,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  30 * time.Minute,
+		MinInterval: 1 * time.Second,
+	},
+}
+
+// ManagerImpl persists broadcasted messages in the notification outbox,
+// and delivers them to each provider independently, so a failing provider does not hold up the rest
 type ManagerImpl struct {
-	provider  []Provider
-	broadcast chan Message
+	provider   []Provider
+	rules      []RoutingRule
+	policies   map[string]DeliveryPolicy
+	store      *store.Store
+	deliveries *prometheus.CounterVec
+	outbox     *prometheus.GaugeVec
+	retention  time.Duration
 }
 
 type DummyManagerImpl struct {
 }
 
-func NewManager() *ManagerImpl {
+// NewManager returns the notification manager. The delivery attempts are counted in deliveries by provider and status,
+// the number of pending and failed notifications of the outbox are measured in outbox by status
+func NewManager(store *store.Store, deliveries *prometheus.CounterVec, outbox *prometheus.GaugeVec) *ManagerImpl {
+	policies := map[string]DeliveryPolicy{}
+	for provider, policy := range defaultDeliveryPolicies {
+		policies[provider] = policy
+	}
+
 	return &ManagerImpl{
-		provider:  []Provider{},
-		broadcast: make(chan Message),
+		provider:   []Provider{},
+		policies:   policies,
+		store:      store,
+		deliveries: deliveries,
+		outbox:     outbox,
+		retention:  defaultOutboxRetention,
 	}
 }
 
@@ -28,8 +94,30 @@ func NewDummyManager() *DummyManagerImpl {
 	return &DummyManagerImpl{}
 }
 
+// Broadcast puts the message in the outbox of every provider it is routed to
 func (m *ManagerImpl) Broadcast(msg Message) {
-	m.broadcast <- msg
+	for _, p := range m.provider {
+		routed, ok := route(m.rules, msg, p.name())
+		if !ok {
+			continue
+		}
+
+		messageType, payload, err := marshalMessage(routed)
+		if err != nil {
+			logrus.Errorf("cannot serialize notification: %s", err)
+			continue
+		}
+
+		err = m.store.CreateNotification(&model.Notification{
+			Provider: p.name(),
+			Type:     messageType,
+			Env:      routed.Env(),
+			Payload:  payload,
+		})
+		if err != nil {
+			logrus.Errorf("cannot store notification: %s", err)
+		}
+	}
 }
 
 func (m *DummyManagerImpl) Broadcast(msg Message) {
@@ -42,18 +130,167 @@ func (m *ManagerImpl) AddProvider(provider Provider) {
 	m.provider = append(m.provider, provider)
 }
 
+// SetRoutingRules sets the rules that pick the channel of a message per provider, or mute it
+func (m *ManagerImpl) SetRoutingRules(rules []RoutingRule) {
+	m.rules = rules
+}
+
+// SetDeliveryPolicy overrides the retry and rate limit settings of a provider
+func (m *ManagerImpl) SetDeliveryPolicy(provider string, policy DeliveryPolicy) {
+	m.policies[provider] = policy
+}
+
+// SetRetention sets how long delivered and failed notifications are kept in the outbox
+func (m *ManagerImpl) SetRetention(retention time.Duration) {
+	m.retention = retention
+}
+
+// Run delivers the outbox, one worker per provider
 func (m *ManagerImpl) Run() {
+	if m.outbox != nil {
+		go m.measureOutbox()
+	}
+	go m.sweepOutbox()
+
+	var wg sync.WaitGroup
+	for _, p := range m.provider {
+		wg.Add(1)
+		go func(p Provider) {
+			defer wg.Done()
+			m.deliver(p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+func (m *ManagerImpl) deliver(p Provider) {
+	policy := m.policy(p.name())
 	for {
-		select {
-		case message := <-m.broadcast:
-			for _, p := range m.provider {
-				go func(p Provider) {
-					err := p.send(message)
-					if err != nil {
-						logrus.Warnf("cannot send notification: %s ", err)
-					}
-				}(p)
+		notifications, err := m.store.DueNotifications(p.name(), time.Now().Unix(), outboxBatchSize)
+		if err != nil {
+			logrus.Errorf("cannot get notifications: %s", err)
+		}
+
+		for _, notification := range notifications {
+			m.attempt(p, policy, notification)
+			time.Sleep(policy.MinInterval)
+		}
+
+		if len(notifications) == 0 {
+			time.Sleep(outboxPollInterval)
+		}
+	}
+}
+
+// attempt sends the notification and records the outcome
+func (m *ManagerImpl) attempt(p Provider, policy DeliveryPolicy, notification *model.Notification) {
+	notification.Attempts++
+
+	msg, err := unmarshalMessage(notification.Payload)
+	if err == nil {
+		if d, ok := p.(deliveryProvider); ok {
+			err = d.sendDelivery(msg, deliveryID(notification))
+		} else {
+			err = p.send(msg)
+		}
+	} else {
+		// retrying won't fix a broken payload
+		err = &permanentError{err}
+	}
+	if isPermanent(err) {
+		notification.Attempts = policy.MaxAttempts
+	}
+
+	now := time.Now()
+	if err == nil {
+		notification.Status = model.NotificationDelivered
+		notification.Delivered = now.Unix()
+		notification.LastError = ""
+	} else if notification.Attempts >= policy.MaxAttempts {
+		logrus.Warnf("cannot send notification, giving up after %d attempts: %s", notification.Attempts, err)
+		notification.Status = model.NotificationFailed
+		notification.LastError = err.Error()
+	} else {
+		logrus.Warnf("cannot send notification, retrying: %s", err)
+		notification.NextAttempt = now.Add(policy.backoff(notification.Attempts)).Unix()
+		notification.LastError = err.Error()
+	}
+
+	if m.deliveries != nil {
+		status := notification.Status
+		if status == model.NotificationPending {
+			status = "retry"
+		}
+		m.deliveries.WithLabelValues(p.name(), status).Inc()
+	}
+
+	err = m.store.UpdateNotification(notification)
+	if err != nil {
+		logrus.Errorf("cannot update notification: %s", err)
+	}
+}
+
+// measureOutbox periodically sets the number of pending and failed notifications
+func (m *ManagerImpl) measureOutbox() {
+	for {
+		for _, status := range []string{model.NotificationPending, model.NotificationFailed} {
+			count, err := m.store.CountNotifications(status)
+			if err != nil {
+				logrus.Errorf("cannot count notifications: %s", err)
+				continue
 			}
+			m.outbox.WithLabelValues(status).Set(float64(count))
 		}
+		time.Sleep(outboxMetricsInterval)
+	}
+}
+
+// sweepOutbox periodically deletes the delivered and failed notifications that are past the retention,
+// and the expired delivery state of the providers, like Slack threads
+func (m *ManagerImpl) sweepOutbox() {
+	for {
+		m.sweep(time.Now())
+		time.Sleep(outboxSweepInterval)
+	}
+}
+
+func (m *ManagerImpl) sweep(now time.Time) {
+	deleted, err := m.store.DeleteNotifications(now.Add(-m.retention).Unix())
+	if err != nil {
+		logrus.Errorf("cannot delete old notifications: %s", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("deleted %d notifications from the outbox", deleted)
+	}
+
+	_, err = m.store.DeleteExpiredKeyValues(now.Unix())
+	if err != nil {
+		logrus.Errorf("cannot delete expired key values: %s", err)
+	}
+}
+
+// deliveryID is the same on every attempt of the notification
+func deliveryID(notification *model.Notification) string {
+	name := fmt.Sprintf("%s/%d/%d", notification.Provider, notification.ID, notification.Created)
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String()
+}
+
+func (m *ManagerImpl) policy(provider string) DeliveryPolicy {
+	if policy, ok := m.policies[provider]; ok {
+		return policy
+	}
+	return defaultDeliveryPolicy
+}
+
+// backoff returns the wait before the next attempt, after the given number of failed attempts
+func (p DeliveryPolicy) backoff(attempts int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempts && backoff < p.MaxBackoff; i++ {
+		backoff = backoff * 2
+	}
+	if p.MaxBackoff != 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
 	}
+	return backoff
 }
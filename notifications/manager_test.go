@@ -0,0 +1,142 @@
+package notifications
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	providerName string
+	failures     int
+	permanent    bool
+	sent         []Message
+}
+
+func (f *fakeProvider) name() string {
+	return f.providerName
+}
+
+func (f *fakeProvider) send(msg Message) error {
+	if f.failures > 0 {
+		f.failures--
+		if f.permanent {
+			return &permanentError{fmt.Errorf("invalid message")}
+		}
+		return fmt.Errorf("provider is down")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	store := store.NewTest()
+	slack := &fakeProvider{providerName: "slack", failures: 1}
+	github := &fakeProvider{providerName: "github"}
+
+	manager := NewManager(store, nil, nil)
+	manager.AddProvider(slack)
+	manager.AddProvider(github)
+	manager.SetRoutingRules([]RoutingRule{
+		{Env: "production", Providers: []string{"slack"}, Channel: "incidents"},
+	})
+
+	manager.Broadcast(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{App: "my-app", Env: "production"},
+		Artifact: &dx.Artifact{ID: "my-app-123"},
+		Status:   events.Failure,
+	}))
+
+	policy := DeliveryPolicy{MaxAttempts: 2, Backoff: 0}
+	due, err := store.DueNotifications("slack", time.Now().Unix(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due))
+	manager.attempt(slack, policy, due[0])
+	assert.Equal(t, 0, len(slack.sent))
+
+	due, err = store.DueNotifications("slack", time.Now().Unix(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due), "should retry failed deliveries")
+	assert.Equal(t, "provider is down", due[0].LastError)
+	manager.attempt(slack, policy, due[0])
+	assert.Equal(t, 1, len(slack.sent))
+	assert.Equal(t, "incidents", routedChannel(slack.sent[0]), "should keep the routed channel")
+	assert.Equal(t, "production", slack.sent[0].Env())
+
+	due, err = store.DueNotifications("github", time.Now().Unix(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due), "should deliver to each provider independently")
+
+	pending, _ := store.CountNotifications(model.NotificationPending)
+	assert.Equal(t, 1, pending)
+}
+
+func TestOutboxGivesUp(t *testing.T) {
+	store := store.NewTest()
+	slack := &fakeProvider{providerName: "slack", failures: 5}
+
+	manager := NewManager(store, nil, nil)
+	manager.AddProvider(slack)
+	manager.Broadcast(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.ReconciliationSucceeded,
+	}, "staging"))
+
+	policy := DeliveryPolicy{MaxAttempts: 2, Backoff: 0}
+	for i := 0; i < 2; i++ {
+		due, _ := store.DueNotifications("slack", time.Now().Unix(), 10)
+		assert.Equal(t, 1, len(due))
+		manager.attempt(slack, policy, due[0])
+	}
+
+	failed, err := store.Notifications(model.NotificationFailed, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	assert.Equal(t, 2, failed[0].Attempts)
+
+	manager.sweep(time.Now())
+	failed, _ = store.Notifications(model.NotificationFailed, 10, 0)
+	assert.Equal(t, 1, len(failed), "should keep failed notifications for the retention period")
+	manager.sweep(time.Now().Add(defaultOutboxRetention + time.Minute))
+	failed, _ = store.Notifications(model.NotificationFailed, 10, 0)
+	assert.Equal(t, 0, len(failed), "should delete failed notifications after the retention period")
+}
+
+func TestOutboxGivesUpOnPermanentErrors(t *testing.T) {
+	store := store.NewTest()
+	webhook := &fakeProvider{providerName: "webhook", failures: 1, permanent: true}
+
+	manager := NewManager(store, nil, nil)
+	manager.AddProvider(webhook)
+	manager.Broadcast(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.ReconciliationSucceeded,
+	}, "staging"))
+
+	due, _ := store.DueNotifications("webhook", time.Now().Unix(), 10)
+	assert.Equal(t, 1, len(due))
+	manager.attempt(webhook, DeliveryPolicy{MaxAttempts: 5}, due[0])
+
+	failed, err := store.Notifications(model.NotificationFailed, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed), "should not retry permanent errors")
+}
+
+func Test_deliveryID(t *testing.T) {
+	notification := &model.Notification{ID: 1, Provider: "webhook", Created: 1634000000}
+	assert.Equal(t, deliveryID(notification), deliveryID(notification), "should keep the delivery ID between retries")
+	assert.NotEqual(t, deliveryID(notification), deliveryID(&model.Notification{ID: 2, Provider: "webhook", Created: 1634000000}))
+}
+
+func TestBackoff(t *testing.T) {
+	policy := DeliveryPolicy{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	assert.Equal(t, 10*time.Second, policy.backoff(1))
+	assert.Equal(t, 20*time.Second, policy.backoff(2))
+	assert.Equal(t, time.Minute, policy.backoff(10))
+}
@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"fmt"
+)
+
+const mattermostSuccessColor = "#2ecc71"
+const mattermostFailureColor = "#e74c3c"
+
+// MattermostProvider posts to a Mattermost incoming webhook, overriding the channel per env
+type MattermostProvider struct {
+	WebhookURL     string
+	DefaultChannel string
+	ChannelMapping map[string]string
+}
+
+type mattermostMessage struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Text        string                 `json:"text"`
+	Attachments []mattermostAttachment `json:"attachments,omitempty"`
+}
+
+type mattermostAttachment struct {
+	Color string `json:"color,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+func (m *MattermostProvider) name() string {
+	return "mattermost"
+}
+
+func (m *MattermostProvider) send(msg Message) error {
+	mattermostMessage, err := msg.AsMattermostMessage()
+	if err != nil {
+		return fmt.Errorf("cannot create mattermost message: %s", err)
+	}
+
+	if mattermostMessage == nil {
+		return nil
+	}
+
+	channel := m.DefaultChannel
+	if ch, ok := m.ChannelMapping[msg.Env()]; ok {
+		channel = ch
+	}
+	if ch := routedChannel(msg); ch != "" {
+		channel = ch
+	}
+	mattermostMessage.Channel = channel
+
+	err = postJSON(m.WebhookURL, mattermostMessage)
+	if err != nil {
+		return fmt.Errorf("could not post to mattermost: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMattermostProvider(t *testing.T) {
+	var received mattermostMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := &MattermostProvider{
+		WebhookURL:     server.URL,
+		DefaultChannel: "gimletd",
+		ChannelMapping: map[string]string{
+			"production": "incidents",
+		},
+	}
+
+	err := provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:        "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status:     model.HealthCheckFailed,
+		StatusDesc: "deployment/my-app is not ready",
+	}, "production"))
+	assert.Nil(t, err)
+	assert.Equal(t, "incidents", received.Channel)
+	assert.Contains(t, received.Text, "[76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)")
+	assert.Equal(t, mattermostFailureColor, received.Attachments[0].Color)
+	assert.Equal(t, "deployment/my-app is not ready", received.Attachments[0].Text)
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.Progressing,
+	}, "staging"))
+	assert.Nil(t, err)
+	assert.Equal(t, "gimletd", received.Channel)
+
+	server.Close()
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.Progressing,
+	}, "staging"))
+	assert.NotNil(t, err)
+}
@@ -1,12 +1,24 @@
 package notifications
 
-import githubLib "github.com/google/go-github/v37/github"
+import (
+	"fmt"
+)
+
+const githubCommitLinkFormatForMarkdown = "[%s](https://github.com/%s/commit/%s)"
 
 type Message interface {
-	AsSlackMessage() (*slackMessage, error)
-	AsGithubStatus() (*githubLib.RepoStatus, error)
-	AsDiscordMessage() (*discordMessage, error)
+	AsTeamsMessage() (*teamsMessage, error)
+	AsMattermostMessage() (*mattermostMessage, error)
+	AsWebhookMessage() (*webhookMessage, error)
 	Env() string
 	RepositoryName() string
 	SHA() string
 }
+
+// markdownCommitLink links the commit in the markdown of Discord, Mattermost and Teams messages
+func markdownCommitLink(repo string, ref string) string {
+	if len(ref) < 8 {
+		return ""
+	}
+	return fmt.Sprintf(githubCommitLinkFormatForMarkdown, ref[0:7], repo, ref)
+}
@@ -0,0 +1,79 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+)
+
+// outboxMessage is the persisted form of a message in the notification outbox
+type outboxMessage struct {
+	Type         string                `json:"type"`
+	Deploy       *events.DeployEvent   `json:"deploy,omitempty"`
+	Rollback     *events.RollbackEvent `json:"rollback,omitempty"`
+	Delete       *events.DeleteEvent   `json:"delete,omitempty"`
+	GitopsCommit *model.GitopsCommit   `json:"gitopsCommit,omitempty"`
+	GitopsRepo   string                `json:"gitopsRepo,omitempty"`
+	Env          string                `json:"env,omitempty"`
+	Channel      string                `json:"channel,omitempty"`
+}
+
+// marshalMessage serializes the message for the outbox, and returns its type too
+func marshalMessage(msg Message) (string, string, error) {
+	persisted := outboxMessage{
+		Channel: routedChannel(msg),
+	}
+	switch m := unwrapMessage(msg).(type) {
+	case *gitopsDeployMessage:
+		persisted.Type = webhookTypeDeploy
+		persisted.Deploy = m.event
+	case *gitopsRollbackMessage:
+		persisted.Type = webhookTypeRollback
+		persisted.Rollback = m.event
+	case *gitopsDeleteMessage:
+		persisted.Type = webhookTypeDelete
+		persisted.Delete = m.event
+	case *fluxMessage:
+		persisted.Type = webhookTypeGitopsCommit
+		persisted.GitopsCommit = m.gitopsCommit
+		persisted.GitopsRepo = m.gitopsRepo
+		persisted.Env = m.env
+	default:
+		return "", "", fmt.Errorf("cannot persist message of type %T", msg)
+	}
+
+	payload, err := json.Marshal(persisted)
+	if err != nil {
+		return "", "", err
+	}
+	return persisted.Type, string(payload), nil
+}
+
+func unmarshalMessage(payload string) (Message, error) {
+	var persisted outboxMessage
+	err := json.Unmarshal([]byte(payload), &persisted)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse notification: %s", err)
+	}
+
+	var msg Message
+	switch {
+	case persisted.Type == webhookTypeDeploy && persisted.Deploy != nil:
+		msg = MessageFromGitOpsEvent(persisted.Deploy)
+	case persisted.Type == webhookTypeRollback && persisted.Rollback != nil:
+		msg = MessageFromRollbackEvent(persisted.Rollback)
+	case persisted.Type == webhookTypeDelete && persisted.Delete != nil:
+		msg = MessageFromDeleteEvent(persisted.Delete)
+	case persisted.Type == webhookTypeGitopsCommit && persisted.GitopsCommit != nil:
+		msg = NewMessage(persisted.GitopsRepo, persisted.GitopsCommit, persisted.Env)
+	default:
+		return nil, fmt.Errorf("invalid notification of type: %s", persisted.Type)
+	}
+
+	if persisted.Channel != "" {
+		msg = &routedMessage{Message: msg, channel: persisted.Channel}
+	}
+	return msg, nil
+}
@@ -1,5 +1,69 @@
 package notifications
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
 type Provider interface {
 	send(msg Message) error
+	// name identifies the provider in routing rules
+	name() string
+}
+
+// deliveryProvider is implemented by providers that pass a delivery ID to receivers,
+// the outbox gives the same ID on every attempt of a notification so receivers can deduplicate retries
+type deliveryProvider interface {
+	sendDelivery(msg Message, delivery string) error
+}
+
+// permanentError is a failed delivery that retrying won't fix, the outbox gives up on it right away
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// postJSON posts the payload to incoming webhook style APIs
+func postJSON(url string, payload interface{}) error {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("status: %d, response: %s", res.StatusCode, string(body))
+	}
+
+	return nil
 }
@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/model"
+	"gopkg.in/yaml.v2"
+)
+
+// RoutingRule decides where a notification goes.
+// Match fields are glob patterns, empty fields match everything.
+// Rules are evaluated in order, the first rule that matches the message and the provider wins
+type RoutingRule struct {
+	Env        string `yaml:"env"`
+	App        string `yaml:"app"`
+	Repository string `yaml:"repository"`
+	// deploy, rollback, delete or gitopsCommit
+	Type string `yaml:"type"`
+	// success, failure, progressing, or the raw Flux status, eg.: HealthCheckFailed
+	Status string `yaml:"status"`
+
+	// Providers the rule applies to, eg.: slack, teams. Applies to all providers if empty
+	Providers []string `yaml:"providers"`
+	// Channel overrides the env based channel mapping of the provider
+	Channel string `yaml:"channel"`
+	Mute    bool   `yaml:"mute"`
+}
+
+type routingRules struct {
+	Rules []RoutingRule `yaml:"rules"`
+}
+
+// LoadRoutingRules reads the routing rules from a yaml file
+func LoadRoutingRules(rulesPath string) ([]RoutingRule, error) {
+	rulesBytes, err := ioutil.ReadFile(rulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read routing rules: %s", err)
+	}
+
+	var rules routingRules
+	err = yaml.UnmarshalStrict(rulesBytes, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse routing rules: %s", err)
+	}
+
+	for _, rule := range rules.Rules {
+		for _, pattern := range []string{rule.Env, rule.App, rule.Repository, rule.Type, rule.Status} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern in routing rules: %s", pattern)
+			}
+		}
+	}
+
+	return rules.Rules, nil
+}
+
+// routedMessage carries the channel override of a routing rule to the provider
+type routedMessage struct {
+	Message
+	channel string
+}
+
+// routedChannel returns the channel that a routing rule assigned to the message
+func routedChannel(msg Message) string {
+	if routed, ok := msg.(*routedMessage); ok {
+		return routed.channel
+	}
+	return ""
+}
+
+// unwrapMessage returns the original message of a routed message
+func unwrapMessage(msg Message) Message {
+	if routed, ok := msg.(*routedMessage); ok {
+		return routed.Message
+	}
+	return msg
+}
+
+// route returns the message to send to the named provider, or false if the message is muted for it
+func route(rules []RoutingRule, msg Message, provider string) (Message, bool) {
+	if len(rules) == 0 {
+		return msg, true
+	}
+
+	// the webhook message is the provider independent description of the message
+	attributes, err := msg.AsWebhookMessage()
+	if err != nil || attributes == nil {
+		return msg, true
+	}
+
+	for _, rule := range rules {
+		if !rule.appliesTo(provider) || !rule.matches(attributes) {
+			continue
+		}
+
+		if rule.Mute {
+			return nil, false
+		}
+		if rule.Channel != "" {
+			return &routedMessage{Message: msg, channel: rule.Channel}, true
+		}
+		return msg, true
+	}
+
+	return msg, true
+}
+
+func (r *RoutingRule) appliesTo(provider string) bool {
+	if len(r.Providers) == 0 {
+		return true
+	}
+	for _, p := range r.Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RoutingRule) matches(msg *webhookMessage) bool {
+	return match(r.Env, msg.Env) &&
+		match(r.App, msg.App) &&
+		match(r.Repository, msg.Repository) &&
+		match(r.Type, msg.Type) &&
+		(match(r.Status, msg.Status) || match(r.Status, outcome(msg)))
+}
+
+func match(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// outcome groups the Flux statuses, so a single rule can match all failures
+func outcome(msg *webhookMessage) string {
+	if msg.Type != webhookTypeGitopsCommit {
+		return msg.Status
+	}
+
+	switch msg.Status {
+	case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+		return outcomeFailure
+	case model.ReconciliationSucceeded:
+		return outcomeSuccess
+	case model.Progressing:
+		if strings.Contains(msg.StatusDesc, "Health check passed") {
+			return outcomeSuccess
+		}
+	}
+	return outcomeProgressing
+}
@@ -0,0 +1,114 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const rulesYaml = `
+rules:
+  - env: preview-*
+    mute: true
+  - env: production
+    status: failure
+    providers: [slack]
+    channel: incidents
+  - env: production
+    providers: [github]
+    mute: true
+`
+
+func TestLoadRoutingRules(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gimletd-routing")
+	defer os.RemoveAll(dir)
+
+	rulesPath := filepath.Join(dir, "rules.yaml")
+	ioutil.WriteFile(rulesPath, []byte(rulesYaml), 0644)
+	rules, err := LoadRoutingRules(rulesPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rules))
+	assert.Equal(t, []string{"slack"}, rules[1].Providers)
+
+	ioutil.WriteFile(rulesPath, []byte("rules:\n  - env: production\n    chanel: typo\n"), 0644)
+	_, err = LoadRoutingRules(rulesPath)
+	assert.NotNil(t, err, "should not accept unknown fields")
+
+	ioutil.WriteFile(rulesPath, []byte("rules:\n  - env: \"[production\"\n"), 0644)
+	_, err = LoadRoutingRules(rulesPath)
+	assert.NotNil(t, err, "should not accept invalid patterns")
+}
+
+func TestRoute(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gimletd-routing")
+	defer os.RemoveAll(dir)
+	rulesPath := filepath.Join(dir, "rules.yaml")
+	ioutil.WriteFile(rulesPath, []byte(rulesYaml), 0644)
+	rules, _ := LoadRoutingRules(rulesPath)
+
+	deploy := func(env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest: &dx.Manifest{App: "my-app", Env: env},
+			Artifact: &dx.Artifact{},
+			Status:   status,
+		})
+	}
+
+	_, ok := route(rules, deploy("preview-bugfix-123", events.Success), "slack")
+	assert.False(t, ok, "should mute previews")
+
+	routed, ok := route(rules, deploy("production", events.Failure), "slack")
+	assert.True(t, ok)
+	assert.Equal(t, "incidents", routedChannel(routed))
+
+	routed, ok = route(rules, deploy("production", events.Failure), "discord")
+	assert.True(t, ok)
+	assert.Equal(t, "", routedChannel(routed), "should only route for the listed providers")
+
+	routed, ok = route(rules, deploy("production", events.Success), "slack")
+	assert.True(t, ok)
+	assert.Equal(t, "", routedChannel(routed))
+
+	_, ok = route(rules, deploy("production", events.Success), "github")
+	assert.False(t, ok)
+
+	routed, ok = route(rules, NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Status: model.HealthCheckFailed,
+	}, "production"), "slack")
+	assert.True(t, ok)
+	assert.Equal(t, "incidents", routedChannel(routed), "should treat Flux failures as failures")
+
+	_, ok = route(nil, deploy("preview-bugfix-123", events.Success), "slack")
+	assert.True(t, ok, "should send everything without rules")
+}
+
+func TestRoutedChannelOverridesChannelMapping(t *testing.T) {
+	var received mattermostMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := &MattermostProvider{
+		WebhookURL:     server.URL,
+		DefaultChannel: "gimletd",
+		ChannelMapping: map[string]string{"production": "prod"},
+	}
+
+	err := provider.send(&routedMessage{
+		Message: NewMessage("gimlet-io/gitops", &model.GitopsCommit{Status: model.HealthCheckFailed}, "production"),
+		channel: "incidents",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "incidents", received.Channel)
+}
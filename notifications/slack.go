@@ -3,11 +3,16 @@ package notifications
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
 	"github.com/sirupsen/logrus"
 )
 
@@ -15,6 +20,9 @@ const markdown = "mrkdwn"
 const section = "section"
 const contextString = "context"
 
+// slackThreadRetention is how long Flux updates of a gitops commit are threaded under its deploy message
+const slackThreadRetention = 30 * 24 * time.Hour
+
 const githubCommitLinkFormat = "<https://github.com/%s/commit/%s|%s>"
 const bitbucketServerLinkFormat = "<http://%s/projects/%s/repos/%s/commits/%s|%s>"
 
@@ -22,14 +30,38 @@ type SlackProvider struct {
 	Token          string
 	DefaultChannel string
 	ChannelMapping map[string]string
+	// Store keeps track of the deploy messages, so Flux updates of the same gitops commit are threaded under them.
+	// Every message is a separate post without it
+	Store *store.Store
+	// APIURL is the Slack Web API base URL, defaults to https://slack.com/api
+	APIURL string
+	// Templates of the message texts, the built-in templates are used if nil
+	Templates *Templates
 }
 
-type slackMessage struct {
+// slackThread is the posted message that later updates of its gitops commits are threaded under
+type slackThread struct {
+	TS      string  `json:"ts"`
 	Channel string  `json:"channel"`
 	Text    string  `json:"text"`
 	Blocks  []Block `json:"blocks,omitempty"`
 }
 
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	TS      string `json:"ts,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+type slackMessage struct {
+	Channel  string  `json:"channel"`
+	Text     string  `json:"text"`
+	Blocks   []Block `json:"blocks,omitempty"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+	TS       string  `json:"ts,omitempty"`
+}
+
 type Block struct {
 	Type     string `json:"type"`
 	Text     *Text  `json:"text,omitempty"`
@@ -41,8 +73,12 @@ type Text struct {
 	Text string `json:"text"`
 }
 
+func (s *SlackProvider) name() string {
+	return "slack"
+}
+
 func (s *SlackProvider) send(msg Message) error {
-	slackMessage, err := msg.AsSlackMessage()
+	slackMessage, err := s.Templates.slackMessage(msg)
 	if err != nil {
 		return fmt.Errorf("cannot create slack message: %s", err)
 	}
@@ -55,20 +91,127 @@ func (s *SlackProvider) send(msg Message) error {
 	if ch, ok := s.ChannelMapping[msg.Env()]; ok {
 		channel = ch
 	}
+	if ch := routedChannel(msg); ch != "" {
+		channel = ch
+	}
 	slackMessage.Channel = channel
 
-	return s.post(slackMessage)
+	if s.Store == nil {
+		_, err = s.post("chat.postMessage", slackMessage)
+		return err
+	}
+
+	if flux, ok := unwrapMessage(msg).(*fluxMessage); ok {
+		thread, err := s.thread(channel, flux.gitopsCommit.Sha)
+		if err != nil {
+			logrus.Warnf("cannot get slack thread: %s", err)
+		}
+		if thread != nil {
+			return s.reply(thread, slackMessage)
+		}
+	}
+
+	response, err := s.post("chat.postMessage", slackMessage)
+	if err != nil {
+		return err
+	}
+	return s.saveThreads(msg, channel, slackMessage, response)
+}
+
+// reply posts the update in the thread of the original message, and shows the latest status on the original message too
+func (s *SlackProvider) reply(thread *slackThread, msg *slackMessage) error {
+	msg.ThreadTS = thread.TS
+	_, err := s.post("chat.postMessage", msg)
+	if err != nil {
+		return err
+	}
+
+	blocks := append([]Block{}, thread.Blocks...)
+	blocks = append(blocks, Block{
+		Type: contextString,
+		Elements: []Text{
+			{Type: markdown, Text: msg.Text},
+		},
+	})
+	_, err = s.post("chat.update", &slackMessage{
+		Channel: thread.Channel,
+		TS:      thread.TS,
+		Text:    thread.Text,
+		Blocks:  blocks,
+	})
+	if err != nil {
+		// the reply is already posted, retrying would duplicate it
+		logrus.Warnf("cannot update slack message status: %s", err)
+	}
+	return nil
+}
+
+// saveThreads stores the posted message against the gitops commits it announced
+func (s *SlackProvider) saveThreads(msg Message, channel string, posted *slackMessage, response *slackResponse) error {
+	attributes, err := msg.AsWebhookMessage()
+	if err != nil || attributes == nil || attributes.Type == webhookTypeGitopsCommit {
+		return nil
+	}
+	if !response.OK || response.TS == "" {
+		return nil
+	}
+
+	threadBytes, err := json.Marshal(slackThread{
+		TS:      response.TS,
+		Channel: response.Channel,
+		Text:    posted.Text,
+		Blocks:  posted.Blocks,
+	})
+	if err != nil {
+		return nil
+	}
+
+	for _, gitopsRef := range attributes.GitopsRefs {
+		err := s.Store.SaveKeyValue(&model.KeyValue{
+			Key:     slackThreadKey(channel, gitopsRef),
+			Value:   string(threadBytes),
+			Expires: time.Now().Add(slackThreadRetention).Unix(),
+		})
+		if err != nil {
+			logrus.Warnf("cannot save slack thread: %s", err)
+		}
+	}
+	return nil
 }
 
-func (s *SlackProvider) post(msg *slackMessage) error {
+func (s *SlackProvider) thread(channel string, gitopsRef string) (*slackThread, error) {
+	keyValue, err := s.Store.KeyValue(slackThreadKey(channel, gitopsRef))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var thread slackThread
+	err = json.Unmarshal([]byte(keyValue.Value), &thread)
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+func slackThreadKey(channel string, gitopsRef string) string {
+	return fmt.Sprintf("slackThread/%s/%s", channel, gitopsRef)
+}
+
+func (s *SlackProvider) post(method string, msg *slackMessage) (*slackResponse, error) {
 	b := new(bytes.Buffer)
 	err := json.NewEncoder(b).Encode(msg)
 	if err != nil {
 		logrus.Printf("Could encode message to slack: %v", err)
-		return err
+		return nil, err
 	}
 
-	req, _ := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", b)
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = "https://slack.com/api"
+	}
+	req, _ := http.NewRequest("POST", apiURL+"/"+method, b)
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.Token))
 	req = req.WithContext(context.TODO())
@@ -77,28 +220,73 @@ func (s *SlackProvider) post(msg *slackMessage) error {
 	res, err := client.Do(req)
 	if err != nil {
 		logrus.Printf("could not post to slack: %v", err)
-		return err
+		return nil, err
 	}
+	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
-	var parsed map[string]interface{}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read slack response: %s", err)
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("could not post to slack, status: %d, response: %s", res.StatusCode, string(body))
+	}
+
+	var parsed slackResponse
 	err = json.Unmarshal(body, &parsed)
 	if err != nil {
-		return fmt.Errorf("cannot parse slack response: %s", err)
+		return nil, fmt.Errorf("cannot parse slack response: %s", err)
 	}
-	if val, ok := parsed["ok"]; ok {
-		if val != true {
-			logrus.Infof("Slack response: %s", string(body))
-		}
-	} else {
-		logrus.Infof("Slack response: %s", string(body))
+	if !parsed.OK {
+		return nil, fmt.Errorf("could not post to slack: %s", parsed.Error)
 	}
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf("could not post to slack, status: %d", res.StatusCode)
+	return &parsed, nil
+}
+
+// slackMessage assembles the message from the "text", "details" and "context" templates.
+// Every line of the context becomes an element of the context block
+func (t *Templates) slackMessage(msg Message) (*slackMessage, error) {
+	parts, err := t.render("slack", msg, "text", "details", "context")
+	if err != nil || parts == nil {
+		return nil, err
 	}
 
-	return nil
+	slackMessage := &slackMessage{
+		Text: parts["text"],
+		Blocks: []Block{
+			{
+				Type: section,
+				Text: &Text{Type: markdown, Text: parts["text"]},
+			},
+		},
+	}
+
+	if parts["details"] != "" {
+		slackMessage.Blocks = append(slackMessage.Blocks, Block{
+			Type:     contextString,
+			Elements: []Text{{Type: markdown, Text: parts["details"]}},
+		})
+	}
+
+	var elements []Text
+	for _, line := range strings.Split(parts["context"], "\n") {
+		if line != "" {
+			elements = append(elements, Text{Type: markdown, Text: line})
+		}
+	}
+	// Slack allows ten elements in a context block
+	if len(elements) > 10 {
+		elements = elements[:10]
+	}
+	if len(elements) > 0 {
+		slackMessage.Blocks = append(slackMessage.Blocks, Block{
+			Type:     contextString,
+			Elements: elements,
+		})
+	}
+
+	return slackMessage, nil
 }
 
 func commitLink(repo string, ref string) string {
@@ -0,0 +1,105 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type slackCall struct {
+	method  string
+	message slackMessage
+}
+
+func TestSlackThreads(t *testing.T) {
+	var calls []slackCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		calls = append(calls, slackCall{method: r.URL.Path, message: msg})
+		json.NewEncoder(w).Encode(slackResponse{OK: true, TS: "1629280000.000100", Channel: "C0123"})
+	}))
+	defer server.Close()
+
+	store := store.NewTest()
+	provider := &SlackProvider{
+		Token:          "xoxb",
+		DefaultChannel: "gimletd",
+		Store:          store,
+		APIURL:         server.URL,
+	}
+
+	err := provider.send(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest:    &dx.Manifest{App: "my-app", Env: "staging"},
+		Artifact:    &dx.Artifact{},
+		TriggeredBy: "policy",
+		GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		GitopsRepo:  "gimlet-io/gitops",
+	}))
+	assert.Nil(t, err)
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:        "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status:     model.Progressing,
+		StatusDesc: "Health check passed",
+	}, "staging"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(calls))
+	assert.Equal(t, "/chat.postMessage", calls[0].method)
+	assert.Equal(t, "", calls[0].message.ThreadTS)
+
+	assert.Equal(t, "/chat.postMessage", calls[1].method)
+	assert.Equal(t, "1629280000.000100", calls[1].message.ThreadTS, "should reply in the thread of the deploy message")
+
+	assert.Equal(t, "/chat.update", calls[2].method)
+	assert.Equal(t, "C0123", calls[2].message.Channel, "should update by channel ID")
+	assert.Equal(t, "1629280000.000100", calls[2].message.TS)
+	assert.Equal(t, calls[0].message.Text, calls[2].message.Text)
+	assert.Equal(t, len(calls[0].message.Blocks)+1, len(calls[2].message.Blocks), "should add the status to the original message")
+
+	err = provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "another-gitops-sha",
+		Status: model.Progressing,
+	}, "staging"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(calls))
+	assert.Equal(t, "", calls[3].message.ThreadTS, "should post updates of unknown commits on their own")
+
+	thread, err := provider.thread("gimletd", "76ab7d611242f7c6742f0ab662133e02b2ba2b1c")
+	assert.Nil(t, err)
+	assert.NotNil(t, thread)
+	_, err = store.DeleteExpiredKeyValues(time.Now().Add(slackThreadRetention + time.Minute).Unix())
+	assert.Nil(t, err)
+	thread, err = provider.thread("gimletd", "76ab7d611242f7c6742f0ab662133e02b2ba2b1c")
+	assert.Nil(t, err)
+	assert.Nil(t, thread, "should expire threads")
+}
+
+func TestSlackError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(slackResponse{OK: false, Error: "channel_not_found"})
+	}))
+	defer server.Close()
+
+	provider := &SlackProvider{
+		Token:          "xoxb",
+		DefaultChannel: "gimletd",
+		APIURL:         server.URL,
+	}
+
+	err := provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.Progressing,
+	}, "staging"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "channel_not_found")
+}
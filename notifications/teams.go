@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"fmt"
+)
+
+const adaptiveCardSchema = "http://adaptivecards.io/schemas/adaptive-card.json"
+const adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+// TeamsProvider posts Adaptive Cards to Microsoft Teams incoming webhooks.
+// Every Teams channel has its own incoming webhook, so envs and channel names are mapped to webhook URLs
+type TeamsProvider struct {
+	DefaultWebhookURL string
+	WebhookMapping    map[string]string
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string        `json:"$schema"`
+	Type    string        `json:"type"`
+	Version string        `json:"version"`
+	Body    []cardElement `json:"body"`
+}
+
+type cardElement struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func (t *TeamsProvider) name() string {
+	return "teams"
+}
+
+func (t *TeamsProvider) send(msg Message) error {
+	teamsMessage, err := msg.AsTeamsMessage()
+	if err != nil {
+		return fmt.Errorf("cannot create teams message: %s", err)
+	}
+
+	if teamsMessage == nil {
+		return nil
+	}
+
+	webhookURL := t.DefaultWebhookURL
+	if url, ok := t.WebhookMapping[msg.Env()]; ok {
+		webhookURL = url
+	}
+	// routing rules refer to channels by their key in the webhook mapping
+	if url, ok := t.WebhookMapping[routedChannel(msg)]; ok {
+		webhookURL = url
+	}
+	if webhookURL == "" {
+		return nil
+	}
+
+	err = postJSON(webhookURL, teamsMessage)
+	if err != nil {
+		return fmt.Errorf("could not post to teams: %s", err)
+	}
+	return nil
+}
+
+// newTeamsMessage renders a card with a title, an optional detail block and a fact list
+func newTeamsMessage(title string, details string, failed bool, facts []teamsFact) *teamsMessage {
+	titleBlock := cardElement{
+		Type:   "TextBlock",
+		Text:   title,
+		Weight: "bolder",
+		Wrap:   true,
+	}
+	if failed {
+		titleBlock.Color = "attention"
+	}
+
+	body := []cardElement{titleBlock}
+	if details != "" {
+		body = append(body, cardElement{
+			Type: "TextBlock",
+			Text: details,
+			Wrap: true,
+		})
+	}
+	if len(facts) > 0 {
+		body = append(body, cardElement{
+			Type:  "FactSet",
+			Facts: facts,
+		})
+	}
+
+	return &teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{
+				ContentType: adaptiveCardContentType,
+				Content: adaptiveCard{
+					Schema:  adaptiveCardSchema,
+					Type:    "AdaptiveCard",
+					Version: "1.2",
+					Body:    body,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamsProvider(t *testing.T) {
+	var received teamsMessage
+	var receivedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := &TeamsProvider{
+		DefaultWebhookURL: server.URL + "/default",
+		WebhookMapping: map[string]string{
+			"production": server.URL + "/production",
+		},
+	}
+
+	err := provider.send(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{
+			App: "my-app",
+			Env: "production",
+		},
+		Artifact: &dx.Artifact{
+			Version: dx.Version{
+				RepositoryName: "gimlet-io/my-app",
+			},
+		},
+		Status:     events.Failure,
+		StatusDesc: "cannot render manifest",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "/production", receivedPath, "should post to the webhook mapped to the env")
+
+	assert.Equal(t, 1, len(received.Attachments))
+	card := received.Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+	assert.Equal(t, "Failed to roll out my-app of gimlet-io/my-app", card.Body[0].Text)
+	assert.Equal(t, "attention", card.Body[0].Color)
+	assert.Equal(t, "cannot render manifest", card.Body[1].Text)
+
+	err = provider.send(MessageFromDeleteEvent(&events.DeleteEvent{
+		App:         "my-app",
+		Env:         "staging",
+		TriggeredBy: "policy",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "/default", receivedPath)
+}
@@ -0,0 +1,203 @@
+package notifications
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+var templateProviders = []string{"slack", "discord", "github"}
+var templateTypes = []string{webhookTypeDeploy, webhookTypeRollback, webhookTypeDelete, webhookTypeGitopsCommit}
+
+var templateFuncs = template.FuncMap{
+	"title":              strings.Title,
+	"contains":           strings.Contains,
+	"commitLink":         commitLink,
+	"discordCommitLink":  markdownCommitLink, // kept for custom templates that use it
+	"markdownCommitLink": markdownCommitLink,
+	"now":                time.Now,
+}
+
+var defaultTemplates = mustLoadBuiltinTemplates()
+
+// Templates are the Go templates of the notification texts, one per provider and message type.
+// A template defines the parts of the message, like {{define "text"}}, that the provider assembles
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// templateData is what the templates can refer to
+type templateData struct {
+	Type string
+	// Status is success or failure for releases, and the Flux status for gitops commits
+	Status      string
+	StatusDesc  string
+	Failed      bool
+	Env         string
+	App         string
+	Repository  string
+	SHA         string
+	TriggeredBy string
+	GitopsRepo  string
+	GitopsRef   string
+	GitopsRefs  []string
+
+	Artifact     *dx.Artifact
+	Manifest     *dx.Manifest
+	Rollback     *dx.RollbackRequest
+	GitopsCommit *model.GitopsCommit
+}
+
+// LoadTemplates returns the built-in templates overridden by the <provider>/<type>.tmpl files of dir,
+// then by the templates stored under the notificationTemplate/<provider>/<type> keys.
+// dir and store are both optional
+func LoadTemplates(dir string, store *store.Store) (*Templates, error) {
+	templates := &Templates{templates: map[string]*template.Template{}}
+	for key, t := range defaultTemplates.templates {
+		templates.templates[key] = t
+	}
+
+	for _, provider := range templateProviders {
+		for _, messageType := range templateTypes {
+			key := templateKey(provider, messageType)
+
+			if dir != "" {
+				content, err := ioutil.ReadFile(filepath.Join(dir, key+".tmpl"))
+				if err == nil {
+					err = templates.parse(key, string(content))
+				}
+				if err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("cannot load template %s: %s", key, err)
+				}
+			}
+
+			if store != nil {
+				keyValue, err := store.KeyValue("notificationTemplate/" + key)
+				if err == nil {
+					err = templates.parse(key, keyValue.Value)
+				}
+				if err != nil && err != sql.ErrNoRows {
+					return nil, fmt.Errorf("cannot load template %s from the database: %s", key, err)
+				}
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+func mustLoadBuiltinTemplates() *Templates {
+	templates := &Templates{templates: map[string]*template.Template{}}
+	for _, provider := range templateProviders {
+		for _, messageType := range templateTypes {
+			key := templateKey(provider, messageType)
+			content, err := builtinTemplates.ReadFile("templates/" + key + ".tmpl")
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				panic(err)
+			}
+
+			err = templates.parse(key, string(content))
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	return templates
+}
+
+func (t *Templates) parse(key string, content string) error {
+	parsed, err := template.New(key).Funcs(templateFuncs).Parse(content)
+	if err != nil {
+		return err
+	}
+	t.templates[key] = parsed
+	return nil
+}
+
+// render executes the parts of the provider's template for the message.
+// It returns nil if there is no template for the message type
+func (t *Templates) render(provider string, msg Message, parts ...string) (map[string]string, error) {
+	if t == nil {
+		t = defaultTemplates
+	}
+
+	data, err := newTemplateData(msg)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	tmpl, ok := t.templates[templateKey(provider, data.Type)]
+	if !ok {
+		return nil, nil
+	}
+
+	rendered := map[string]string{}
+	for _, part := range parts {
+		if tmpl.Lookup(part) == nil {
+			continue
+		}
+
+		b := new(bytes.Buffer)
+		err := tmpl.ExecuteTemplate(b, part, data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render %s template: %s", tmpl.Name(), err)
+		}
+		rendered[part] = b.String()
+	}
+	return rendered, nil
+}
+
+func newTemplateData(msg Message) (*templateData, error) {
+	attributes, err := msg.AsWebhookMessage()
+	if err != nil || attributes == nil {
+		return nil, err
+	}
+
+	data := &templateData{
+		Type:        attributes.Type,
+		Status:      attributes.Status,
+		StatusDesc:  attributes.StatusDesc,
+		Failed:      outcome(attributes) == outcomeFailure,
+		Env:         attributes.Env,
+		App:         attributes.App,
+		Repository:  attributes.Repository,
+		SHA:         attributes.SHA,
+		TriggeredBy: attributes.TriggeredBy,
+		GitopsRepo:  attributes.GitopsRepo,
+		GitopsRefs:  attributes.GitopsRefs,
+	}
+	if len(attributes.GitopsRefs) > 0 {
+		data.GitopsRef = attributes.GitopsRefs[0]
+	}
+
+	switch m := unwrapMessage(msg).(type) {
+	case *gitopsDeployMessage:
+		data.Artifact = m.event.Artifact
+		data.Manifest = m.event.Manifest
+	case *gitopsRollbackMessage:
+		data.Rollback = m.event.RollbackRequest
+	case *fluxMessage:
+		data.GitopsCommit = m.gitopsCommit
+	}
+	return data, nil
+}
+
+func templateKey(provider string, messageType string) string {
+	return provider + "/" + messageType
+}
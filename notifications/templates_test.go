@@ -0,0 +1,294 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	githubLib "github.com/google/go-github/v37/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	slackMessage, err := defaultTemplates.slackMessage(deployMessage("staging", events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, "Policy based rollout of my-app on gimlet-io/my-app", slackMessage.Text)
+	assert.Equal(t, []Block{
+		{Type: section, Text: &Text{Type: markdown, Text: "Policy based rollout of my-app on gimlet-io/my-app"}},
+		{Type: contextString, Elements: []Text{
+			{Type: markdown, Text: ":dart: Staging"},
+			{Type: markdown, Text: ":clipboard: "},
+			{Type: markdown, Text: ":paperclip: "},
+		}},
+	}, slackMessage.Blocks)
+
+	slackMessage, err = defaultTemplates.slackMessage(deployMessage("staging", events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(slackMessage.Blocks))
+	assert.Equal(t, ":exclamation: *Error* :exclamation: \n", slackMessage.Blocks[1].Elements[0].Text)
+
+	discordMessage, err := defaultTemplates.discordMessage(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:        "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status:     model.HealthCheckFailed,
+		StatusDesc: "my-app is not ready",
+	}, "staging"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Health check", discordMessage.Text)
+	assert.Equal(t, ":ambulance: Gitops changes from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c) have health issues", discordMessage.Embed.Description)
+	assert.Equal(t, 15158332, discordMessage.Embed.Color)
+
+	status, err := defaultTemplates.githubStatus(deployMessage("staging", events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, "success", *status.State)
+	assert.Equal(t, "https://github.com/gimlet-io/gitops/commit/abc123", *status.TargetURL)
+	assert.Regexp(t, "^gitops/staging@", *status.Context)
+
+	status, err = defaultTemplates.githubStatus(NewMessage("gimlet-io/gitops", &model.GitopsCommit{}, "staging"))
+	assert.Nil(t, err)
+	assert.Nil(t, status, "gitops commits should not have commit statuses")
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gimletd-templates")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "slack"), 0755)
+	ioutil.WriteFile(
+		filepath.Join(dir, "slack", "deploy.tmpl"),
+		[]byte(`{{define "text"}}{{.Manifest.App}} {{.Artifact.Version.SHA}} to {{.Env}}{{end}}`),
+		0644,
+	)
+
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+	s.SaveKeyValue(&model.KeyValue{
+		Key:   "notificationTemplate/discord/deploy",
+		Value: `{{define "text"}}{{.TriggeredBy}} deployed {{.App}}{{end}}{{define "color"}}42{{end}}`,
+	})
+
+	templates, err := LoadTemplates(dir, s)
+	assert.Nil(t, err)
+
+	slackMessage, err := templates.slackMessage(deployMessage("staging", events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app ea9ab7cc31b2599bf4afcfd639da516ca27a4780 to staging", slackMessage.Text)
+	assert.Equal(t, 1, len(slackMessage.Blocks), "should not render the parts the template does not define")
+
+	discordMessage, err := templates.discordMessage(deployMessage("staging", events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, "policy deployed my-app", discordMessage.Text)
+	assert.Equal(t, 42, discordMessage.Embed.Color)
+
+	slackMessage, err = templates.slackMessage(&routedMessage{
+		Message: MessageFromDeleteEvent(&events.DeleteEvent{Env: "staging", App: "my-app", TriggeredBy: "policy"}),
+		channel: "deletes",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Policy based deletion of my-app on staging", slackMessage.Text, "should fall back to the built-in templates")
+
+	ioutil.WriteFile(filepath.Join(dir, "slack", "deploy.tmpl"), []byte(`{{define "text"}}{{.App}`), 0644)
+	_, err = LoadTemplates(dir, nil)
+	assert.NotNil(t, err, "should not accept invalid templates")
+}
+
+// TestDefaultTemplatesMatchLegacyMessages compares the output of the built-in templates
+// with the messages that were rendered in code before templates were introduced
+func TestDefaultTemplatesMatchLegacyMessages(t *testing.T) {
+	legacy := []struct {
+		name    string
+		slack   string
+		discord string
+		github  string
+	}{
+		{
+			name:    "deploy by policy",
+			slack:   `{"channel":"","text":"Policy based rollout of my-app on gimlet-io/my-app","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"Policy based rollout of my-app on gimlet-io/my-app"}},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},{"type":"mrkdwn","text":":paperclip: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}]}]}`,
+			discord: `{"text":"Policy based rollout of my-app on gimlet-io/my-app","embed":{"type":"article","description":":dart: Staging\n:clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780\n:paperclip: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)\n","color":3066993}}`,
+			github:  `{"state":"success","target_url":"https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c","description":"cannot render chart","context":"gitops/staging@"}`,
+		},
+		{
+			name:    "deploy by user",
+			slack:   `{"channel":"","text":"jane is rolling out my-app on gimlet-io/my-app","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"jane is rolling out my-app on gimlet-io/my-app"}},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},{"type":"mrkdwn","text":":paperclip: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}]}]}`,
+			discord: `{"text":"jane is rolling out my-app on gimlet-io/my-app","embed":{"type":"article","description":":dart: Staging\n:clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780\n:paperclip: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)\n","color":3066993}}`,
+			github:  `{"state":"success","target_url":"https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c","description":"cannot render chart","context":"gitops/staging@"}`,
+		},
+		{
+			name:    "failed deploy",
+			slack:   `{"channel":"","text":"Failed to roll out my-app of gimlet-io/my-app","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"Failed to roll out my-app of gimlet-io/my-app"}},{"type":"context","elements":[{"type":"mrkdwn","text":":exclamation: *Error* :exclamation: \ncannot render chart"}]},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780"}]}]}`,
+			discord: `{"text":"Failed to roll out my-app of gimlet-io/my-app","embed":{"type":"article","description":":exclamation: *Error* :exclamation: \ncannot render chart\n:dart: Staging\n:clipboard: https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780\n","color":15158332}}`,
+			github:  `{"state":"failure","description":"cannot render chart","context":"gitops/staging@"}`,
+		},
+		{
+			name:    "rollback",
+			slack:   `{"channel":"","text":"🔙 jane is rolling back my-app on staging","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"🔙 jane is rolling back my-app on staging"}},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":clipboard: 5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d"},{"type":"mrkdwn","text":":paperclip: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}]}]}`,
+			discord: `{"text":":arrow_backward: jane is rolling back my-app on staging","embed":{"type":"article","description":":dart: Staging\n:clipboard: 5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d\n:paperclip: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)\n","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "failed rollback",
+			slack:   `{"channel":"","text":"Failed to roll back my-app of staging","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"Failed to roll back my-app of staging"}},{"type":"context","elements":[{"type":"mrkdwn","text":":exclamation: *Error* :exclamation: \ncannot revert"}]},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":clipboard: 5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d"}]}]}`,
+			discord: `{"text":"Failed to roll back my-app of staging","embed":{"type":"article","description":":exclamation: *Error* :exclamation: \ncannot revert\n:dart: Staging\n:clipboard: 5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d\n","color":15158332}}`,
+			github:  `null`,
+		},
+		{
+			name:    "delete by policy",
+			slack:   `{"channel":"","text":"Policy based deletion of my-app on staging","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"Policy based deletion of my-app on staging"}},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":paperclip: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}]}]}`,
+			discord: `{"text":"Policy based deletion of my-app on staging","embed":{"type":"article","description":":dart: Staging\n:paperclip: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)\n","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "delete by user",
+			slack:   `{"channel":"","text":"jane is deleting my-app on staging","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"jane is deleting my-app on staging"}},{"type":"context","elements":[{"type":"mrkdwn","text":":dart: Staging"},{"type":"mrkdwn","text":":paperclip: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}]}]}`,
+			discord: `{"text":"jane is deleting my-app on staging","embed":{"type":"article","description":":dart: Staging\n:paperclip: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)\n","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "failed delete",
+			slack:   `{"channel":"","text":"Failed to delete my-app of staging","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"Failed to delete my-app of staging"}},{"type":"context","elements":[{"type":"mrkdwn","text":":exclamation: *Error* :exclamation: \ncannot delete"}]}]}`,
+			discord: `{"text":"Failed to delete my-app of staging","embed":{"type":"article","description":":exclamation: *Error* :exclamation: \ncannot delete","color":15158332}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux health check passed",
+			slack:   `{"channel":"","text":":heavy_check_mark: Applied resources from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e are up and healthy","blocks":[{"type":"section","text":{"type":"mrkdwn","text":":heavy_check_mark: Applied resources from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e are up and healthy"}},{"type":"context","elements":[{"type":"mrkdwn","text":"Health check passed"}]}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":":heavy_check_mark: Applied resources from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c) are up and healthy","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux progressing",
+			slack:   `{"channel":"","text":":hourglass_flowing_sand: Applying gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e","blocks":[{"type":"section","text":{"type":"mrkdwn","text":":hourglass_flowing_sand: Applying gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":":hourglass_flowing_sand: Applying gitops changes from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux reconciliation succeeded",
+			slack:   `{"channel":"","text":"ReconciliationSucceeded: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"ReconciliationSucceeded: \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e"}}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":"ReconciliationSucceeded: [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c)","color":3066993}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux validation failed",
+			slack:   `{"channel":"","text":":exclamation: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e failed to apply","blocks":[{"type":"section","text":{"type":"mrkdwn","text":":exclamation: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e failed to apply"}},{"type":"context","elements":[{"type":"mrkdwn","text":"invalid manifest"}]}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":":exclamation: Gitops changes from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c) failed to apply","color":15158332}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux reconciliation failed",
+			slack:   `{"channel":"","text":":exclamation: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e failed to apply","blocks":[{"type":"section","text":{"type":"mrkdwn","text":":exclamation: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e failed to apply"}},{"type":"context","elements":[{"type":"mrkdwn","text":"apply failed"}]}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":":exclamation: Gitops changes from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c) failed to apply","color":15158332}}`,
+			github:  `null`,
+		},
+		{
+			name:    "flux health check failed",
+			slack:   `{"channel":"","text":":ambulance: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e have health issues","blocks":[{"type":"section","text":{"type":"mrkdwn","text":":ambulance: Gitops changes from \u003chttps://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c|76ab7d6\u003e have health issues"}},{"type":"context","elements":[{"type":"mrkdwn","text":"my-app is not ready"}]}]}`,
+			discord: `{"text":"Health check","embed":{"type":"article","description":":ambulance: Gitops changes from [76ab7d6](https://github.com/gimlet-io/gitops/commit/76ab7d611242f7c6742f0ab662133e02b2ba2b1c) have health issues","color":15158332}}`,
+			github:  `null`,
+		},
+	}
+
+	messages := legacyMessages()
+	for i, expected := range legacy {
+		msg := messages[i].msg
+		assert.Equal(t, expected.name, messages[i].name)
+
+		slackMessage, err := defaultTemplates.slackMessage(msg)
+		assert.Nil(t, err)
+		slackJSON, _ := json.Marshal(slackMessage)
+		assert.JSONEq(t, expected.slack, string(slackJSON), expected.name)
+
+		discordMessage, err := defaultTemplates.discordMessage(msg)
+		assert.Nil(t, err)
+		discordJSON, _ := json.Marshal(discordMessage)
+		assert.JSONEq(t, expected.discord, string(discordJSON), expected.name)
+
+		status, err := defaultTemplates.githubStatus(msg)
+		assert.Nil(t, err)
+		if status != nil {
+			status.Context = githubLib.String(strings.SplitAfter(status.GetContext(), "@")[0])
+		}
+		statusJSON, _ := json.Marshal(status)
+		assert.JSONEq(t, expected.github, string(statusJSON), expected.name)
+	}
+}
+
+func legacyMessages() []struct {
+	name string
+	msg  Message
+} {
+	artifact := &dx.Artifact{Version: dx.Version{
+		RepositoryName: "gimlet-io/my-app",
+		SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+		URL:            "https://github.com/gimlet-io/my-app/commit/ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+	}}
+	deploy := func(triggeredBy string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest:    &dx.Manifest{App: "my-app", Env: "staging"},
+			Artifact:    artifact,
+			TriggeredBy: triggeredBy,
+			Status:      status,
+			StatusDesc:  "cannot render chart",
+			GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+			GitopsRepo:  "gimlet-io/gitops",
+		})
+	}
+	rollback := func(status events.Status) Message {
+		return MessageFromRollbackEvent(&events.RollbackEvent{
+			RollbackRequest: &dx.RollbackRequest{
+				Env:         "staging",
+				App:         "my-app",
+				TargetSHA:   "5c0e2f2a1d3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d",
+				TriggeredBy: "jane",
+			},
+			Status:     status,
+			StatusDesc: "cannot revert",
+			GitopsRefs: []string{"76ab7d611242f7c6742f0ab662133e02b2ba2b1c"},
+			GitopsRepo: "gimlet-io/gitops",
+		})
+	}
+	del := func(triggeredBy string, status events.Status) Message {
+		return MessageFromDeleteEvent(&events.DeleteEvent{
+			Env:         "staging",
+			App:         "my-app",
+			TriggeredBy: triggeredBy,
+			Status:      status,
+			StatusDesc:  "cannot delete",
+			GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+			GitopsRepo:  "gimlet-io/gitops",
+		})
+	}
+	flux := func(status string, statusDesc string) Message {
+		return NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+			Sha:        "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+			Status:     status,
+			StatusDesc: statusDesc,
+		}, "staging")
+	}
+
+	return []struct {
+		name string
+		msg  Message
+	}{
+		{"deploy by policy", deploy("policy", events.Success)},
+		{"deploy by user", deploy("jane", events.Success)},
+		{"failed deploy", deploy("policy", events.Failure)},
+		{"rollback", rollback(events.Success)},
+		{"failed rollback", rollback(events.Failure)},
+		{"delete by policy", del("policy", events.Success)},
+		{"delete by user", del("jane", events.Success)},
+		{"failed delete", del("jane", events.Failure)},
+		{"flux health check passed", flux(model.Progressing, "Health check passed")},
+		{"flux progressing", flux(model.Progressing, "progressing")},
+		{"flux reconciliation succeeded", flux(model.ReconciliationSucceeded, "")},
+		{"flux validation failed", flux(model.ValidationFailed, "invalid manifest")},
+		{"flux reconciliation failed", flux(model.ReconciliationFailed, "apply failed")},
+		{"flux health check failed", flux(model.HealthCheckFailed, "my-app is not ready")},
+	}
+}
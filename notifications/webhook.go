@@ -0,0 +1,160 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/google/uuid"
+)
+
+// WebhookSignatureHeader holds the hex encoded HMAC-SHA256 of the payload, in the sha256=<signature> format
+const WebhookSignatureHeader = "X-Gimlet-Webhook-Signature"
+
+// WebhookEventHeader holds the type of the message, so receivers can route without parsing the body
+const WebhookEventHeader = "X-Gimlet-Webhook-Event"
+
+// WebhookDeliveryHeader is a unique ID of the message, kept the same between retries
+const WebhookDeliveryHeader = "X-Gimlet-Webhook-Delivery"
+
+const webhookSchemaVersion = 1
+
+const (
+	webhookTypeDeploy       = "deploy"
+	webhookTypeRollback     = "rollback"
+	webhookTypeDelete       = "delete"
+	webhookTypeGitopsCommit = "gitopsCommit"
+)
+
+const (
+	outcomeSuccess     = "success"
+	outcomeFailure     = "failure"
+	outcomeProgressing = "progressing"
+)
+
+// WebhookProvider posts messages to a generic webhook. Failed deliveries are retried by the outbox,
+// client errors are not retried
+type WebhookProvider struct {
+	URL    string
+	Secret string
+}
+
+// webhookMessage is the JSON schema posted to webhooks. Fields are only ever added to it,
+// breaking changes bump the version field
+type webhookMessage struct {
+	Version     int      `json:"version"`
+	Type        string   `json:"type"`
+	Status      string   `json:"status"`
+	StatusDesc  string   `json:"statusDesc,omitempty"`
+	Env         string   `json:"env"`
+	App         string   `json:"app,omitempty"`
+	Repository  string   `json:"repository,omitempty"`
+	SHA         string   `json:"sha,omitempty"`
+	ArtifactID  string   `json:"artifactId,omitempty"`
+	TriggeredBy string   `json:"triggeredBy,omitempty"`
+	GitopsRepo  string   `json:"gitopsRepo,omitempty"`
+	GitopsRefs  []string `json:"gitopsRefs,omitempty"`
+	Created     int64    `json:"created"`
+}
+
+func NewWebhookProvider(url string, secret string) *WebhookProvider {
+	return &WebhookProvider{
+		URL:    url,
+		Secret: secret,
+	}
+}
+
+func (w *WebhookProvider) name() string {
+	return "webhook"
+}
+
+func (w *WebhookProvider) send(msg Message) error {
+	return w.sendDelivery(msg, uuid.New().String())
+}
+
+func (w *WebhookProvider) sendDelivery(msg Message, delivery string) error {
+	webhookMessage, err := msg.AsWebhookMessage()
+	if err != nil {
+		return &permanentError{fmt.Errorf("cannot create webhook message: %s", err)}
+	}
+
+	if webhookMessage == nil {
+		return nil
+	}
+
+	webhookMessage.Version = webhookSchemaVersion
+	webhookMessage.Created = time.Now().Unix()
+	payload, err := json.Marshal(webhookMessage)
+	if err != nil {
+		return &permanentError{fmt.Errorf("cannot serialize webhook message: %s", err)}
+	}
+
+	return w.post(payload, webhookMessage.Type, delivery)
+}
+
+// post delivers the payload, failures that are not worth retrying are returned as permanent errors
+func (w *WebhookProvider) post(payload []byte, messageType string, delivery string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(WebhookEventHeader, messageType)
+	req.Header.Set(WebhookDeliveryHeader, delivery)
+	if w.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(w.Secret, payload))
+	}
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post to webhook: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not post to webhook, status: %d, cannot read response: %s", res.StatusCode, err)
+	}
+	err = fmt.Errorf("could not post to webhook, status: %d, response: %s", res.StatusCode, string(body))
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return &permanentError{err}
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of the payload, receivers use it to verify webhooks
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookStatus(status events.Status) string {
+	if status == events.Failure {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+func gitopsRefs(gitopsRef string) []string {
+	if gitopsRef == "" {
+		return nil
+	}
+	return []string{gitopsRef}
+}
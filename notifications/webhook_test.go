@@ -0,0 +1,88 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	var deliveries []string
+	var received webhookMessage
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		deliveries = append(deliveries, r.Header.Get(WebhookDeliveryHeader))
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+SignWebhookPayload("secret", body), r.Header.Get(WebhookSignatureHeader))
+		assert.Equal(t, webhookTypeDeploy, r.Header.Get(WebhookEventHeader))
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	provider := NewWebhookProvider(server.URL, "secret")
+
+	msg := MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{
+			App: "my-app",
+			Env: "staging",
+		},
+		Artifact: &dx.Artifact{
+			ID: "my-app-123",
+			Version: dx.Version{
+				RepositoryName: "gimlet-io/my-app",
+				SHA:            "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			},
+		},
+		TriggeredBy: "policy",
+		GitopsRef:   "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		GitopsRepo:  "gimlet-io/gitops",
+	})
+	err := provider.sendDelivery(msg, "delivery-1")
+	assert.NotNil(t, err)
+	assert.False(t, isPermanent(err), "should retry server errors")
+
+	err = provider.sendDelivery(msg, "delivery-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, deliveries[0], deliveries[1], "should keep the delivery ID between retries")
+
+	assert.Equal(t, webhookSchemaVersion, received.Version)
+	assert.Equal(t, "success", received.Status)
+	assert.Equal(t, "staging", received.Env)
+	assert.Equal(t, "my-app", received.App)
+	assert.Equal(t, "my-app-123", received.ArtifactID)
+	assert.Equal(t, []string{"76ab7d611242f7c6742f0ab662133e02b2ba2b1c"}, received.GitopsRefs)
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	provider := NewWebhookProvider(server.URL, "")
+
+	err := provider.send(NewMessage("gimlet-io/gitops", &model.GitopsCommit{
+		Sha:    "76ab7d611242f7c6742f0ab662133e02b2ba2b1c",
+		Status: model.ReconciliationSucceeded,
+	}, "staging"))
+	assert.NotNil(t, err)
+	assert.True(t, isPermanent(err), "should not retry client errors")
+	assert.Equal(t, 1, attempts)
+}
@@ -1,26 +1,66 @@
 package server
 
 import (
+	"crypto/ed25519"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// idempotencyKeyHeader lets clients control artifact deduplication within the repository,
+// otherwise the repository, SHA, git event and refs of the artifact are used
+const idempotencyKeyHeader = "Idempotency-Key"
+
 func saveArtifact(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	store := ctx.Value("store").(*store.Store)
 
+	artifactBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.Errorf("cannot read artifact: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
 	var artifact dx.Artifact
-	json.NewDecoder(r.Body).Decode(&artifact)
+	json.Unmarshal(artifactBytes, &artifact)
+
+	signingKeys, _ := ctx.Value("artifactSigningKeys").(map[string][]ed25519.PublicKey)
+	provenance, err := verifyArtifact(artifact, artifactBytes, r.Header.Get(dx.SignatureHeader), signingKeys)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+
+	idempotencyKey := model.DefaultIdempotencyKey(artifact)
+	if r.Header.Get(idempotencyKeyHeader) != "" {
+		idempotencyKey = model.ClientIdempotencyKey(artifact, r.Header.Get(idempotencyKeyHeader))
+	}
+
+	existingEvent, err := store.ArtifactByIdempotencyKey(idempotencyKey)
+	if err == nil {
+		saveExistingArtifact(w, store, existingEvent, artifact, provenance)
+		return
+	} else if err != sql.ErrNoRows {
+		logrus.Errorf("cannot look up artifact by idempotency key: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
 	artifact.ID = fmt.Sprintf("%s-%s", artifact.Version.RepositoryName, uuid.New().String())
 	artifact.Created = time.Now().Unix()
+	artifact.Provenance = provenance
+	artifact.Deployments = nil
 
 	event, err := model.ToEvent(artifact)
 	if err != nil {
@@ -28,15 +68,28 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
+	event.IdempotencyKey = idempotencyKey
 
 	savedEvent, err := store.CreateEvent(event)
 	if err != nil {
+		if store.IsUniqueViolation(err) { // a concurrent push of the same artifact was saved first
+			existingEvent, err := store.ArtifactByIdempotencyKey(idempotencyKey)
+			if err == nil {
+				saveExistingArtifact(w, store, existingEvent, artifact, provenance)
+				return
+			}
+		}
 		logrus.Errorf("cannot save artifact: %s", err)
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
 
 	savedArtifact, err := model.ToArtifact(savedEvent)
+	if err != nil {
+		logrus.Errorf("cannot parse artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
 	artifactStr, err := json.Marshal(savedArtifact)
 	if err != nil {
 		logrus.Errorf("cannot serialize artifact: %s", err)
@@ -48,6 +101,101 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 	w.Write(artifactStr)
 }
 
+// saveExistingArtifact responds with the artifact that was pushed before with the same idempotency key,
+// and upgrades it if the new push is signed
+func saveExistingArtifact(
+	w http.ResponseWriter,
+	store *store.Store,
+	existingEvent *model.Event,
+	artifact dx.Artifact,
+	provenance *dx.Provenance,
+) {
+	existingArtifact, err := model.ToArtifact(existingEvent)
+	if err != nil {
+		logrus.Errorf("cannot parse artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	if !existingArtifact.Provenance.IsVerified() && provenance.IsVerified() {
+		// the signed push replaces the unsigned one, as the signature only vouches for the signed content
+		existingArtifact, err = upgradeArtifact(store, existingEvent, artifact, provenance)
+		if err != nil {
+			logrus.Errorf("cannot update artifact provenance: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+	}
+
+	existingArtifactStr, err := json.Marshal(existingArtifact)
+	if err != nil {
+		logrus.Errorf("cannot serialize artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(existingArtifactStr)
+}
+
+// upgradeArtifact replaces a stored unsigned artifact with its signed push, keeping the ID and created time
+func upgradeArtifact(
+	store *store.Store,
+	existingEvent *model.Event,
+	artifact dx.Artifact,
+	provenance *dx.Provenance,
+) (*dx.Artifact, error) {
+	existingArtifact, err := model.ToArtifact(existingEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact.ID = existingArtifact.ID
+	artifact.Created = existingArtifact.Created
+	artifact.Provenance = provenance
+	artifact.Deployments = nil
+
+	event, err := model.ToEvent(artifact)
+	if err != nil {
+		return nil, err
+	}
+	event.ID = existingEvent.ID
+	err = store.UpdateArtifact(event)
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// verifyArtifact checks the artifact signature with the keys configured for the artifact's repository.
+// Unsigned artifacts are accepted, but only deployed to environments that don't require signatures.
+func verifyArtifact(
+	artifact dx.Artifact,
+	artifactBytes []byte,
+	signature string,
+	signingKeys map[string][]ed25519.PublicKey,
+) (*dx.Provenance, error) {
+	if signature == "" {
+		return &dx.Provenance{SignatureStatus: dx.SignatureUnsigned}, nil
+	}
+
+	keys, ok := signingKeys[artifact.Version.RepositoryName]
+	if !ok {
+		return nil, fmt.Errorf("no signing keys are configured for %s", artifact.Version.RepositoryName)
+	}
+
+	keyID, err := dx.VerifyArtifactSignature(keys, artifactBytes, signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact signature: %s", err)
+	}
+
+	return &dx.Provenance{
+		SignatureStatus: dx.SignatureVerified,
+		KeyID:           keyID,
+		Verified:        time.Now().Unix(),
+	}, nil
+}
+
 func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	store := ctx.Value("store").(*store.Store)
@@ -59,6 +207,9 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	var event *dx.GitEvent
 	var sourceBranch string
 	var sha []string
+	var withDeployments bool
+	var text string
+	fields := map[string]string{}
 
 	params := r.URL.Query()
 	if val, ok := params["limit"]; ok {
@@ -107,6 +258,18 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	if val, ok := params["sha"]; ok {
 		sha = val
 	}
+	if val, ok := params["q"]; ok {
+		text = val[0]
+	}
+	for name, val := range params {
+		if strings.HasPrefix(name, "context.") ||
+			strings.HasPrefix(name, "item.") {
+			fields[name] = val[0]
+		}
+	}
+	if val, ok := params["deployments"]; ok {
+		withDeployments = val[0] == "true"
+	}
 	if val, ok := params["event"]; ok {
 		event = dx.PushPtr()
 		err := event.UnmarshalJSON([]byte(`"` + val[0] + `"`))
@@ -121,6 +284,8 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 		event,
 		sourceBranch,
 		sha,
+		fields,
+		text,
 		limit, offset, since, until)
 	if err != nil {
 		logrus.Errorf("cannot get artifacts: %s", err)
@@ -129,6 +294,7 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	artifacts := []*dx.Artifact{}
+	artifactIDs := []string{}
 	for _, a := range events {
 		artifact, err := model.ToArtifact(a)
 		if err != nil {
@@ -137,6 +303,19 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		artifacts = append(artifacts, artifact)
+		artifactIDs = append(artifactIDs, artifact.ID)
+	}
+
+	if withDeployments {
+		deploymentsByArtifact, err := deployments(store, artifactIDs...)
+		if err != nil {
+			logrus.Errorf("cannot get deployments: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		for _, artifact := range artifacts {
+			artifact.Deployments = deploymentsByArtifact[artifact.ID]
+		}
 	}
 
 	artifactsStr, err := json.Marshal(artifacts)
@@ -149,3 +328,75 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(artifactsStr)
 }
+
+func getArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	id := chi.URLParam(r, "*") // artifact IDs contain the owner/repo name
+	event, err := store.Artifact(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("cannot get artifact: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		logrus.Errorf("cannot deserialize artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	deploymentsByArtifact, err := deployments(store, artifact.ID)
+	if err != nil {
+		logrus.Errorf("cannot get deployments: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	artifact.Deployments = deploymentsByArtifact[artifact.ID]
+
+	artifactStr, err := json.Marshal(artifact)
+	if err != nil {
+		logrus.Errorf("cannot serialize artifact: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(artifactStr)
+}
+
+// deployments returns the release history of the artifacts by artifact ID, with the Flux status of each gitops commit
+func deployments(store *store.Store, artifactIDs ...string) (map[string][]*dx.Deployment, error) {
+	deploymentModels, err := store.Deployments(artifactIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	gitopsRefs := []string{}
+	for _, d := range deploymentModels {
+		gitopsRefs = append(gitopsRefs, d.GitopsRef)
+	}
+	gitopsCommits, err := store.GitopsCommits(gitopsRefs...)
+	if err != nil {
+		logrus.Warnf("cannot get gitops commits: %s", err)
+	}
+	gitopsCommitsBySha := map[string]*model.GitopsCommit{}
+	for _, c := range gitopsCommits {
+		gitopsCommitsBySha[c.Sha] = c
+	}
+
+	deployments := map[string][]*dx.Deployment{}
+	for _, id := range artifactIDs {
+		deployments[id] = []*dx.Deployment{}
+	}
+	for _, d := range deploymentModels {
+		deployments[d.ArtifactID] = append(deployments[d.ArtifactID], model.ToDeployment(d, gitopsCommitsBySha[d.GitopsRef]))
+	}
+
+	return deployments, nil
+}
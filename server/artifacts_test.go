@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -56,6 +58,105 @@ func Test_saveArtifact(t *testing.T) {
 }
 
 
+func Test_saveArtifactIdempotent(t *testing.T) {
+	store := store.NewTest()
+
+	artifactStr := `
+{
+  "version": {
+    "repositoryName": "my-app",
+    "sha": "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+    "branch": "master",
+    "event": "push"
+  }
+}
+`
+
+	contextFunc := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}
+
+	code, body, err := testPostEndpoint(saveArtifact, contextFunc, "/path", artifactStr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, code)
+	var saved dx.Artifact
+	err = json.Unmarshal([]byte(body), &saved)
+	assert.Nil(t, err)
+
+	code, body, err = testPostEndpoint(saveArtifact, contextFunc, "/path", artifactStr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code, "should not create a new artifact for the same repo, sha and event")
+	var deduplicated dx.Artifact
+	err = json.Unmarshal([]byte(body), &deduplicated)
+	assert.Nil(t, err)
+	assert.Equal(t, saved.ID, deduplicated.ID)
+
+	artifacts, err := store.Artifacts("", "", nil, "", []string{}, nil, "", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+}
+
+
+func Test_saveArtifactSignature(t *testing.T) {
+	store := store.NewTest()
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	artifactStr := `
+{
+  "version": {
+    "repositoryName": "my-app",
+    "sha": "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+    "branch": "master",
+    "event": "push"
+  }
+}
+`
+
+	contextFunc := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "artifactSigningKeys", map[string][]ed25519.PublicKey{"my-app": {publicKey}})
+		return ctx
+	}
+
+	code, _ := testSignedPost(contextFunc, artifactStr, dx.SignArtifact(otherKey, []byte(artifactStr)))
+	assert.Equal(t, http.StatusBadRequest, code, "should reject artifacts signed with an unknown key")
+
+	code, body := testSignedPost(contextFunc, artifactStr, "")
+	assert.Equal(t, http.StatusCreated, code)
+	var unsigned dx.Artifact
+	json.Unmarshal([]byte(body), &unsigned)
+	assert.False(t, unsigned.Provenance.IsVerified())
+	unsignedEvent, _ := store.Artifact(unsigned.ID)
+	store.UpdateEventStatus(unsignedEvent.ID, model.StatusProcessed, "", "[]")
+
+	code, body = testSignedPost(contextFunc, artifactStr, dx.SignArtifact(privateKey, []byte(artifactStr)))
+	assert.Equal(t, http.StatusOK, code)
+	var signed dx.Artifact
+	json.Unmarshal([]byte(body), &signed)
+	assert.Equal(t, unsigned.ID, signed.ID, "should keep the deduplicated artifact")
+	assert.True(t, signed.Provenance.IsVerified(), "should upgrade the provenance of the deduplicated artifact")
+
+	event, err := store.Artifact(unsigned.ID)
+	assert.Nil(t, err)
+	stored, _ := model.ToArtifact(event)
+	assert.True(t, stored.Provenance.IsVerified(), "should store the upgraded provenance")
+	assert.Equal(t, model.StatusNew, event.Status, "should process the upgraded artifact again")
+}
+
+func testSignedPost(cn contextFunc, body string, signature string) (int, string) {
+	req := httptest.NewRequest("POST", "/path", strings.NewReader(body))
+	if signature != "" {
+		req.Header.Set(dx.SignatureHeader, signature)
+	}
+	req = req.WithContext(cn(req.Context()))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(saveArtifact).ServeHTTP(rr, req)
+	return rr.Code, rr.Body.String()
+}
+
 func Test_getArtifacts(t *testing.T) {
 	store := store.NewTest()
 	setupArtifacts(store)
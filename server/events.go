@@ -0,0 +1,141 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/server/streaming"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+const eventStreamKeepAlive = 15 * time.Second
+
+// streamEvents streams event and gitops commit state transitions as Server-Sent Events.
+// With the `id` parameter it follows a single event and sends its full release status on every change,
+// with the `env` parameter it forwards the updates that touch the given environment.
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), "streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	eventStream, _ := ctx.Value("eventStream").(*streaming.Broker)
+	if eventStream == nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), "event stream is not enabled"), http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	id := params.Get("id")
+	env := params.Get("env")
+
+	// subscribing before reading the event, so no transition is missed between the snapshot and the stream
+	updates := eventStream.Subscribe()
+	defer eventStream.Unsubscribe(updates)
+
+	var event *model.Event
+	if id != "" {
+		var err error
+		event, err = store.Event(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		} else if err != nil {
+			logrus.Errorf("cannot get event: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", time.Second.Milliseconds())
+
+	if event != nil {
+		writeEventUpdate(w, &dx.EventUpdate{
+			EventID:       event.ID,
+			ReleaseStatus: releaseStatus(store, event),
+		})
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			if event != nil {
+				if !concerns(event, update) {
+					continue
+				}
+
+				refreshed, err := store.Event(event.ID)
+				if err != nil {
+					logrus.Errorf("cannot get event: %s", err)
+					continue
+				}
+				event = refreshed
+				update = &dx.EventUpdate{
+					EventID:       event.ID,
+					Envs:          update.Envs,
+					ReleaseStatus: releaseStatus(store, event),
+				}
+			} else if env != "" && !contains(update.Envs, env) {
+				continue
+			}
+
+			writeEventUpdate(w, update)
+			flusher.Flush()
+		}
+	}
+}
+
+// concerns tells if the update is about the event itself, or one of the gitops commits it produced
+func concerns(event *model.Event, update *dx.EventUpdate) bool {
+	if update.EventID == event.ID {
+		return true
+	}
+
+	return update.GitopsCommit != nil && contains(event.GitopsHashes, update.GitopsCommit.Hash)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEventUpdate(w http.ResponseWriter, update *dx.EventUpdate) {
+	updateBytes, err := json.Marshal(update)
+	if err != nil {
+		logrus.Errorf("cannot serialize event update: %s", err)
+		return
+	}
+
+	fmt.Fprintf(w, "data: %s\n\n", updateBytes)
+}
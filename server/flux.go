@@ -9,8 +9,10 @@ import (
 	"strings"
 
 	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/server/streaming"
 	"github.com/gimlet-io/gimletd/store"
 	log "github.com/sirupsen/logrus"
 )
@@ -43,6 +45,7 @@ func fluxEvent(w http.ResponseWriter, r *http.Request) {
 		log.Errorf("could not translate to gitops commit: %s", err)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(""))
+		return
 	}
 
 	ctx := r.Context()
@@ -56,6 +59,16 @@ func fluxEvent(w http.ResponseWriter, r *http.Request) {
 		log.Errorf("could not save or update gitops commit: %s", err)
 	}
 
+	eventStream, _ := ctx.Value("eventStream").(*streaming.Broker)
+	eventStream.Publish(&dx.EventUpdate{
+		Envs: []string{env},
+		GitopsCommit: &dx.GitopsStatus{
+			Hash:       gitopsCommit.Sha,
+			Status:     gitopsCommit.Status,
+			StatusDesc: gitopsCommit.StatusDesc,
+		},
+	})
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(""))
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// getFailedNotifications lists the notifications that could not be delivered after all retries
+func getFailedNotifications(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	var offset int
+
+	params := r.URL.Query()
+	if val, ok := params["limit"]; ok {
+		l, err := strconv.Atoi(val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+	if val, ok := params["offset"]; ok {
+		o, err := strconv.Atoi(val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		offset = o
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	notifications, err := store.Notifications(model.NotificationFailed, limit, offset)
+	if err != nil {
+		logrus.Errorf("cannot get notifications: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	notificationsString, err := json.Marshal(notifications)
+	if err != nil {
+		logrus.Errorf("cannot serialize notifications: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(notificationsString)
+}
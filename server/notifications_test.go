@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getFailedNotifications(t *testing.T) {
+	store := store.NewTest()
+
+	failed := &model.Notification{Provider: "slack", Payload: "{}"}
+	store.CreateNotification(failed)
+	failed.Status = model.NotificationFailed
+	failed.LastError = "channel_not_found"
+	store.UpdateNotification(failed)
+	store.CreateNotification(&model.Notification{Provider: "slack", Payload: "{}"})
+
+	code, body, err := testEndpoint(getFailedNotifications, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}, "/path")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	var response []*model.Notification
+	err = json.Unmarshal([]byte(body), &response)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(response))
+	assert.Equal(t, "channel_not_found", response[0].LastError)
+}
@@ -185,6 +185,7 @@ func release(w http.ResponseWriter, r *http.Request) {
 		Type:         model.TypeRelease,
 		Blob:         string(releaseRequestStr),
 		Repository:   artifact.Repository,
+		ArtifactID:   artifact.ArtifactID,
 		GitopsHashes: []string{},
 	})
 	if err != nil {
@@ -200,6 +201,83 @@ func release(w http.ResponseWriter, r *http.Request) {
 	w.Write(eventIDBytes)
 }
 
+func batchRelease(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var batchReleaseRequest dx.BatchReleaseRequest
+	err := json.NewDecoder(bytes.NewReader(body)).Decode(&batchReleaseRequest)
+	if err != nil {
+		logrus.Errorf("cannot decode batch release request: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+
+	if len(batchReleaseRequest.Releases) == 0 {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "releases parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	var releases []dx.ReleaseRequest
+	envApps := map[string]bool{}
+	for _, releaseRequest := range batchReleaseRequest.Releases {
+		if releaseRequest.Env == "" {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "env parameter is mandatory"), http.StatusBadRequest)
+			return
+		}
+		envApp := releaseRequest.Env + "/" + releaseRequest.App
+		if envApps[envApp] {
+			http.Error(w, fmt.Sprintf("%s: %s is released more than once", http.StatusText(http.StatusBadRequest), envApp), http.StatusBadRequest)
+			return
+		}
+		envApps[envApp] = true
+		if releaseRequest.ArtifactID == "" {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "artifact parameter is mandatory"), http.StatusBadRequest)
+			return
+		}
+		_, err := store.Artifact(releaseRequest.ArtifactID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s - cannot find artifact with id %s", http.StatusText(http.StatusNotFound), releaseRequest.ArtifactID), http.StatusNotFound)
+			return
+		}
+
+		releases = append(releases, dx.ReleaseRequest{
+			Env:         releaseRequest.Env,
+			App:         releaseRequest.App,
+			ArtifactID:  releaseRequest.ArtifactID,
+			TriggeredBy: user.Login,
+		})
+	}
+
+	batchReleaseRequestStr, err := json.Marshal(dx.BatchReleaseRequest{
+		Releases:    releases,
+		TriggeredBy: user.Login,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot serialize batch release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:         model.TypeBatchRelease,
+		Blob:         string(batchReleaseRequestStr),
+		GitopsHashes: []string{},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot save batch release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	eventIDBytes, _ := json.Marshal(map[string]string{
+		"id": event.ID,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(eventIDBytes)
+}
+
 func rollback(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	store := ctx.Value("store").(*store.Store)
@@ -284,6 +362,9 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = nativeGit.DelDir(repo, filepath.Join(env, app))
+	if err == nil {
+		err = nativeGit.DelFile(repo, dx.FluxKustomizationPath(env, app))
+	}
 	if err != nil {
 		logrus.Errorf("cannot delete release: %s", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -338,6 +419,13 @@ func getEvent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 
+	statusBytes, _ := json.Marshal(releaseStatus(store, event))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(statusBytes)
+}
+
+func releaseStatus(store *store.Store, event *model.Event) *dx.ReleaseStatus {
 	gitopsStatus := []dx.GitopsStatus{}
 	for _, gitopsHash := range event.GitopsHashes {
 		gitopsCommit, err := store.GitopsCommit(gitopsHash)
@@ -360,12 +448,9 @@ func getEvent(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	statusBytes, _ := json.Marshal(dx.ReleaseStatus{
+	return &dx.ReleaseStatus{
 		Status:       event.Status,
 		StatusDesc:   event.StatusDesc,
 		GitopsHashes: gitopsStatus,
-	})
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(statusBytes)
+	}
 }
@@ -1,16 +1,20 @@
 package server
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/gimlet-io/gimletd/notifications"
 	"github.com/gimlet-io/gimletd/server/session"
+	"github.com/gimlet-io/gimletd/server/streaming"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"time"
 )
@@ -21,6 +25,7 @@ func SetupRouter(
 	notificationsManager notifications.Manager,
 	repoCache *nativeGit.GitopsRepoCache,
 	perf *prometheus.HistogramVec,
+	eventStream *streaming.Broker,
 ) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -36,11 +41,13 @@ func SetupRouter(
 	r.Use(middleware.WithValue("gitopsRepoDeployKeyPath", config.GitopsRepoDeployKeyPath))
 	r.Use(middleware.WithValue("gitopsRepoCache", repoCache))
 	r.Use(middleware.WithValue("perf", perf))
+	r.Use(middleware.WithValue("eventStream", eventStream))
+	r.Use(middleware.WithValue("artifactSigningKeys", parseSigningKeys(config.Signing.Keys)))
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:8888", config.Host},
 		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", idempotencyKeyHeader, dx.SignatureHeader},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -50,13 +57,16 @@ func SetupRouter(
 		r.Use(session.SetUser())
 		r.Use(session.MustUser())
 		r.Post("/api/artifact", saveArtifact)
+		r.Get("/api/artifact/*", getArtifact)
 		r.Get("/api/artifacts", getArtifacts)
 		r.Get("/api/releases", getReleases)
 		r.Get("/api/status", getStatus)
 		r.Post("/api/releases", release)
+		r.Post("/api/releases/batch", batchRelease)
 		r.Post("/api/rollback", rollback)
 		r.Post("/api/delete", delete)
 		r.Get("/api/event", getEvent)
+		r.Get("/api/events/stream", streamEvents)
 		r.Post("/api/flux-events", fluxEvent)
 
 		r.Get("/api/gitopsRepo", func(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +84,7 @@ func SetupRouter(
 		r.Post("/api/user", saveUser)
 		r.Delete("/api/user/{login}", deleteUser)
 		r.Get("/api/users", getUsers)
+		r.Get("/api/notifications/failed", getFailedNotifications)
 	})
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -83,6 +94,21 @@ func SetupRouter(
 	return r
 }
 
+func parseSigningKeys(keyMapping config.KeyMapping) map[string][]ed25519.PublicKey {
+	signingKeys := map[string][]ed25519.PublicKey{}
+	for repo, keys := range keyMapping {
+		for _, key := range keys {
+			publicKey, err := dx.ParsePublicKey(key)
+			if err != nil {
+				logrus.Errorf("cannot parse artifact signing key of %s: %s", repo, err)
+				continue
+			}
+			signingKeys[repo] = append(signingKeys[repo], publicKey)
+		}
+	}
+	return signingKeys
+}
+
 type GitopsRepoResult struct {
 	GitopsRepo string `json:"gitopsRepo"`
 }
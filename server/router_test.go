@@ -22,6 +22,7 @@ func Test_MustUser(t *testing.T) {
 		nil,
 		nil,
 		nil,
+		nil,
 	)
 	server := httptest.NewServer(router)
 	defer server.Close()
@@ -0,0 +1,58 @@
+package streaming
+
+import (
+	"sync"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/sirupsen/logrus"
+)
+
+const subscriberBufferSize = 16
+
+// Broker fans out event and gitops commit state transitions to event stream subscribers
+type Broker struct {
+	lock        sync.Mutex
+	subscribers map[chan *dx.EventUpdate]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[chan *dx.EventUpdate]struct{}{},
+	}
+}
+
+func (b *Broker) Subscribe() chan *dx.EventUpdate {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	subscriber := make(chan *dx.EventUpdate, subscriberBufferSize)
+	b.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (b *Broker) Unsubscribe(subscriber chan *dx.EventUpdate) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.subscribers, subscriber)
+	close(subscriber)
+}
+
+// Publish sends the update to all subscribers without blocking the publisher.
+// Slow subscribers miss updates, but get the latest state on their next update or reconnect.
+func (b *Broker) Publish(update *dx.EventUpdate) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- update:
+		default:
+			logrus.Warnf("event stream subscriber is not keeping up, dropping update")
+		}
+	}
+}
@@ -19,6 +19,15 @@ const createTableEvents = "create-table-events"
 const addGitopsStatusColumnToEventsTable = "add-gitops_status-to-events-table"
 const createTableGitopsCommits = "create-table-gitopsCommits"
 const createTableKeyValues = "create-table-key-values"
+const addIdempotencyKeyColumnToEventsTable = "add-idempotency_key-to-events-table"
+const createIdempotencyKeyIndex = "create-idempotency-key-index"
+const createTableDeployments = "create-table-deployments"
+const createDeploymentsArtifactIDIndex = "create-deployments-artifact-id-index"
+const createTableArtifactFields = "create-table-artifact-fields"
+const createArtifactFieldsNameValueIndex = "create-artifact-fields-name-value-index"
+const createTableNotifications = "create-table-notifications"
+const createNotificationsStatusIndex = "create-notifications-status-index"
+const addExpiresColumnToKeyValuesTable = "add-expires-to-key-values-table"
 
 type migration struct {
 	name string
@@ -88,6 +97,77 @@ CREATE TABLE IF NOT EXISTS key_values (
 	);
 `,
 		},
+		{
+			name: addIdempotencyKeyColumnToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN idempotency_key TEXT DEFAULT '';`,
+		},
+		{
+			name: createIdempotencyKeyIndex,
+			stmt: `CREATE UNIQUE INDEX IF NOT EXISTS idx_events_idempotency_key ON events(idempotency_key) WHERE idempotency_key <> '';`,
+		},
+		{
+			name: createTableDeployments,
+			stmt: `
+CREATE TABLE IF NOT EXISTS deployments (
+id           INTEGER PRIMARY KEY AUTOINCREMENT,
+artifact_id  TEXT,
+event_id     TEXT,
+env          TEXT,
+app          TEXT,
+gitops_ref   TEXT,
+triggered_by TEXT,
+created      INTEGER,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createDeploymentsArtifactIDIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_deployments_artifact_id ON deployments(artifact_id);`,
+		},
+		{
+			name: createTableArtifactFields,
+			stmt: `
+CREATE TABLE IF NOT EXISTS artifact_fields (
+id       INTEGER PRIMARY KEY AUTOINCREMENT,
+event_id TEXT,
+name     TEXT,
+value    TEXT,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createArtifactFieldsNameValueIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_artifact_fields_name_value ON artifact_fields(name, value);`,
+		},
+		{
+			name: createTableNotifications,
+			stmt: `
+CREATE TABLE IF NOT EXISTS notifications (
+id           INTEGER PRIMARY KEY AUTOINCREMENT,
+provider     TEXT,
+type         TEXT,
+env          TEXT,
+payload      TEXT,
+status       TEXT,
+attempts     INTEGER DEFAULT 0,
+next_attempt INTEGER,
+last_error   TEXT DEFAULT '',
+created      INTEGER,
+delivered    INTEGER DEFAULT 0,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createNotificationsStatusIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_notifications_status ON notifications(provider, status, next_attempt);`,
+		},
+		{
+			name: addExpiresColumnToKeyValuesTable,
+			stmt: `ALTER TABLE key_values ADD COLUMN expires INTEGER DEFAULT 0;`,
+		},
 	},
 	"postgres": {
 		{
@@ -151,6 +231,77 @@ CREATE TABLE IF NOT EXISTS key_values (
 	);
 `,
 		},
+		{
+			name: addIdempotencyKeyColumnToEventsTable,
+			stmt: `ALTER TABLE events ADD COLUMN idempotency_key TEXT DEFAULT '';`,
+		},
+		{
+			name: createIdempotencyKeyIndex,
+			stmt: `CREATE UNIQUE INDEX IF NOT EXISTS idx_events_idempotency_key ON events(idempotency_key) WHERE idempotency_key <> '';`,
+		},
+		{
+			name: createTableDeployments,
+			stmt: `
+CREATE TABLE IF NOT EXISTS deployments (
+id           SERIAL,
+artifact_id  TEXT,
+event_id     TEXT,
+env          TEXT,
+app          TEXT,
+gitops_ref   TEXT,
+triggered_by TEXT,
+created      INTEGER,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createDeploymentsArtifactIDIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_deployments_artifact_id ON deployments(artifact_id);`,
+		},
+		{
+			name: createTableArtifactFields,
+			stmt: `
+CREATE TABLE IF NOT EXISTS artifact_fields (
+id       SERIAL,
+event_id TEXT,
+name     TEXT,
+value    TEXT,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createArtifactFieldsNameValueIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_artifact_fields_name_value ON artifact_fields(name, value);`,
+		},
+		{
+			name: createTableNotifications,
+			stmt: `
+CREATE TABLE IF NOT EXISTS notifications (
+id           SERIAL,
+provider     TEXT,
+type         TEXT,
+env          TEXT,
+payload      TEXT,
+status       TEXT,
+attempts     INTEGER DEFAULT 0,
+next_attempt INTEGER,
+last_error   TEXT DEFAULT '',
+created      INTEGER,
+delivered    INTEGER DEFAULT 0,
+UNIQUE(id)
+);
+`,
+		},
+		{
+			name: createNotificationsStatusIndex,
+			stmt: `CREATE INDEX IF NOT EXISTS idx_notifications_status ON notifications(provider, status, next_attempt);`,
+		},
+		{
+			name: addExpiresColumnToKeyValuesTable,
+			stmt: `ALTER TABLE key_values ADD COLUMN expires INTEGER DEFAULT 0;`,
+		},
 	},
 	"mysql": {},
 }
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/russross/meddler"
+)
+
+// CreateDeployment stores a new deployment in the database
+func (db *Store) CreateDeployment(deployment *model.Deployment) error {
+	deployment.Created = time.Now().Unix()
+	return meddler.Insert(db, "deployments", deployment)
+}
+
+// Deployments returns the deployments of the artifacts, latest first
+func (db *Store) Deployments(artifactIDs ...string) ([]*model.Deployment, error) {
+	var data []*model.Deployment
+	if len(artifactIDs) == 0 {
+		return data, nil
+	}
+
+	query := fmt.Sprintf(`
+SELECT id, artifact_id, event_id, env, app, gitops_ref, triggered_by, created
+FROM deployments
+WHERE artifact_id IN (%s)
+ORDER BY created DESC;
+`, inPlaceholders(len(artifactIDs)))
+	err := meddler.QueryAll(db, &data, query, stringArgs(artifactIDs)...)
+	return data, err
+}
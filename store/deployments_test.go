@@ -0,0 +1,45 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentCRUD(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	err := s.CreateDeployment(&model.Deployment{
+		ArtifactID: "my-app-1",
+		EventID:    "event-1",
+		Env:        "staging",
+		App:        "my-app",
+		GitopsRef:  "sha1",
+	})
+	assert.Nil(t, err)
+	err = s.CreateDeployment(&model.Deployment{
+		ArtifactID: "my-app-2",
+		EventID:    "event-2",
+		Env:        "staging",
+		App:        "my-app",
+		GitopsRef:  "sha2",
+	})
+	assert.Nil(t, err)
+
+	deployments, err := s.Deployments("my-app-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deployments))
+	assert.Equal(t, "sha1", deployments[0].GitopsRef)
+
+	deployments, err = s.Deployments("my-app-1", "my-app-2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(deployments))
+
+	deployments, err = s.Deployments()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deployments))
+}
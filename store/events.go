@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,10 +15,7 @@ import (
 
 // CreateEvent stores a new event in the database
 func (db *Store) CreateEvent(event *model.Event) (*model.Event, error) {
-	event.ID = uuid.New().String()
-	event.Created = time.Now().Unix()
-	event.Status = model.StatusNew
-	return event, meddler.Insert(db, "events", event)
+	return db.createEvent(event, time.Now().Unix())
 }
 
 // createEvent stores a new event in the database, but it is able to fake the created date.
@@ -26,7 +24,75 @@ func (db *Store) createEvent(event *model.Event, created int64) (*model.Event, e
 	event.ID = uuid.New().String()
 	event.Created = created
 	event.Status = model.StatusNew
-	return event, meddler.Insert(db, "events", event)
+
+	err := db.inTx(func(tx meddler.DB) error {
+		err := meddler.Insert(tx, "events", event)
+		if err != nil {
+			return err
+		}
+
+		if event.Type == model.TypeArtifact {
+			return indexArtifactFields(tx, event)
+		}
+		return nil
+	})
+	return event, err
+}
+
+// indexArtifactFields stores the searchable fields of an artifact
+func indexArtifactFields(tx meddler.DB, event *model.Event) error {
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range model.ArtifactFields(artifact) {
+		field.EventID = event.ID
+		err := meddler.Insert(tx, "artifact_fields", field)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateArtifact replaces the stored artifact of the event, and its searchable fields.
+// The event is set back to new, so the worker processes the replaced artifact
+func (db *Store) UpdateArtifact(event *model.Event) error {
+	return db.inTx(func(tx meddler.DB) error {
+		stmt := sql.Stmt(db.driver, sql.UpdateArtifact)
+		_, err := tx.Exec(stmt, event.Blob, event.Branch, event.Event, event.SourceBranch, event.TargetBranch, event.Tag, event.ID)
+		if err != nil {
+			return err
+		}
+
+		stmt = sql.Stmt(db.driver, sql.DeleteArtifactFields)
+		_, err = tx.Exec(stmt, event.ID)
+		if err != nil {
+			return err
+		}
+		return indexArtifactFields(tx, event)
+	})
+}
+
+// IndexArtifacts makes artifacts that were pushed before artifact search was introduced searchable
+func (db *Store) IndexArtifacts() error {
+	stmt := sql.Stmt(db.driver, sql.SelectUnindexedArtifacts)
+	var events []*model.Event
+	err := meddler.QueryAll(db, &events, stmt)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		err = db.inTx(func(tx meddler.DB) error {
+			return indexArtifactFields(tx, event)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Artifacts returns all events in the database within the given constraints
@@ -35,6 +101,8 @@ func (db *Store) Artifacts(
 	gitEvent *dx.GitEvent,
 	sourceBranch string,
 	sha []string,
+	fields map[string]string,
+	text string,
 	limit, offset int,
 	since, until *time.Time) ([]*model.Event, error) {
 
@@ -82,6 +150,32 @@ func (db *Store) Artifacts(
 		}
 	}
 
+	fieldNames := []string{}
+	for name := range fields {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+	for _, name := range fieldNames {
+		filters = addFilter(filters, fmt.Sprintf(
+			"id IN (SELECT event_id FROM artifact_fields WHERE name = $%d AND value = $%d)",
+			len(args)+1, len(args)+2,
+		))
+		args = append(args, name, fields[name])
+	}
+
+	if text != "" {
+		placeholders := []string{}
+		for _, name := range model.TextSearchFields {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)+1))
+			args = append(args, name)
+		}
+		filters = addFilter(filters, fmt.Sprintf(
+			"id IN (SELECT event_id FROM artifact_fields WHERE name IN (%s) AND LOWER(value) LIKE $%d)",
+			strings.Join(placeholders, ", "), len(args)+1,
+		))
+		args = append(args, "%"+strings.ToLower(text)+"%")
+	}
+
 	if gitEvent != nil {
 		var intRep int
 		intRep = int(*gitEvent)
@@ -110,11 +204,19 @@ func (db *Store) Artifact(id string) (*model.Event, error) {
 	query := fmt.Sprintf(`
 SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id
 FROM events
-WHERE artifact_id = $1;
+WHERE type = $1 AND artifact_id = $2;
 `)
 
 	var data model.Event
-	err := meddler.QueryRow(db, &data, query, id)
+	err := meddler.QueryRow(db, &data, query, model.TypeArtifact, id)
+	return &data, err
+}
+
+// ArtifactByIdempotencyKey returns an artifact by its idempotency key
+func (db *Store) ArtifactByIdempotencyKey(key string) (*model.Event, error) {
+	stmt := sql.Stmt(db.driver, sql.SelectArtifactByIdempotencyKey)
+	var data model.Event
+	err := meddler.QueryRow(db, &data, stmt, model.TypeArtifact, key)
 	return &data, err
 }
 
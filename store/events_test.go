@@ -51,7 +51,7 @@ func TestEventCRUD(t *testing.T) {
 	assert.NotEqual(t, savedEvent.Created, 0)
 	assert.Equal(t, savedEvent.Event, dx.PR)
 
-	artifacts, err := s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	artifacts, err := s.Artifacts("", "", nil, "", []string{}, nil, "", 0, 0, nil, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(artifacts))
 	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", artifacts[0].SHA)
@@ -66,23 +66,23 @@ func TestAdvancedArtifactQueries(t *testing.T) {
 	err := setupData(s)
 	assert.Nil(t, err)
 
-	artifacts, err := s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	artifacts, err := s.Artifacts("", "", nil, "", []string{}, nil, "", 0, 0, nil, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(artifacts))
 	assert.Equal(t, "sha1", artifacts[0].SHA)
 
 	threeHoursAgo := time.Now().Add(-3 * time.Hour)
-	artifacts, err = s.Artifacts("", "", nil, "", []string{}, 0, 0, &threeHoursAgo, nil)
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, nil, "", 0, 0, &threeHoursAgo, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(artifacts))
 	assert.Equal(t, "sha1", artifacts[0].SHA)
 
 	twoHoursAgo := time.Now().Add(-2 * time.Hour)
-	artifacts, err = s.Artifacts("", "", nil, "", []string{}, 0, 0, &threeHoursAgo, &twoHoursAgo)
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, nil, "", 0, 0, &threeHoursAgo, &twoHoursAgo)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(artifacts))
 
-	artifacts, err = s.Artifacts("", "", nil, "", []string{"sha1", "sha2"}, 0, 0, nil, nil)
+	artifacts, err = s.Artifacts("", "", nil, "", []string{"sha1", "sha2"}, nil, "", 0, 0, nil, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(artifacts))
 }
@@ -108,3 +108,117 @@ func setupData(s *Store) error {
 	_, err = s.createEvent(aModel, tenHoursAgo.Unix())
 	return err
 }
+
+func TestArtifactSearch(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	aModel, _ := model.ToEvent(dx.Artifact{
+		Version: dx.Version{
+			SHA:        "sha1",
+			Message:    "Bugfix 123",
+			AuthorName: "Jane Doe",
+		},
+		Context: map[string]string{
+			"JOB_NAME": "my-app-build",
+		},
+		Items: []map[string]interface{}{
+			{
+				"name": "image",
+				"tag":  "abc",
+			},
+		},
+	})
+	_, err := s.CreateEvent(aModel)
+	assert.Nil(t, err)
+
+	aModel, _ = model.ToEvent(dx.Artifact{
+		Version: dx.Version{
+			SHA:        "sha2",
+			Message:    "Feature 456",
+			AuthorName: "John Doe",
+		},
+		Items: []map[string]interface{}{
+			{
+				"image": map[string]interface{}{
+					"tag": "def",
+				},
+			},
+		},
+	})
+	_, err = s.CreateEvent(aModel)
+	assert.Nil(t, err)
+
+	artifacts, err := s.Artifacts("", "", nil, "", []string{}, map[string]string{"item.image.tag": "abc"}, "", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+	assert.Equal(t, "sha1", artifacts[0].SHA)
+
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, map[string]string{"item.image.tag": "def"}, "", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+	assert.Equal(t, "sha2", artifacts[0].SHA)
+
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, map[string]string{
+		"context.JOB_NAME": "my-app-build",
+		"item.image.tag":   "def",
+	}, "", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(artifacts))
+
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, nil, "feature", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+	assert.Equal(t, "sha2", artifacts[0].SHA)
+
+	artifacts, err = s.Artifacts("", "", nil, "", []string{}, nil, "doe", 0, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(artifacts))
+
+	aModel, _ = model.ToEvent(dx.Artifact{
+		Version: dx.Version{SHA: "sha3"},
+		Items: []map[string]interface{}{
+			{"tag": "ghi"},
+			{"tag": "jkl"},
+		},
+	})
+	_, err = s.CreateEvent(aModel)
+	assert.Nil(t, err)
+
+	for _, tag := range []string{"ghi", "jkl"} {
+		artifacts, err = s.Artifacts("", "", nil, "", []string{}, map[string]string{"item.tag": tag}, "", 0, 0, nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(artifacts), "should index the fields of all unnamed items")
+		assert.Equal(t, "sha3", artifacts[0].SHA)
+	}
+}
+
+func TestUniqueIdempotencyKey(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	first, _ := model.ToEvent(dx.Artifact{ID: "first"})
+	first.IdempotencyKey = "my-app-ea9ab7cc-push"
+	_, err := s.CreateEvent(first)
+	assert.Nil(t, err)
+
+	second, _ := model.ToEvent(dx.Artifact{ID: "second"})
+	second.IdempotencyKey = "my-app-ea9ab7cc-push"
+	_, err = s.CreateEvent(second)
+	assert.NotNil(t, err)
+	assert.True(t, s.IsUniqueViolation(err))
+
+	existing, err := s.ArtifactByIdempotencyKey("my-app-ea9ab7cc-push")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", existing.ArtifactID)
+
+	for _, id := range []string{"third", "fourth"} {
+		event, _ := model.ToEvent(dx.Artifact{ID: id})
+		_, err = s.CreateEvent(event)
+		assert.Nil(t, err, "events without an idempotency key are not unique")
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/gimlet-io/gimletd/model"
 	queries "github.com/gimlet-io/gimletd/store/sql"
 	"github.com/russross/meddler"
@@ -21,6 +22,22 @@ func (db *Store) GitopsCommit(sha string) (*model.GitopsCommit, error) {
 	return gitopsCommit, err
 }
 
+// GitopsCommits returns the stored gitops commits of the given shas
+func (db *Store) GitopsCommits(shas ...string) ([]*model.GitopsCommit, error) {
+	var data []*model.GitopsCommit
+	if len(shas) == 0 {
+		return data, nil
+	}
+
+	query := fmt.Sprintf(`
+SELECT id, sha, status, status_desc
+FROM gitops_commits
+WHERE sha IN (%s);
+`, inPlaceholders(len(shas)))
+	err := meddler.QueryAll(db, &data, query, stringArgs(shas)...)
+	return data, err
+}
+
 func (db *Store) SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) error {
 	stmt := queries.Stmt(db.driver, queries.SelectGitopsCommitBySha)
 	savedGitopsCommit := new(model.GitopsCommit)
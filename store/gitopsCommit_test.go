@@ -26,4 +26,8 @@ func TestGitopsCommitCRUD(t *testing.T) {
 	savedGitopsCommit, err := s.GitopsCommit("sha")
 	assert.Nil(t, err)
 	assert.Equal(t, "aStatus", savedGitopsCommit.Status)
+
+	savedGitopsCommits, err := s.GitopsCommits("sha", "non-existing-sha")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(savedGitopsCommits))
 }
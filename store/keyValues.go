@@ -22,6 +22,7 @@ func (db *Store) SaveKeyValue(setting *model.KeyValue) error {
 	}
 
 	storedSetting.Value = setting.Value
+	storedSetting.Expires = setting.Expires
 	return meddler.Update(db, "key_values", storedSetting)
 }
 
@@ -33,6 +34,16 @@ func (db *Store) KeyValue(key string) (*model.KeyValue, error) {
 	return data, err
 }
 
+// DeleteExpiredKeyValues removes the key-values that expired before the given time
+func (db *Store) DeleteExpiredKeyValues(now int64) (int64, error) {
+	stmt := sql.Stmt(db.driver, sql.DeleteExpiredKeyValues)
+	result, err := db.Exec(stmt, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (db *Store) ReposWithCleanupPolicy() ([]string, error) {
 	reposWithCleanupPolicyKeyValue, err := db.KeyValue(model.ReposWithCleanupPolicy)
 	if err != nil {
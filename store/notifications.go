@@ -0,0 +1,56 @@
+package store
+
+import (
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store/sql"
+	"github.com/russross/meddler"
+)
+
+// CreateNotification puts a notification in the outbox, ready for delivery
+func (db *Store) CreateNotification(notification *model.Notification) error {
+	notification.Created = time.Now().Unix()
+	notification.Status = model.NotificationPending
+	notification.NextAttempt = notification.Created
+	return meddler.Insert(db, "notifications", notification)
+}
+
+// DueNotifications returns the pending notifications of a provider that are due for a delivery attempt, oldest first
+func (db *Store) DueNotifications(provider string, now int64, limit int) ([]*model.Notification, error) {
+	stmt := sql.Stmt(db.driver, sql.SelectDueNotifications)
+	var data []*model.Notification
+	err := meddler.QueryAll(db, &data, stmt, provider, now, limit)
+	return data, err
+}
+
+// UpdateNotification stores the outcome of a delivery attempt
+func (db *Store) UpdateNotification(notification *model.Notification) error {
+	return meddler.Update(db, "notifications", notification)
+}
+
+// Notifications returns the notifications in the given status, latest first
+func (db *Store) Notifications(status string, limit, offset int) ([]*model.Notification, error) {
+	stmt := sql.Stmt(db.driver, sql.SelectNotificationsByStatus)
+	var data []*model.Notification
+	err := meddler.QueryAll(db, &data, stmt, status, limit, offset)
+	return data, err
+}
+
+// CountNotifications returns the number of notifications in the given status
+func (db *Store) CountNotifications(status string) (int, error) {
+	stmt := sql.Stmt(db.driver, sql.CountNotificationsByStatus)
+	var count int
+	err := db.QueryRow(stmt, status).Scan(&count)
+	return count, err
+}
+
+// DeleteNotifications removes the delivered and failed notifications that were created before the given time
+func (db *Store) DeleteNotifications(createdBefore int64) (int64, error) {
+	stmt := sql.Stmt(db.driver, sql.DeleteNotificationsCreatedBefore)
+	result, err := db.Exec(stmt, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
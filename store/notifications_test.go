@@ -0,0 +1,64 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationOutbox(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	notification := &model.Notification{
+		Provider: "slack",
+		Type:     "deploy",
+		Env:      "staging",
+		Payload:  "{}",
+	}
+	err := s.CreateNotification(notification)
+	assert.Nil(t, err)
+	err = s.CreateNotification(&model.Notification{
+		Provider: "github",
+		Payload:  "{}",
+	})
+	assert.Nil(t, err)
+
+	due, err := s.DueNotifications("slack", time.Now().Unix(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due))
+	assert.Equal(t, model.NotificationPending, due[0].Status)
+
+	due[0].Attempts = 1
+	due[0].NextAttempt = time.Now().Add(time.Minute).Unix()
+	err = s.UpdateNotification(due[0])
+	assert.Nil(t, err)
+	due, err = s.DueNotifications("slack", time.Now().Unix(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(due), "should wait for the backoff")
+
+	notification.Status = model.NotificationFailed
+	notification.LastError = "channel_not_found"
+	err = s.UpdateNotification(notification)
+	assert.Nil(t, err)
+
+	failed, err := s.Notifications(model.NotificationFailed, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(failed))
+	assert.Equal(t, "channel_not_found", failed[0].LastError)
+
+	count, err := s.CountNotifications(model.NotificationPending)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	deleted, err := s.DeleteNotifications(time.Now().Add(time.Minute).Unix())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted, "should keep pending notifications")
+	failed, err = s.Notifications(model.NotificationFailed, 10, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(failed))
+}
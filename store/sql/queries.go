@@ -22,6 +22,15 @@ const SelectUnprocessedEvents = "select-unprocessed-events"
 const UpdateEventStatus = "update-event-status"
 const SelectGitopsCommitBySha = "select-gitops-commit-by-sha"
 const SelectKeyValue = "select-key-value"
+const DeleteExpiredKeyValues = "delete-expired-key-values"
+const SelectArtifactByIdempotencyKey = "select-artifact-by-idempotency-key"
+const SelectUnindexedArtifacts = "select-unindexed-artifacts"
+const SelectDueNotifications = "select-due-notifications"
+const SelectNotificationsByStatus = "select-notifications-by-status"
+const CountNotificationsByStatus = "count-notifications-by-status"
+const DeleteNotificationsCreatedBefore = "delete-notifications-created-before"
+const UpdateArtifact = "update-artifact"
+const DeleteArtifactFields = "delete-artifact-fields"
 
 var queries = map[string]map[string]string{
 	"sqlite3": {
@@ -54,9 +63,55 @@ FROM gitops_commits
 WHERE sha = ?;
 `,
 		SelectKeyValue: `
-SELECT id, key, value
+SELECT id, key, value, expires
 FROM key_values
 WHERE key = ?;
+`,
+		DeleteExpiredKeyValues: `
+DELETE FROM key_values
+WHERE expires > 0 AND expires < ?;
+`,
+		SelectArtifactByIdempotencyKey: `
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, idempotency_key
+FROM events
+WHERE type = ? AND idempotency_key = ?
+ORDER BY created ASC
+LIMIT 1;
+`,
+		SelectUnindexedArtifacts: `
+SELECT id, type, blob
+FROM events
+WHERE type = 'artifact'
+AND id NOT IN (SELECT DISTINCT event_id FROM artifact_fields);
+`,
+		SelectDueNotifications: `
+SELECT id, provider, type, env, payload, status, attempts, next_attempt, last_error, created, delivered
+FROM notifications
+WHERE provider = ? AND status = 'pending' AND next_attempt <= ?
+ORDER BY id ASC
+LIMIT ?;
+`,
+		SelectNotificationsByStatus: `
+SELECT id, provider, type, env, payload, status, attempts, next_attempt, last_error, created, delivered
+FROM notifications
+WHERE status = ?
+ORDER BY id DESC
+LIMIT ? OFFSET ?;
+`,
+		CountNotificationsByStatus: `
+SELECT COUNT(*)
+FROM notifications
+WHERE status = ?;
+`,
+		DeleteNotificationsCreatedBefore: `
+DELETE FROM notifications
+WHERE status IN ('delivered', 'failed') AND created < ?;
+`,
+		UpdateArtifact: `
+UPDATE events SET blob = ?, branch = ?, event = ?, source_branch = ?, target_branch = ?, tag = ?, status = 'new', status_desc = '' WHERE id = ?;
+`,
+		DeleteArtifactFields: `
+DELETE FROM artifact_fields WHERE event_id = ?;
 `,
 	},
 	"postgres": {
@@ -89,9 +144,55 @@ FROM gitops_commits
 WHERE sha = $1;
 `,
 		SelectKeyValue: `
-SELECT id, key, value
+SELECT id, key, value, expires
 FROM key_values
 WHERE key = $1;
+`,
+		DeleteExpiredKeyValues: `
+DELETE FROM key_values
+WHERE expires > 0 AND expires < $1;
+`,
+		SelectArtifactByIdempotencyKey: `
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, idempotency_key
+FROM events
+WHERE type = $1 AND idempotency_key = $2
+ORDER BY created ASC
+LIMIT 1;
+`,
+		SelectUnindexedArtifacts: `
+SELECT id, type, blob
+FROM events
+WHERE type = 'artifact'
+AND id NOT IN (SELECT DISTINCT event_id FROM artifact_fields);
+`,
+		SelectDueNotifications: `
+SELECT id, provider, type, env, payload, status, attempts, next_attempt, last_error, created, delivered
+FROM notifications
+WHERE provider = $1 AND status = 'pending' AND next_attempt <= $2
+ORDER BY id ASC
+LIMIT $3;
+`,
+		SelectNotificationsByStatus: `
+SELECT id, provider, type, env, payload, status, attempts, next_attempt, last_error, created, delivered
+FROM notifications
+WHERE status = $1
+ORDER BY id DESC
+LIMIT $2 OFFSET $3;
+`,
+		CountNotificationsByStatus: `
+SELECT COUNT(*)
+FROM notifications
+WHERE status = $1;
+`,
+		DeleteNotificationsCreatedBefore: `
+DELETE FROM notifications
+WHERE status IN ('delivered', 'failed') AND created < $1;
+`,
+		UpdateArtifact: `
+UPDATE events SET blob = $1, branch = $2, event = $3, source_branch = $4, target_branch = $5, tag = $6, status = 'new', status_desc = '' WHERE id = $7;
+`,
+		DeleteArtifactFields: `
+DELETE FROM artifact_fields WHERE event_id = $1;
 `,
 	},
 	"mysql": {},
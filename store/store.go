@@ -2,10 +2,15 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gimlet-io/gimletd/store/ddl"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 
 	"github.com/russross/meddler"
 
@@ -19,6 +24,9 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// postgres error code of unique constraint violations
+const pqUniqueViolation = "23505"
+
 // Store is used to access data
 // from the sql/database driver with a relational database backend.
 type Store struct {
@@ -70,6 +78,21 @@ func open(driver, config string) *sql.DB {
 	return db
 }
 
+// inTx runs fn in a transaction, that is rolled back if fn fails
+func (db *Store) inTx(fn func(tx meddler.DB) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // NewTest creates a new database connection for testing purposes.
 // The database driver and connection string are provided by
 // environment variables, with fallback to in-memory sqlite.
@@ -135,3 +158,37 @@ func setupMeddler(driver string) {
 		meddler.Default = meddler.PostgreSQL
 	}
 }
+
+// IsUniqueViolation tells if the error is caused by a unique constraint of the database
+func (db *Store) IsUniqueViolation(err error) bool {
+	if driverErr, ok := meddler.DriverErr(err); ok {
+		err = driverErr
+	}
+
+	switch db.driver {
+	case "sqlite3":
+		var sqliteErr sqlite3.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	case "postgres":
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+	}
+	return false
+}
+
+// inPlaceholders returns the $1, $2.. placeholders of an IN list of count values
+func inPlaceholders(count int) string {
+	placeholders := []string{}
+	for i := 1; i <= count; i++ {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i))
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := []interface{}{}
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/server/streaming"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/gimlet-io/gimletd/worker/events"
 	"github.com/go-git/go-git/v5"
@@ -33,6 +36,21 @@ type GitopsWorker struct {
 	notificationsManager    notifications.Manager
 	eventsProcessed         prometheus.Counter
 	repoCache               *nativeGit.GitopsRepoCache
+	eventStream             *streaming.Broker
+	renderConfig            *RenderConfig
+}
+
+// RenderConfig holds how the manifests are rendered and written to the gitops repo
+type RenderConfig struct {
+	// SignatureRequiredEnvs are the env patterns that only accept signed artifacts
+	SignatureRequiredEnvs []string
+	ChartCache            *dx.ChartCache
+	Policy                *dx.Policy
+	SecretEncryption      *dx.SecretEncryption
+	GitopsLayout          *dx.GitopsLayout
+
+	// chartAccessToken clones private charts, it is set from the token manager for each event
+	chartAccessToken string
 }
 
 func NewGitopsWorker(
@@ -43,7 +61,12 @@ func NewGitopsWorker(
 	notificationsManager notifications.Manager,
 	eventsProcessed prometheus.Counter,
 	repoCache *nativeGit.GitopsRepoCache,
+	eventStream *streaming.Broker,
+	renderConfig *RenderConfig,
 ) *GitopsWorker {
+	if renderConfig == nil {
+		renderConfig = &RenderConfig{}
+	}
 	return &GitopsWorker{
 		store:                   store,
 		gitopsRepo:              gitopsRepo,
@@ -52,6 +75,8 @@ func NewGitopsWorker(
 		tokenManager:            tokenManager,
 		eventsProcessed:         eventsProcessed,
 		repoCache:               repoCache,
+		eventStream:             eventStream,
+		renderConfig:            renderConfig,
 	}
 }
 
@@ -66,32 +91,17 @@ func (w *GitopsWorker) Run() {
 
 		for _, event := range events {
 			w.eventsProcessed.Inc()
-			processEvent(w.store,
-				w.gitopsRepo,
-				w.gitopsRepoDeployKeyPath,
-				w.tokenManager,
-				event,
-				w.notificationsManager,
-				w.repoCache,
-			)
+			w.processEvent(event)
 		}
 
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-func processEvent(
-	store *store.Store,
-	gitopsRepo string,
-	gitopsRepoDeployKeyPath string,
-	tokenManager customScm.NonImpersonatedTokenManager,
-	event *model.Event,
-	notificationsManager notifications.Manager,
-	repoCache *nativeGit.GitopsRepoCache,
-) {
-	var token string
-	if tokenManager != nil { // only needed for private helm charts
-		token, _, _ = tokenManager.Token()
+func (w *GitopsWorker) processEvent(event *model.Event) {
+	renderConfig := *w.renderConfig
+	if w.tokenManager != nil { // only needed for private helm charts
+		renderConfig.chartAccessToken, _, _ = w.tokenManager.Token()
 	}
 
 	// process event based on type
@@ -102,49 +112,58 @@ func processEvent(
 	switch event.Type {
 	case model.TypeArtifact:
 		deployEvents, err = processArtifactEvent(
-			gitopsRepo,
-			repoCache,
-			gitopsRepoDeployKeyPath,
-			token,
+			w.gitopsRepo,
+			w.repoCache,
+			w.gitopsRepoDeployKeyPath,
 			event,
-			store,
+			w.store,
+			&renderConfig,
 		)
 	case model.TypeRelease:
 		deployEvents, err = processReleaseEvent(
-			store,
-			gitopsRepo,
-			repoCache,
-			gitopsRepoDeployKeyPath,
-			token,
+			w.store,
+			w.gitopsRepo,
+			w.repoCache,
+			w.gitopsRepoDeployKeyPath,
 			event,
+			&renderConfig,
+		)
+	case model.TypeBatchRelease:
+		deployEvents, err = processBatchReleaseEvent(
+			w.store,
+			w.gitopsRepo,
+			w.repoCache,
+			w.gitopsRepoDeployKeyPath,
+			event,
+			&renderConfig,
 		)
 	case model.TypeRollback:
 		rollbackEvent, err = processRollbackEvent(
-			gitopsRepo,
-			gitopsRepoDeployKeyPath,
-			repoCache,
+			w.gitopsRepo,
+			w.gitopsRepoDeployKeyPath,
+			w.repoCache,
 			event,
 		)
-		notificationsManager.Broadcast(notifications.MessageFromRollbackEvent(rollbackEvent))
+		w.notificationsManager.Broadcast(notifications.MessageFromRollbackEvent(rollbackEvent))
 		for _, sha := range rollbackEvent.GitopsRefs {
 			setGitopsHashOnEvent(event, sha)
 		}
 	case model.TypeBranchDeleted:
 		deleteEvents, err = processBranchDeletedEvent(
-			gitopsRepo,
-			gitopsRepoDeployKeyPath,
-			repoCache,
+			w.gitopsRepo,
+			w.gitopsRepoDeployKeyPath,
+			w.repoCache,
 			event,
 		)
 		for _, deleteEvent := range deleteEvents {
-			notificationsManager.Broadcast(notifications.MessageFromDeleteEvent(deleteEvent))
+			w.notificationsManager.Broadcast(notifications.MessageFromDeleteEvent(deleteEvent))
 			setGitopsHashOnEvent(event, deleteEvent.GitopsRef)
 		}
 	}
 
 	// send out notifications based on gitops events
 	for _, deployEvent := range deployEvents {
-		notificationsManager.Broadcast(notifications.MessageFromGitOpsEvent(deployEvent))
+		w.notificationsManager.Broadcast(notifications.MessageFromGitOpsEvent(deployEvent))
 	}
 
 	// record gitops hashes on events
@@ -152,22 +171,65 @@ func processEvent(
 		setGitopsHashOnEvent(event, deployEvent.GitopsRef)
 	}
 
+	// record deployments for the artifact's release history
+	for _, deployEvent := range deployEvents {
+		recordDeployment(w.store, event, deployEvent)
+	}
+
 	// store event state
 	if err != nil {
 		logrus.Errorf("error in processing event: %s", err.Error())
 		event.Status = model.StatusError
 		event.StatusDesc = err.Error()
-		err := updateEvent(store, event)
+		err := updateEvent(w.store, event)
 		if err != nil {
 			logrus.Warnf("could not update event status %v", err)
 		}
 	} else {
 		event.Status = model.StatusProcessed
-		err := updateEvent(store, event)
+		err := updateEvent(w.store, event)
 		if err != nil {
 			logrus.Warnf("could not update event status %v", err)
 		}
 	}
+
+	w.eventStream.Publish(eventUpdate(event, deployEvents, rollbackEvent, deleteEvents))
+}
+
+func eventUpdate(
+	event *model.Event,
+	deployEvents []*events.DeployEvent,
+	rollbackEvent *events.RollbackEvent,
+	deleteEvents []*events.DeleteEvent,
+) *dx.EventUpdate {
+	envs := []string{}
+	for _, deployEvent := range deployEvents {
+		envs = append(envs, deployEvent.Manifest.Env)
+	}
+	if rollbackEvent != nil {
+		envs = append(envs, rollbackEvent.RollbackRequest.Env)
+	}
+	for _, deleteEvent := range deleteEvents {
+		envs = append(envs, deleteEvent.Env)
+	}
+
+	gitopsStatus := []dx.GitopsStatus{}
+	for _, gitopsHash := range event.GitopsHashes {
+		gitopsStatus = append(gitopsStatus, dx.GitopsStatus{
+			Hash:   gitopsHash,
+			Status: "N/A",
+		})
+	}
+
+	return &dx.EventUpdate{
+		EventID: event.ID,
+		Envs:    envs,
+		ReleaseStatus: &dx.ReleaseStatus{
+			Status:       event.Status,
+			StatusDesc:   event.StatusDesc,
+			GitopsHashes: gitopsStatus,
+		},
+	}
 }
 
 func processBranchDeletedEvent(
@@ -243,13 +305,31 @@ func setGitopsHashOnEvent(event *model.Event, gitopsSha string) {
 	event.GitopsHashes = append(event.GitopsHashes, gitopsSha)
 }
 
+func recordDeployment(store *store.Store, event *model.Event, deployEvent *events.DeployEvent) {
+	if deployEvent.GitopsRef == "" {
+		return
+	}
+
+	err := store.CreateDeployment(&model.Deployment{
+		ArtifactID:  deployEvent.Artifact.ID,
+		EventID:     event.ID,
+		Env:         deployEvent.Manifest.Env,
+		App:         deployEvent.Manifest.App,
+		GitopsRef:   deployEvent.GitopsRef,
+		TriggeredBy: deployEvent.TriggeredBy,
+	})
+	if err != nil {
+		logrus.Warnf("could not record deployment: %s", err)
+	}
+}
+
 func processReleaseEvent(
 	store *store.Store,
 	gitopsRepo string,
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
 	gitopsRepoDeployKeyPath string,
-	githubChartAccessToken string,
 	event *model.Event,
+	renderConfig *RenderConfig,
 ) ([]*events.DeployEvent, error) {
 	var deployEvents []*events.DeployEvent
 	var releaseRequest dx.ReleaseRequest
@@ -258,20 +338,10 @@ func processReleaseEvent(
 		return deployEvents, fmt.Errorf("cannot parse release request with id: %s", event.ID)
 	}
 
-	artifactEvent, err := store.Artifact(releaseRequest.ArtifactID)
-	if err != nil {
-		return deployEvents, fmt.Errorf("cannot find artifact with id: %s", event.ArtifactID)
-	}
-	artifact, err := model.ToArtifact(artifactEvent)
-	if err != nil {
-		return deployEvents, fmt.Errorf("cannot parse artifact %s", err.Error())
-	}
-
-	manifests, err := artifact.CueEnvironmentsToManifests()
+	artifact, err := releasedArtifact(store, releaseRequest.ArtifactID)
 	if err != nil {
 		return deployEvents, err
 	}
-	artifact.Environments = append(artifact.Environments, manifests...)
 
 	for _, manifest := range artifact.Environments {
 		deployEvent := &events.DeployEvent{
@@ -282,13 +352,14 @@ func processReleaseEvent(
 			GitopsRepo:  gitopsRepo,
 		}
 
-		err := manifest.ResolveVars(artifact.Vars())
+		err := manifest.ResolveArtifactVars(artifact, &deployedReleases{repo: gitopsRepoCache.InstanceForRead()})
 		if err != nil {
 			deployEvent.Status = events.Failure
 			deployEvent.StatusDesc = err.Error()
 			deployEvents = append(deployEvents, deployEvent)
 			continue
 		}
+		manifest.Kustomize.ResolveRepository(artifact.Version)
 
 		if manifest.Env != releaseRequest.Env {
 			continue
@@ -298,25 +369,34 @@ func processReleaseEvent(
 			continue
 		}
 
+		if err := verifySignature(manifest.Env, artifact, renderConfig.SignatureRequiredEnvs); err != nil {
+			deployEvent.Status = events.Failure
+			deployEvent.StatusDesc = err.Error()
+			deployEvents = append(deployEvents, deployEvent)
+			continue
+		}
+
 		releaseMeta := &dx.Release{
 			App:         manifest.App,
 			Env:         manifest.Env,
 			ArtifactID:  artifact.ID,
 			Version:     &artifact.Version,
+			Provenance:  artifact.Provenance,
 			TriggeredBy: releaseRequest.TriggeredBy,
 		}
 
-		sha, err := cloneTemplateWriteAndPush(
-			gitopsRepo,
+		sha, policyWarnings, err := cloneTemplateWriteAndPush(
 			gitopsRepoCache,
 			gitopsRepoDeployKeyPath,
-			githubChartAccessToken,
 			manifest,
 			releaseMeta,
+			renderConfig,
 		)
 		if err != nil {
 			deployEvent.Status = events.Failure
 			deployEvent.StatusDesc = err.Error()
+		} else if policyWarnings != nil {
+			deployEvent.StatusDesc = policyWarnings.Error()
 		}
 		deployEvent.GitopsRef = sha
 		deployEvents = append(deployEvents, deployEvent)
@@ -325,6 +405,222 @@ func processReleaseEvent(
 	return deployEvents, nil
 }
 
+// releasedArtifact loads the artifact of a release request with the manifests of its CUE and Jsonnet environments
+func releasedArtifact(store *store.Store, artifactID string) (*dx.Artifact, error) {
+	artifactEvent, err := store.Artifact(artifactID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find artifact with id: %s", artifactID)
+	}
+	artifact, err := model.ToArtifact(artifactEvent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse artifact %s", err.Error())
+	}
+
+	manifests, err := artifact.CueEnvironmentsToManifests()
+	if err != nil {
+		return nil, err
+	}
+	artifact.Environments = append(artifact.Environments, manifests...)
+	manifests, err = artifact.JsonnetEnvironmentsToManifests()
+	if err != nil {
+		return nil, err
+	}
+	artifact.Environments = append(artifact.Environments, manifests...)
+
+	return artifact, nil
+}
+
+// processBatchReleaseEvent renders all releases of the batch, and writes them in a single gitops commit.
+// If any of the releases fails, nothing is pushed
+func processBatchReleaseEvent(
+	store *store.Store,
+	gitopsRepo string,
+	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	gitopsRepoDeployKeyPath string,
+	event *model.Event,
+	renderConfig *RenderConfig,
+) ([]*events.DeployEvent, error) {
+	var deployEvents []*events.DeployEvent
+	var batchReleaseRequest dx.BatchReleaseRequest
+	err := json.Unmarshal([]byte(event.Blob), &batchReleaseRequest)
+	if err != nil {
+		return deployEvents, fmt.Errorf("cannot parse batch release request with id: %s", event.ID)
+	}
+
+	var apps []*gitopsFiles
+	var batchErr error
+	releasedApps := map[string]bool{}
+	for _, releaseRequest := range batchReleaseRequest.Releases {
+		artifact, err := releasedArtifact(store, releaseRequest.ArtifactID)
+		if err != nil {
+			batchErr = err
+			break
+		}
+
+		for _, manifest := range artifact.Environments {
+			// manifests of other envs must not fail the batch, so they are filtered on their env name before resolving their vars
+			env, err := manifest.ResolveEnv(artifact)
+			if err != nil || env != releaseRequest.Env {
+				continue
+			}
+
+			deployEvent := &events.DeployEvent{
+				Manifest:    manifest,
+				Artifact:    artifact,
+				TriggeredBy: batchReleaseRequest.TriggeredBy,
+				Status:      events.Success,
+				GitopsRepo:  gitopsRepo,
+			}
+
+			err = manifest.ResolveArtifactVars(artifact, &deployedReleases{repo: gitopsRepoCache.InstanceForRead()})
+			if err != nil {
+				deployEvent.Status = events.Failure
+				deployEvent.StatusDesc = err.Error()
+				deployEvents = append(deployEvents, deployEvent)
+				batchErr = err
+				continue
+			}
+			manifest.Kustomize.ResolveRepository(artifact.Version)
+
+			if releaseRequest.App != "" &&
+				manifest.App != releaseRequest.App {
+				continue
+			}
+
+			// the apps of a batch are written in one commit, the same app must not be written twice
+			envApp := manifest.Env + "/" + manifest.App
+			if releasedApps[envApp] {
+				err = fmt.Errorf("%s is released more than once in the batch", envApp)
+				deployEvent.Status = events.Failure
+				deployEvent.StatusDesc = err.Error()
+				deployEvents = append(deployEvents, deployEvent)
+				batchErr = err
+				continue
+			}
+			releasedApps[envApp] = true
+
+			if err := verifySignature(manifest.Env, artifact, renderConfig.SignatureRequiredEnvs); err != nil {
+				deployEvent.Status = events.Failure
+				deployEvent.StatusDesc = err.Error()
+				deployEvents = append(deployEvents, deployEvent)
+				batchErr = err
+				continue
+			}
+
+			app, err := gitopsTemplate(
+				manifest,
+				&dx.Release{
+					App:         manifest.App,
+					Env:         manifest.Env,
+					ArtifactID:  artifact.ID,
+					Version:     &artifact.Version,
+					Provenance:  artifact.Provenance,
+					TriggeredBy: batchReleaseRequest.TriggeredBy,
+				},
+				renderConfig,
+			)
+			if err != nil {
+				deployEvent.Status = events.Failure
+				deployEvent.StatusDesc = err.Error()
+				deployEvents = append(deployEvents, deployEvent)
+				batchErr = err
+				continue
+			}
+			if app.policyWarnings != nil {
+				deployEvent.StatusDesc = app.policyWarnings.Error()
+			}
+			deployEvents = append(deployEvents, deployEvent)
+			apps = append(apps, app)
+		}
+	}
+
+	var sha string
+	if batchErr == nil {
+		sha, batchErr = writeAndPushBatch(gitopsRepoCache, gitopsRepoDeployKeyPath, apps)
+	}
+	for _, deployEvent := range deployEvents {
+		if batchErr != nil {
+			if deployEvent.Status == events.Success {
+				deployEvent.Status = events.Failure
+				deployEvent.StatusDesc = fmt.Sprintf("batch release failed: %s", batchErr)
+			}
+			continue
+		}
+		deployEvent.GitopsRef = sha
+	}
+
+	return deployEvents, batchErr
+}
+
+// writeAndPushBatch writes the apps of a batch release in a single commit, and pushes it
+func writeAndPushBatch(
+	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	gitopsRepoDeployKeyPath string,
+	apps []*gitopsFiles,
+) (string, error) {
+	if len(apps) == 0 {
+		return "", nil
+	}
+
+	repo, repoTmpPath, err := gitopsRepoCache.InstanceForWrite()
+	defer nativeGit.TmpFsCleanup(repoTmpPath)
+	if err != nil {
+		return "", err
+	}
+
+	sha, err := commitBatch(repo, apps)
+	if err != nil {
+		return "", err
+	}
+
+	if sha != "" { // if there is a change to push
+		head, _ := repo.Head()
+
+		operation := func() error {
+			return nativeGit.NativePush(repoTmpPath, gitopsRepoDeployKeyPath, head.Name().Short())
+		}
+		backoffStrategy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)
+		err := backoff.Retry(operation, backoffStrategy)
+		if err != nil {
+			return "", err
+		}
+		gitopsRepoCache.Invalidate()
+	}
+
+	return sha, nil
+}
+
+// commitBatch stages the files of all apps, and commits them together
+func commitBatch(repo *git.Repository, apps []*gitopsFiles) (string, error) {
+	empty, err := nativeGit.NothingToCommit(repo)
+	if err != nil {
+		return "", fmt.Errorf("cannot get git state %s", err)
+	}
+	if !empty {
+		return "", fmt.Errorf("there are staged changes in the gitops repo. Commit them first then try again")
+	}
+
+	var appNames []string
+	for _, app := range apps {
+		err = nativeGit.StageApp(repo, app.files, app.envFiles, app.env, app.app, app.releaseString)
+		if err != nil {
+			return "", fmt.Errorf("cannot write to git: %s", err.Error())
+		}
+		appNames = append(appNames, app.env+"/"+app.app)
+	}
+
+	empty, err = nativeGit.NothingToCommit(repo)
+	if err != nil {
+		return "", err
+	}
+	if empty {
+		return "", nil
+	}
+
+	gitMessage := fmt.Sprintf("[Gimlet] %s automated deploy", strings.Join(appNames, ", "))
+	return nativeGit.Commit(repo, gitMessage)
+}
+
 func processRollbackEvent(
 	gitopsRepo string,
 	gitopsRepoDeployKeyPath string,
@@ -415,9 +711,9 @@ func processArtifactEvent(
 	gitopsRepo string,
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
 	gitopsRepoDeployKeyPath string,
-	githubChartAccessToken string,
 	event *model.Event,
 	dao *store.Store,
+	renderConfig *RenderConfig,
 ) ([]*events.DeployEvent, error) {
 	var deployEvents []*events.DeployEvent
 	artifact, err := model.ToArtifact(event)
@@ -434,6 +730,11 @@ func processArtifactEvent(
 		return deployEvents, err
 	}
 	artifact.Environments = append(artifact.Environments, manifests...)
+	manifests, err = artifact.JsonnetEnvironmentsToManifests()
+	if err != nil {
+		return deployEvents, err
+	}
+	artifact.Environments = append(artifact.Environments, manifests...)
 
 	for _, manifest := range artifact.Environments {
 		deployEvent := &events.DeployEvent{
@@ -444,37 +745,47 @@ func processArtifactEvent(
 			GitopsRepo:  gitopsRepo,
 		}
 
-		err := manifest.ResolveVars(artifact.Vars())
+		err := manifest.ResolveArtifactVars(artifact, &deployedReleases{repo: gitopsRepoCache.InstanceForRead()})
 		if err != nil {
 			deployEvent.Status = events.Failure
 			deployEvent.StatusDesc = err.Error()
 			deployEvents = append(deployEvents, deployEvent)
 			continue
 		}
+		manifest.Kustomize.ResolveRepository(artifact.Version)
 
 		if !deployTrigger(artifact, manifest.Deploy) {
 			continue
 		}
 
+		if err := verifySignature(manifest.Env, artifact, renderConfig.SignatureRequiredEnvs); err != nil {
+			deployEvent.Status = events.Failure
+			deployEvent.StatusDesc = err.Error()
+			deployEvents = append(deployEvents, deployEvent)
+			continue
+		}
+
 		releaseMeta := &dx.Release{
 			App:         manifest.App,
 			Env:         manifest.Env,
 			ArtifactID:  artifact.ID,
 			Version:     &artifact.Version,
+			Provenance:  artifact.Provenance,
 			TriggeredBy: "policy",
 		}
 
-		sha, err := cloneTemplateWriteAndPush(
-			gitopsRepo,
+		sha, policyWarnings, err := cloneTemplateWriteAndPush(
 			gitopsRepoCache,
 			gitopsRepoDeployKeyPath,
-			githubChartAccessToken,
 			manifest,
 			releaseMeta,
+			renderConfig,
 		)
 		if err != nil {
 			deployEvent.Status = events.Failure
 			deployEvent.StatusDesc = err.Error()
+		} else if policyWarnings != nil {
+			deployEvent.StatusDesc = policyWarnings.Error()
 		}
 		deployEvent.GitopsRef = sha
 		deployEvents = append(deployEvents, deployEvent)
@@ -483,6 +794,57 @@ func processArtifactEvent(
 	return deployEvents, nil
 }
 
+// deployedReleases reads what currently runs from the gitops repo
+type deployedReleases struct {
+	repo *git.Repository
+}
+
+func (d *deployedReleases) Release(env string, app string) (*dx.Release, error) {
+	content, err := nativeGit.Content(d.repo, filepath.Join(env, app, "release.json"))
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return nil, nil
+	}
+
+	var release dx.Release
+	err = json.Unmarshal([]byte(content), &release)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse release.json: %s", err)
+	}
+	return &release, nil
+}
+
+// Images reads the images from the rendered manifests of the app, HelmReleases list none as Flux renders them
+func (d *deployedReleases) Images(env string, app string) ([]string, error) {
+	files, err := nativeGit.Tree(d.repo, filepath.Join(env, app))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fileNames []string
+	for fileName := range files {
+		if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	sort.Strings(fileNames)
+
+	var images []string
+	for _, fileName := range fileNames {
+		fileImages, err := dx.ContainerImages(files[fileName])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", fileName, err)
+		}
+		images = append(images, fileImages...)
+	}
+	return images, nil
+}
+
 func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact) {
 	reposWithCleanupPolicy, err := dao.ReposWithCleanupPolicy()
 	if err != nil && err != sql.ErrNoRows {
@@ -505,28 +867,28 @@ func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact)
 	}
 }
 
+// cloneTemplateWriteAndPush renders and pushes the manifest, and returns the policy violations of warn mode envs
 func cloneTemplateWriteAndPush(
-	gitopsRepo string,
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
 	gitopsRepoDeployKeyPath string,
-	githubChartAccessToken string,
 	manifest *dx.Manifest,
 	releaseMeta *dx.Release,
-) (string, error) {
+	renderConfig *RenderConfig,
+) (string, *dx.PolicyViolations, error) {
 	repo, repoTmpPath, err := gitopsRepoCache.InstanceForWrite()
 	defer nativeGit.TmpFsCleanup(repoTmpPath)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	sha, err := gitopsTemplateAndWrite(
+	sha, policyWarnings, err := gitopsTemplateAndWrite(
 		repo,
 		manifest,
 		releaseMeta,
-		githubChartAccessToken,
+		renderConfig,
 	)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	if sha != "" { // if there is a change to push
@@ -538,12 +900,12 @@ func cloneTemplateWriteAndPush(
 		backoffStrategy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)
 		err := backoff.Retry(operation, backoffStrategy)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		gitopsRepoCache.Invalidate()
 	}
 
-	return sha, nil
+	return sha, policyWarnings, nil
 }
 
 func cloneTemplateDeleteAndPush(
@@ -563,6 +925,9 @@ func cloneTemplateDeleteAndPush(
 	}
 
 	err = nativeGit.DelDir(repo, filepath.Join(env, cleanupPolicy.AppToCleanup))
+	if err == nil {
+		err = nativeGit.DelFile(repo, dx.FluxKustomizationPath(env, cleanupPolicy.AppToCleanup))
+	}
 	if err != nil {
 		gitopsEvent.Status = events.Failure
 		gitopsEvent.StatusDesc = err.Error()
@@ -624,7 +989,7 @@ func revertTo(env string, app string, repo *git.Repository, repoTmpPath string,
 		hasBeenReverted, err := nativeGit.HasBeenReverted(repo, commit, env, app)
 		if !hasBeenReverted {
 			logrus.Infof("reverting %s", commit.Hash.String())
-			err = nativeGit.NativeRevert(repoTmpPath, commit.Hash.String())
+			err = nativeGit.NativeRevertPath(repoTmpPath, commit.Hash.String(), path)
 			if err != nil {
 				return errors.WithMessage(err, "could not revert")
 			}
@@ -645,42 +1010,142 @@ func gitopsTemplateAndWrite(
 	repo *git.Repository,
 	manifest *dx.Manifest,
 	release *dx.Release,
-	tokenForChartClone string,
-) (string, error) {
-	if strings.HasPrefix(manifest.Chart.Name, "git@") {
-		return "", fmt.Errorf("only HTTPS git repo urls supported in GimletD for git based charts")
+	renderConfig *RenderConfig,
+) (string, *dx.PolicyViolations, error) {
+	app, err := gitopsTemplate(
+		manifest,
+		release,
+		renderConfig,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sha, err := nativeGit.CommitAppToGit(repo, app.files, app.envFiles, app.env, app.app, "automated deploy", app.releaseString)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot write to git: %s", err.Error())
+	}
+
+	return sha, app.policyWarnings, nil
+}
+
+// gitopsFiles are the rendered files of an app, ready to be written to the gitops repo
+type gitopsFiles struct {
+	env           string
+	app           string
+	files         map[string]string
+	envFiles      map[string]string
+	releaseString string
+	// policyWarnings are the violations of the env policy in warn mode
+	policyWarnings *dx.PolicyViolations
+}
+
+// gitopsTemplate renders the manifest into the files of the app, the env files and the release metadata
+func gitopsTemplate(
+	manifest *dx.Manifest,
+	release *dx.Release,
+	renderConfig *RenderConfig,
+) (*gitopsFiles, error) {
+	chartCache := renderConfig.ChartCache
+	policy := renderConfig.Policy
+	gitopsLayout := renderConfig.GitopsLayout
+	tokenForChartClone := renderConfig.chartAccessToken
+
+	// the chart is rendered from a local path, the manifest keeps referring to the original chart
+	defer func(chartName string) {
+		manifest.Chart.Name = chartName
+	}(manifest.Chart.Name)
+
+	// Flux fetches and renders the chart of HelmReleases in-cluster
+	helmRelease := gitopsLayout.HelmRelease(manifest.Env) && manifest.Chart.Name != ""
+	if helmRelease && policy.EnvPolicy(manifest.Env) != nil {
+		return nil, fmt.Errorf("%s has a policy that cannot be validated on HelmReleases, the chart is rendered by Flux", manifest.Env)
+	}
+
+	var cachedChart string
+	if chartCache != nil && !helmRelease {
+		t0 := time.Now().UnixNano()
+		var err error
+		cachedChart, err = chartCache.Locate(manifest, tokenForChartClone)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch chart %s", err.Error())
+		}
+		logrus.Infof("Locating chart took %d", (time.Now().UnixNano()-t0)/1000/1000)
 	}
-	if strings.Contains(manifest.Chart.Name, ".git") {
+
+	if cachedChart != "" {
+		manifest.Chart.Name = cachedChart
+	} else if dx.IsGitChart(manifest.Chart.Name) && !helmRelease {
 		t0 := time.Now().UnixNano()
 		tmpChartDir, err := dx.CloneChartFromRepo(manifest, tokenForChartClone)
 		if err != nil {
-			return "", fmt.Errorf("cannot fetch chart from git %s", err.Error())
+			return nil, fmt.Errorf("cannot fetch chart from git %s", err.Error())
 		}
 		logrus.Infof("Cloning chart took %d", (time.Now().UnixNano()-t0)/1000/1000)
 		manifest.Chart.Name = tmpChartDir
 		defer os.RemoveAll(tmpChartDir)
 	}
 
+	if manifest.Kustomize != nil {
+		t0 := time.Now().UnixNano()
+		tmpKustomizationDir, err := dx.CloneKustomization(manifest, tokenForChartClone)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch kustomization from git %s", err.Error())
+		}
+		logrus.Infof("Cloning kustomization took %d", (time.Now().UnixNano()-t0)/1000/1000)
+		manifest.Kustomize.UseClone(tmpKustomizationDir)
+		defer manifest.Kustomize.UseClone("")
+		defer os.RemoveAll(tmpKustomizationDir)
+	}
+
 	t0 := time.Now().UnixNano()
-	templatedManifests, err := manifest.Render()
+	var templatedManifests string
+	var err error
+	if helmRelease {
+		templatedManifests, err = manifest.RenderHelmRelease(gitopsLayout.SourceSecrets)
+	} else {
+		templatedManifests, err = manifest.Render()
+	}
 	if err != nil {
-		return "", fmt.Errorf("cannot run render template %s", err.Error())
+		return nil, fmt.Errorf("cannot run render template %s", err.Error())
 	}
 	logrus.Infof("Helm template took %d", (time.Now().UnixNano()-t0)/1000/1000)
 
-	files := dx.SplitHelmOutput(map[string]string{"manifest.yaml": templatedManifests})
+	violations, err := policy.Validate(manifest.Env, manifest.App, templatedManifests)
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate policy %s", err.Error())
+	}
+	var policyWarnings *dx.PolicyViolations
+	if violations != nil {
+		if policy.EnvPolicy(manifest.Env).Mode == dx.PolicyEnforce {
+			return nil, violations
+		}
+		logrus.Warn(violations.Error())
+		policyWarnings = violations
+	}
 
-	releaseString, err := json.Marshal(release)
+	files, err := gitopsLayout.AppFiles(templatedManifests)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lay out manifests: %s", err.Error())
+	}
+	files, err = renderConfig.SecretEncryption.Encrypt(manifest.Env, files)
 	if err != nil {
-		return "", fmt.Errorf("cannot marshal release meta data %s", err.Error())
+		return nil, fmt.Errorf("cannot encrypt secrets: %s", err.Error())
 	}
 
-	sha, err := nativeGit.CommitFilesToGit(repo, files, manifest.Env, manifest.App, "automated deploy", string(releaseString))
+	releaseString, err := json.Marshal(release)
 	if err != nil {
-		return "", fmt.Errorf("cannot write to git: %s", err.Error())
+		return nil, fmt.Errorf("cannot marshal release meta data %s", err.Error())
 	}
 
-	return sha, nil
+	return &gitopsFiles{
+		env:            manifest.Env,
+		app:            manifest.App,
+		files:          files,
+		envFiles:       gitopsLayout.EnvFiles(manifest.Env, manifest.App),
+		releaseString:  string(releaseString),
+		policyWarnings: policyWarnings,
+	}, nil
 }
 
 func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
@@ -757,6 +1222,33 @@ func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
 	return true
 }
 
+// verifySignature refuses artifacts without a verified signature in environments that require signed artifacts
+func verifySignature(env string, artifact *dx.Artifact, signatureRequiredEnvs []string) error {
+	if signatureRequired(env, signatureRequiredEnvs) && !artifact.Provenance.IsVerified() {
+		return fmt.Errorf("%s only accepts signed artifacts", env)
+	}
+	return nil
+}
+
+func signatureRequired(env string, signatureRequiredEnvs []string) bool {
+	for _, pattern := range signatureRequiredEnvs {
+		if matched, _ := path.Match(pattern, env); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSignatureRequiredEnvs checks the env patterns that only accept signed artifacts
+func ValidateSignatureRequiredEnvs(signatureRequiredEnvs []string) error {
+	for _, pattern := range signatureRequiredEnvs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid signature required env pattern %s: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
 func cleanupTrigger(branch string, cleanupPolicy *dx.Cleanup) bool {
 	if cleanupPolicy == nil {
 		return false
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gimlet-io/gimletd/dx"
@@ -96,7 +97,7 @@ func Test_gitopsTemplateAndWrite(t *testing.T) {
 	repo, _ := git.Init(memory.NewStorage(), memfs.New())
 	_, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{""}})
 
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, &RenderConfig{})
 	assert.Nil(t, err)
 }
 
@@ -144,7 +145,7 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 `
 
 	json.Unmarshal([]byte(withVolume), &a)
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, &RenderConfig{})
 	assert.Nil(t, err)
 
 	content, _ := nativeGit.Content(repo, "staging/my-app/deployment.yaml")
@@ -182,13 +183,54 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 
 	var b dx.Artifact
 	err = json.Unmarshal([]byte(withoutVolume), &b)
-	_, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, &RenderConfig{})
 	assert.Nil(t, err)
 
 	content, _ = nativeGit.Content(repo, "staging/my-app/pvc.yaml")
 	assert.Equal(t, content, "")
 }
 
+func Test_gitopsTemplateAndWrite_helmRelease(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	m := &dx.Manifest{
+		App:       "my-app",
+		Env:       "production",
+		Namespace: "production",
+		Chart: dx.Chart{
+			Repository: "https://chart.onechart.dev",
+			Name:       "onechart",
+			Version:    "0.21.0",
+		},
+		Values: map[string]interface{}{
+			"replicas": 2,
+		},
+	}
+	layout, _ := dx.NewGitopsLayout(dx.LayoutResource, true, "", []string{"production"}, nil)
+
+	sha, _, err := gitopsTemplateAndWrite(repo, m, &dx.Release{App: "my-app", Env: "production"}, &RenderConfig{GitopsLayout: layout})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", sha)
+
+	helmRelease, _ := nativeGit.Content(repo, "production/my-app/helmrelease-my-app.yaml")
+	assert.Contains(t, helmRelease, "name: my-app-values")
+	values, _ := nativeGit.Content(repo, "production/my-app/secret-my-app-values.yaml")
+	assert.Contains(t, values, "replicas: 2")
+	helmRepository, _ := nativeGit.Content(repo, "production/my-app/helmrepository-my-app.yaml")
+	assert.Contains(t, helmRepository, "url: https://chart.onechart.dev")
+	release, _ := nativeGit.Content(repo, "production/my-app/release.json")
+	assert.Contains(t, release, `"app":"my-app"`)
+	kustomization, _ := nativeGit.Content(repo, "production/flux/kustomization-my-app.yaml")
+	assert.Contains(t, kustomization, "path: ./production/my-app")
+
+	policy := &dx.Policy{Envs: []dx.EnvPolicy{{Env: "production", Mode: dx.PolicyWarn}}}
+	_, _, err = gitopsTemplateAndWrite(repo, m, &dx.Release{App: "my-app", Env: "production"}, &RenderConfig{Policy: policy, GitopsLayout: layout})
+	assert.NotNil(t, err, "should refuse HelmReleases in envs with a policy")
+
+	encryption, _ := dx.NewSecretEncryption(nil, nil, []string{"production"})
+	_, _, err = gitopsTemplateAndWrite(repo, m, &dx.Release{App: "my-app", Env: "production"}, &RenderConfig{SecretEncryption: encryption, GitopsLayout: layout})
+	assert.NotNil(t, err, "should refuse plain text values in protected envs")
+}
+
 func Test_emptyTrigger(t *testing.T) {
 	triggered := deployTrigger(
 		&dx.Artifact{}, nil)
@@ -539,3 +581,175 @@ func Test_cleanupTrigger(t *testing.T) {
 	})
 	assert.False(t, triggered, "Should not trigger on missing app")
 }
+
+func Test_deployedReleases(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	deployed := &deployedReleases{repo: repo}
+
+	release, err := deployed.Release("staging", "my-app")
+	assert.Nil(t, err)
+	assert.Nil(t, release)
+	images, err := deployed.Images("staging", "my-app")
+	assert.Nil(t, err)
+	assert.Empty(t, images)
+
+	_, err = nativeGit.CommitFilesToGit(repo, map[string]string{
+		"deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  template:
+    spec:
+      containers:
+      - name: my-app
+        image: ghcr.io/gimlet-io/my-app:abc1234
+`,
+	}, "staging", "my-app", "automated deploy", `{"app":"my-app","env":"staging","artifactId":"my-app-abc1234"}`)
+	assert.Nil(t, err)
+
+	release, err = deployed.Release("staging", "my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-abc1234", release.ArtifactID)
+	images, err = deployed.Images("staging", "my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ghcr.io/gimlet-io/my-app:abc1234"}, images)
+}
+
+func Test_commitBatch(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+
+	sha, err := commitBatch(repo, []*gitopsFiles{
+		{
+			env:           "staging",
+			app:           "frontend",
+			files:         map[string]string{"deployment.yaml": "frontend"},
+			envFiles:      map[string]string{},
+			releaseString: `{"app":"frontend","env":"staging"}`,
+		},
+		{
+			env:           "staging",
+			app:           "backend",
+			files:         map[string]string{"deployment.yaml": "backend"},
+			envFiles:      map[string]string{},
+			releaseString: `{"app":"backend","env":"staging"}`,
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", sha)
+
+	frontend, _ := nativeGit.Content(repo, "staging/frontend/deployment.yaml")
+	assert.Equal(t, "frontend\n", frontend)
+	backend, _ := nativeGit.Content(repo, "staging/backend/deployment.yaml")
+	assert.Equal(t, "backend\n", backend)
+
+	commits, _ := repo.Log(&git.LogOptions{})
+	count := 0
+	commits.ForEach(func(c *object.Commit) error {
+		count++
+		assert.Equal(t, "[Gimlet] staging/frontend, staging/backend automated deploy", c.Message)
+		return nil
+	})
+	assert.Equal(t, 1, count, "should write the batch in a single commit")
+}
+
+func Test_revertTo_batch(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	var SHAs []string
+	commits, _ := repo.Log(&git.LogOptions{})
+	commits.ForEach(func(c *object.Commit) error {
+		SHAs = append(SHAs, c.Hash.String())
+		return nil
+	})
+
+	_, err := commitBatch(repo, []*gitopsFiles{
+		{
+			env:           "staging",
+			app:           "my-app",
+			files:         map[string]string{"file": "batch"},
+			envFiles:      map[string]string{},
+			releaseString: `{"app":"my-app","env":"staging"}`,
+		},
+		{
+			env:           "staging",
+			app:           "other-app",
+			files:         map[string]string{"file": "batch"},
+			envFiles:      map[string]string{},
+			releaseString: `{"app":"other-app","env":"staging"}`,
+		},
+	})
+	assert.Nil(t, err)
+
+	releases, err := nativeGit.Releases(repo, "my-app", "staging", nil, nil, 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(releases))
+	assert.Equal(t, "my-app", releases[0].App, "should read the app's release.json of the batch commit")
+
+	err = revertTo(
+		"staging",
+		"my-app",
+		repo,
+		path,
+		SHAs[0],
+	)
+	assert.Nil(t, err)
+	content, _ := nativeGit.Content(repo, "staging/my-app/file")
+	assert.Equal(t, "3\n", content)
+	content, _ = nativeGit.Content(repo, "staging/other-app/file")
+	assert.Equal(t, "batch\n", content, "rollback should leave the other apps of the batch commit in place")
+}
+
+func Test_verifySignature(t *testing.T) {
+	signatureRequiredEnvs := []string{"production"}
+	unsigned := &dx.Artifact{Provenance: &dx.Provenance{SignatureStatus: dx.SignatureUnsigned}}
+	signed := &dx.Artifact{Provenance: &dx.Provenance{SignatureStatus: dx.SignatureVerified, KeyID: "ci"}}
+
+	assert.NotNil(t, verifySignature("production", unsigned, signatureRequiredEnvs), "should refuse unsigned artifacts")
+	assert.NotNil(t, verifySignature("production", &dx.Artifact{}, signatureRequiredEnvs), "should refuse artifacts without provenance")
+	assert.Nil(t, verifySignature("production", signed, signatureRequiredEnvs))
+	assert.Nil(t, verifySignature("staging", unsigned, signatureRequiredEnvs))
+
+	signatureRequiredEnvs = []string{"production-*"}
+	assert.NotNil(t, verifySignature("production-eu", unsigned, signatureRequiredEnvs), "should match env globs")
+	assert.Nil(t, verifySignature("staging-eu", unsigned, signatureRequiredEnvs))
+
+	assert.NotNil(t, ValidateSignatureRequiredEnvs([]string{"production-["}), "should refuse invalid patterns")
+}
+
+func Test_gitopsTemplate_policyWarnings(t *testing.T) {
+	chartDir := t.TempDir()
+	os.MkdirAll(filepath.Join(chartDir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: my-chart\nversion: 0.1.0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(chartDir, "templates", "pod.yaml"), []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: my-app
+spec:
+  containers:
+  - name: app
+    image: nginx
+`), 0644)
+
+	m := &dx.Manifest{
+		App:       "my-app",
+		Env:       "staging",
+		Namespace: "staging",
+		Chart:     dx.Chart{Name: chartDir},
+	}
+	policy := &dx.Policy{Envs: []dx.EnvPolicy{{Env: "staging", Mode: dx.PolicyWarn, Rules: dx.PolicyRules{NoLatestTag: true}}}}
+
+	app, err := gitopsTemplate(m, &dx.Release{App: "my-app", Env: "staging"}, &RenderConfig{Policy: policy})
+	assert.Nil(t, err)
+	assert.NotNil(t, app.policyWarnings, "should report the violations of warn mode envs")
+	assert.Contains(t, app.policyWarnings.Error(), "container app uses the latest tag of nginx")
+
+	policy.Envs[0].Mode = dx.PolicyEnforce
+	_, err = gitopsTemplate(m, &dx.Release{App: "my-app", Env: "staging"}, &RenderConfig{Policy: policy})
+	assert.NotNil(t, err)
+}